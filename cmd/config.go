@@ -0,0 +1,29 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"io"
+	"os"
+
+	"walet_rest_api/internal/config"
+)
+
+const configUsage = "usage: config print [--redacted]"
+
+// runConfig выполняет команду config: print печатает итоговую конфигурацию со
+// всеми источниками, с --redacted без паролей к базам.
+func runConfig(args []string, cfg *config.Config) error {
+	if len(args) == 0 || args[0] != "print" {
+		return errors.New(configUsage)
+	}
+
+	flags := flag.NewFlagSet("config print", flag.ContinueOnError)
+	flags.SetOutput(io.Discard)
+	redacted := flags.Bool("redacted", false, "hide database passwords")
+	if err := flags.Parse(args[1:]); err != nil || flags.NArg() > 0 {
+		return errors.New(configUsage)
+	}
+
+	return cfg.Print(os.Stdout, *redacted)
+}
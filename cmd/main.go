@@ -2,20 +2,25 @@ package main
 
 import (
 	"context"
+	"fmt"
 	"net/http"
+	"os"
 	"os/signal"
 	"syscall"
 	"time"
 
 	"walet_rest_api/internal/config"
 	"walet_rest_api/internal/domain/wallet"
+	"walet_rest_api/internal/domain/wallet/coalesce"
 	walletdb "walet_rest_api/internal/domain/wallet/db"
+	"walet_rest_api/internal/domain/wallet/memory"
+	"walet_rest_api/internal/domain/wallet/rates"
 	"walet_rest_api/internal/handler"
 	"walet_rest_api/pkg/client/postgres"
 	"walet_rest_api/pkg/logging"
 
-	"github.com/gin-gonic/gin"
 	"github.com/joho/godotenv"
+	"github.com/sirupsen/logrus"
 )
 
 func main() {
@@ -23,27 +28,152 @@ func main() {
 
 	godotenv.Load()
 
-	cfg := config.Load()
+	cfg, args, err := config.Load(os.Args[1:])
+	if err != nil {
+		//config print показывает и неверную конфигурацию: ее как раз и смотрят
+		if cfg != nil && len(args) > 0 && args[0] == "config" {
+			if err := runConfig(args[1:], cfg); err != nil {
+				fmt.Fprintln(os.Stderr, err)
+			}
+		}
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+	if err := logging.Configure(cfg.Log.Level, cfg.Log.Format); err != nil {
+		logger.WithError(err).Fatal("invalid log configuration")
+	}
 
 	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGTERM, syscall.SIGINT)
 	defer stop()
 
-	db := postgres.NewPool(ctx)
+	//Без команды запускается HTTP-сервер
+	if len(args) > 0 {
+		switch args[0] {
+		case "migrate":
+			if err := runMigrate(ctx, args[1:], cfg, logger); err != nil {
+				logger.WithError(err).Fatal("migrate failed")
+			}
+			return
+		case "slots":
+			if err := runSlots(ctx, args[1:], cfg, logger); err != nil {
+				logger.WithError(err).Fatal("slots failed")
+			}
+			return
+		case "config":
+			if err := runConfig(args[1:], cfg); err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				os.Exit(2)
+			}
+			return
+		default:
+			logger.Fatalf("unknown command %q, expected migrate, slots or config", args[0])
+		}
+	}
+
+	var storage wallet.Storage
+	switch cfg.Storage {
+	case "postgres":
+		pgConfig := cfg.Database.Pool()
+
+		db, err := postgres.NewPool(ctx, pgConfig)
+		if err != nil {
+			logger.WithError(err).Fatal("failed to connect to database")
+		}
+		defer db.Close()
+
+		if cfg.Features.AutoMigrate {
+			if err := migrateUp(ctx, db, logger); err != nil {
+				logger.WithError(err).Fatal("failed to apply migrations")
+			}
+		}
+
+		//С репликой балансы и история читаются с нее, пока она не отстает
+		var client postgres.Pool = db
+		if pgConfig.ReplicaDSN != "" {
+			replica, err := postgres.NewReplicaPool(ctx, pgConfig)
+			if err != nil {
+				logger.WithError(err).Fatal("invalid replica configuration")
+			}
+			defer replica.Close()
+
+			client = postgres.NewRouter(db, replica, pgConfig.MaxReplicaLag)
+			logger.Infof("Reading balances from replica, max lag %v", pgConfig.MaxReplicaLag)
+		}
+
+		storage = walletdb.NewWalletDB(client, logger)
+	case "memory":
+		storage = memory.New()
+		logger.Warn("Using in-memory storage, wallets are lost on restart")
+	default:
+		logger.Fatalf("storage must be postgres or memory, got %q", cfg.Storage)
+	}
+
+	if checker, ok := storage.(wallet.LedgerChecker); ok {
+		go checkLedger(ctx, checker, logger)
+	}
+
+	if consolidator, ok := storage.(wallet.SlotConsolidator); ok {
+		go consolidateSlots(ctx, consolidator, logger)
+	}
+
+	if window := cfg.Features.CoalesceWindow; window > 0 {
+		storage = coalesce.New(storage, window)
+		logger.Infof("Coalescing balance changes within %v", window)
+	}
 
-	defer db.Close()
+	exchange, err := exchangeConfig(cfg)
+	if err != nil {
+		logger.WithError(err).Fatal("invalid exchange configuration")
+	}
 
-	storage := walletdb.NewWalletDB(db, logger)
+	service := wallet.NewService(storage, exchange)
 
-	service := wallet.NewService(storage)
+	go expireHolds(ctx, service, logger)
 
 	h := handler.NewHandlers(service, logger)
 
-	router := gin.Default()
+	//Уровень логов, лимиты и режим обслуживания меняются без перезапуска
+	applyRuntime := func(cfg *config.Config) {
+		if err := logging.Configure(cfg.Log.Level, cfg.Log.Format); err != nil {
+			logger.WithError(err).Error("invalid log configuration")
+		}
+
+		limits, err := cfg.Limits.Operations()
+		if err != nil {
+			logger.WithError(err).Error("invalid operation limits")
+		} else if setter, ok := service.(wallet.LimitSetter); ok {
+			setter.SetLimits(limits)
+		}
+
+		h.SetRuntime(handler.Runtime{
+			Maintenance: cfg.Features.Maintenance,
+			RateLimit:   cfg.Limits.RateLimit,
+			RateBurst:   cfg.Limits.RateBurst,
+		})
+		if cfg.Features.Maintenance {
+			logger.Warn("Maintenance mode is on, writes are rejected")
+		}
+	}
+	applyRuntime(cfg)
+
+	watcher := config.NewWatcher(cfg, os.Args[1:], logger)
+	watcher.OnChange(applyRuntime)
+	go watcher.Run(ctx)
+
+	router, err := handler.NewEngine(cfg.HTTP.Proxies())
+	if err != nil {
+		logger.WithError(err).Fatal("failed to create HTTP router")
+	}
 	h.RegisterRoutes(router)
 
 	srv := &http.Server{
-		Addr:    cfg.HTTPAddr,
-		Handler: router,
+		Addr:              cfg.HTTP.Addr(),
+		Handler:           http.MaxBytesHandler(router, cfg.Limits.MaxBodyBytes),
+		ReadHeaderTimeout: cfg.HTTP.ReadHeaderTimeout,
+		ReadTimeout:       cfg.HTTP.ReadTimeout,
+		WriteTimeout:      cfg.HTTP.WriteTimeout,
+		IdleTimeout:       cfg.HTTP.IdleTimeout,
+		MaxHeaderBytes:    cfg.Limits.MaxHeaderBytes,
 	}
 
 	go func() {
@@ -52,12 +182,12 @@ func main() {
 		}
 	}()
 
-	logger.Infof("HTTP server started on %s", cfg.HTTPAddr)
+	logger.Infof("HTTP server started on %s", cfg.HTTP.Addr())
 
 	<-ctx.Done()
 	logger.Info("Shutting down HTTP server...")
 
-	shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), cfg.HTTP.ShutdownTimeout)
 	defer cancel()
 
 	if err := srv.Shutdown(shutdownCtx); err != nil {
@@ -66,3 +196,99 @@ func main() {
 		logger.Info("HTTP server stopped gracefully")
 	}
 }
+
+// holdExpiryInterval - как часто снимаются просроченные холды.
+const holdExpiryInterval = 30 * time.Second
+
+func expireHolds(ctx context.Context, service wallet.Service, logger *logrus.Logger) {
+	ticker := time.NewTicker(holdExpiryInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			expired, err := service.ExpireHolds(ctx)
+			if err != nil {
+				logger.WithError(err).Error("failed to expire holds")
+				continue
+			}
+			if expired > 0 {
+				logger.Infof("Expired %d holds", expired)
+			}
+		}
+	}
+}
+
+// ledgerCheckInterval - как часто сверяются проводки и балансы. Сверка читает
+// все проводки, поэтому идет редко.
+const ledgerCheckInterval = time.Hour
+
+func checkLedger(ctx context.Context, checker wallet.LedgerChecker, logger *logrus.Logger) {
+	ticker := time.NewTicker(ledgerCheckInterval)
+	defer ticker.Stop()
+
+	for {
+		violations, err := checker.CheckLedger(ctx)
+		if err != nil {
+			logger.WithError(err).Error("failed to check ledger")
+		}
+		for _, violation := range violations {
+			logger.Errorf("Ledger invariant violated: %s", violation)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// slotConsolidationInterval - как часто слоты горячих кошельков переносятся в
+// основные балансы. Заодно с этой частотой подхватываются изменения wallets.slots.
+const slotConsolidationInterval = time.Minute
+
+func consolidateSlots(ctx context.Context, consolidator wallet.SlotConsolidator, logger *logrus.Logger) {
+	ticker := time.NewTicker(slotConsolidationInterval)
+	defer ticker.Stop()
+
+	for {
+		consolidated, err := consolidator.ConsolidateSlots(ctx)
+		if err != nil {
+			logger.WithError(err).Error("failed to consolidate balance slots")
+		}
+		if consolidated > 0 {
+			logger.Infof("Consolidated balance slots of %d wallets", consolidated)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// exchangeConfig собирает настройки обмена валют. Без файла курсов обмен отключен.
+func exchangeConfig(cfg *config.Config) (wallet.ExchangeConfig, error) {
+	exchange := wallet.ExchangeConfig{QuoteTTL: cfg.Exchange.QuoteTTL}
+
+	//Спред уже проверен при загрузке конфигурации
+	spread, err := wallet.ParseRate(cfg.Exchange.Spread)
+	if err != nil {
+		return exchange, fmt.Errorf("exchange.spread: %w", err)
+	}
+	exchange.Spread = spread
+
+	if cfg.Exchange.RatesFile != "" {
+		provider, err := rates.LoadFile(cfg.Exchange.RatesFile)
+		if err != nil {
+			return exchange, err
+		}
+		exchange.Rates = provider
+	}
+
+	return exchange, nil
+}
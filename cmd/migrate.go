@@ -0,0 +1,107 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+
+	"walet_rest_api/internal/config"
+	"walet_rest_api/internal/migrate"
+	"walet_rest_api/migrations"
+	"walet_rest_api/pkg/client/postgres"
+
+	"github.com/sirupsen/logrus"
+)
+
+const migrateUsage = "usage: migrate up | down [n] | status"
+
+// runMigrate выполняет команду migrate: up применяет все новые миграции, down
+// откатывает n последних (по умолчанию одну), status печатает версию схемы.
+func runMigrate(ctx context.Context, args []string, cfg *config.Config, logger *logrus.Logger) error {
+	if len(args) == 0 || len(args) > 2 || (len(args) == 2 && args[0] != "down") {
+		return errors.New(migrateUsage)
+	}
+
+	steps := 1
+	if len(args) == 2 {
+		n, err := strconv.Atoi(args[1])
+		if err != nil || n <= 0 {
+			return fmt.Errorf("migrate down expects a positive number of migrations, got %q", args[1])
+		}
+		steps = n
+	}
+
+	if cfg.Database.URL == "" {
+		return errors.New("database.url is required to run migrations")
+	}
+
+	db, err := postgres.NewPool(ctx, cfg.Database.Pool())
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	migrator, err := migrate.New(db, logger, migrations.FS)
+	if err != nil {
+		return err
+	}
+
+	switch args[0] {
+	case "up":
+		applied, err := migrator.Up(ctx)
+		if err != nil {
+			return err
+		}
+		logger.Infof("Applied %d migrations", applied)
+	case "down":
+		reverted, err := migrator.Down(ctx, steps)
+		if err != nil {
+			return err
+		}
+		logger.Infof("Reverted %d migrations", reverted)
+	case "status":
+		status, err := migrator.Status(ctx)
+		if err != nil {
+			return err
+		}
+		printStatus(status)
+	default:
+		return errors.New(migrateUsage)
+	}
+
+	return nil
+}
+
+func printStatus(status *migrate.Status) {
+	fmt.Printf("version: %d", status.Version)
+	if status.Dirty {
+		fmt.Print(" (dirty)")
+	}
+	fmt.Println()
+
+	for _, migration := range status.Applied {
+		fmt.Printf("applied  %03d_%s\n", migration.Version, migration.Name)
+	}
+	for _, migration := range status.Pending {
+		fmt.Printf("pending  %03d_%s\n", migration.Version, migration.Name)
+	}
+}
+
+// migrateUp применяет миграции при старте сервера, если задан AUTO_MIGRATE.
+func migrateUp(ctx context.Context, client postgres.Client, logger *logrus.Logger) error {
+	migrator, err := migrate.New(client, logger, migrations.FS)
+	if err != nil {
+		return err
+	}
+
+	applied, err := migrator.Up(ctx)
+	if err != nil {
+		return err
+	}
+	if applied > 0 {
+		logger.Infof("Applied %d migrations", applied)
+	}
+
+	return nil
+}
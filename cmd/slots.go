@@ -0,0 +1,53 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+
+	"walet_rest_api/internal/config"
+	"walet_rest_api/internal/domain/wallet"
+	walletdb "walet_rest_api/internal/domain/wallet/db"
+	"walet_rest_api/pkg/client/postgres"
+
+	"github.com/google/uuid"
+	"github.com/sirupsen/logrus"
+)
+
+const slotsUsage = "usage: slots set <wallet-id> <count>"
+
+// runSlots выполняет команду slots: set задает число слотов баланса горячего
+// кошелька, 1 отключает слоты.
+func runSlots(ctx context.Context, args []string, cfg *config.Config, logger *logrus.Logger) error {
+	if len(args) != 3 || args[0] != "set" {
+		return errors.New(slotsUsage)
+	}
+
+	walletID, err := uuid.Parse(args[1])
+	if err != nil {
+		return fmt.Errorf("invalid wallet id %q", args[1])
+	}
+	slots, err := strconv.Atoi(args[2])
+	if err != nil {
+		return fmt.Errorf("slots set expects a number of slots, got %q", args[2])
+	}
+
+	if cfg.Database.URL == "" {
+		return errors.New("database.url is required to configure balance slots")
+	}
+
+	db, err := postgres.NewPool(ctx, cfg.Database.Pool())
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	storage := walletdb.NewWalletDB(db, logger)
+	if err := storage.(wallet.SlotSetter).SetSlots(ctx, walletID, slots); err != nil {
+		return err
+	}
+
+	logger.Infof("Wallet %v now has %d balance slots", walletID, slots)
+	return nil
+}
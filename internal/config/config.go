@@ -1,22 +1,250 @@
+// Package config собирает настройки приложения из файла, переменных окружения и
+// флагов командной строки. Порядок источников описан в Load.
 package config
 
 import (
-	"os"
+	"errors"
+	"fmt"
+	"maps"
+	"math/big"
+	"net"
+	"slices"
+	"strings"
+	"time"
+
+	"walet_rest_api/internal/domain/wallet"
+	"walet_rest_api/pkg/client/postgres"
+
+	"github.com/sirupsen/logrus"
 )
 
 type Config struct {
-	HTTPAddr string
+	// Хранилище кошельков: postgres или memory (в памяти процесса, без базы)
+	Storage string `yaml:"storage"`
+
+	HTTP     HTTP     `yaml:"http"`
+	Database Database `yaml:"database"`
+	Log      Log      `yaml:"log"`
+	Limits   Limits   `yaml:"limits"`
+	Features Features `yaml:"features"`
+	Exchange Exchange `yaml:"exchange"`
+
+	// Файл, из которого загружены настройки. Его отслеживает Watcher
+	File string `yaml:"-"`
+}
+
+type HTTP struct {
+	Port              int           `yaml:"port"`
+	ReadHeaderTimeout time.Duration `yaml:"read_header_timeout"`
+	ReadTimeout       time.Duration `yaml:"read_timeout"`
+	WriteTimeout      time.Duration `yaml:"write_timeout"`
+	IdleTimeout       time.Duration `yaml:"idle_timeout"`
+	// Сколько ждать завершения запросов при остановке
+	ShutdownTimeout time.Duration `yaml:"shutdown_timeout"`
+	// Адреса и подсети прокси через запятую, от которых принимается X-Forwarded-For
+	TrustedProxies string `yaml:"trusted_proxies"`
 }
 
-func Load() *Config {
-	port := os.Getenv("HTTP_PORT")
-	if port == "" {
-		port = "3010"
+func (h HTTP) Addr() string {
+	return fmt.Sprintf(":%d", h.Port)
+}
+
+// Proxies возвращает список TrustedProxies, пустой - не доверять никому.
+func (h HTTP) Proxies() []string {
+	var proxies []string
+	for _, proxy := range strings.Split(h.TrustedProxies, ",") {
+		if proxy = strings.TrimSpace(proxy); proxy != "" {
+			proxies = append(proxies, proxy)
+		}
 	}
+	return proxies
+}
 
+// Database - настройки пула, смысл полей как в postgres.Config.
+type Database struct {
+	URL              string        `yaml:"url"`
+	ReplicaURL       string        `yaml:"replica_url"`
+	MaxConns         int32         `yaml:"max_conns"`
+	MinConns         int32         `yaml:"min_conns"`
+	MaxConnLifetime  time.Duration `yaml:"max_conn_lifetime"`
+	MaxConnIdleTime  time.Duration `yaml:"max_conn_idle_time"`
+	StatementTimeout time.Duration `yaml:"statement_timeout"`
+	ApplicationName  string        `yaml:"application_name"`
+	ConnectTimeout   time.Duration `yaml:"connect_timeout"`
+	MaxReplicaLag    time.Duration `yaml:"max_replica_lag"`
+}
+
+func (d Database) Pool() postgres.Config {
+	return postgres.Config{
+		DSN:              d.URL,
+		MaxConns:         d.MaxConns,
+		MinConns:         d.MinConns,
+		MaxConnLifetime:  d.MaxConnLifetime,
+		MaxConnIdleTime:  d.MaxConnIdleTime,
+		StatementTimeout: d.StatementTimeout,
+		ApplicationName:  d.ApplicationName,
+		ConnectTimeout:   d.ConnectTimeout,
+		ReplicaDSN:       d.ReplicaURL,
+		MaxReplicaLag:    d.MaxReplicaLag,
+	}
+}
+
+type Log struct {
+	Level string `yaml:"level"`
+	// text или json
+	Format string `yaml:"format"`
+}
+
+type Limits struct {
+	// Предел тела запроса, тело длиннее не дочитывается и запрос отклоняется
+	MaxBodyBytes   int64 `yaml:"max_body_bytes"`
+	MaxHeaderBytes int   `yaml:"max_header_bytes"`
+	// Запросов в секунду с одного адреса, 0 - без ограничения
+	RateLimit int `yaml:"rate_limit"`
+	// Запросов подряд сверх rate_limit, 0 - равно rate_limit
+	RateBurst    int `yaml:"rate_burst"`
+	MaxBatchSize int `yaml:"max_batch_size"`
+	// Наибольшая сумма одной операции по валютам: RUB: "100000.00". Задается
+	// только в файле
+	MaxAmount map[string]string `yaml:"max_amount,omitempty"`
+}
+
+// Operations переводит ограничения операций в минимальные единицы валют.
+func (l Limits) Operations() (wallet.Limits, error) {
+	limits := wallet.Limits{MaxBatchSize: l.MaxBatchSize}
+	if len(l.MaxAmount) == 0 {
+		return limits, nil
+	}
+
+	limits.MaxAmount = make(map[string]int64, len(l.MaxAmount))
+	for currency, amount := range l.MaxAmount {
+		parsed, err := wallet.ParseMoney(amount, currency)
+		if err != nil {
+			return limits, fmt.Errorf("limits.max_amount.%s: %w", currency, err)
+		}
+		limits.MaxAmount[currency] = parsed.Amount
+	}
+
+	return limits, nil
+}
+
+type Features struct {
+	// Применять миграции при старте
+	AutoMigrate bool `yaml:"auto_migrate"`
+	// Режим обслуживания: запросы на изменение отклоняются, чтение работает
+	Maintenance bool `yaml:"maintenance"`
+	// Окно объединения изменений баланса одного кошелька, 0 - без объединения
+	CoalesceWindow time.Duration `yaml:"coalesce_window"`
+}
+
+// Exchange - обмен валют: файл курсов, спред и время жизни котировки. Без
+// файла курсов обмен отключен.
+type Exchange struct {
+	RatesFile string        `yaml:"rates_file"`
+	Spread    string        `yaml:"spread"`
+	QuoteTTL  time.Duration `yaml:"quote_ttl"`
+}
+
+func Default() *Config {
 	return &Config{
-		HTTPAddr: ":" + port,
+		Storage: "postgres",
+		HTTP: HTTP{
+			Port:              3010,
+			ReadHeaderTimeout: 10 * time.Second,
+			ReadTimeout:       30 * time.Second,
+			WriteTimeout:      30 * time.Second,
+			IdleTimeout:       2 * time.Minute,
+			ShutdownTimeout:   5 * time.Second,
+		},
+		Database: Database{
+			ApplicationName: "walet_rest_api",
+			ConnectTimeout:  30 * time.Second,
+			MaxReplicaLag:   5 * time.Second,
+		},
+		Log: Log{
+			Level:  "info",
+			Format: "text",
+		},
+		Limits: Limits{
+			MaxBodyBytes:   1 << 20,
+			MaxHeaderBytes: 1 << 20,
+			MaxBatchSize:   wallet.MaxBatchSize,
+		},
+		Exchange: Exchange{
+			Spread:   "0",
+			QuoteTTL: wallet.DefaultQuoteTTL,
+		},
 	}
 }
 
+type durationSetting struct {
+	key   string
+	value time.Duration
+}
+
+// Validate проверяет все настройки сразу и возвращает все найденные ошибки.
+func (c *Config) Validate() error {
+	var errs []error
+	check := func(ok bool, format string, args ...any) {
+		if !ok {
+			errs = append(errs, fmt.Errorf(format, args...))
+		}
+	}
+
+	check(c.Storage == "postgres" || c.Storage == "memory", "storage must be postgres or memory, got %q", c.Storage)
+
+	check(c.HTTP.Port > 0 && c.HTTP.Port <= 65535, "http.port must be between 1 and 65535, got %d", c.HTTP.Port)
+	for _, timeout := range []durationSetting{
+		{"http.read_header_timeout", c.HTTP.ReadHeaderTimeout},
+		{"http.read_timeout", c.HTTP.ReadTimeout},
+		{"http.write_timeout", c.HTTP.WriteTimeout},
+		{"http.idle_timeout", c.HTTP.IdleTimeout},
+		{"http.shutdown_timeout", c.HTTP.ShutdownTimeout},
+	} {
+		check(timeout.value > 0, "%s must be a positive duration, got %v", timeout.key, timeout.value)
+	}
+	for _, proxy := range c.HTTP.Proxies() {
+		_, _, cidrErr := net.ParseCIDR(proxy)
+		check(net.ParseIP(proxy) != nil || cidrErr == nil, "http.trusted_proxies must list IP addresses or CIDR ranges, got %q", proxy)
+	}
+
+	if c.Storage == "postgres" {
+		check(c.Database.URL != "", "database.url is required with postgres storage")
+	}
+	check(c.Database.MaxConns >= 0, "database.max_conns must not be negative, got %d", c.Database.MaxConns)
+	check(c.Database.MinConns >= 0, "database.min_conns must not be negative, got %d", c.Database.MinConns)
+	if c.Database.MaxConns > 0 {
+		check(c.Database.MinConns <= c.Database.MaxConns, "database.min_conns (%d) must not exceed database.max_conns (%d)", c.Database.MinConns, c.Database.MaxConns)
+	}
+	for _, duration := range []durationSetting{
+		{"database.max_conn_lifetime", c.Database.MaxConnLifetime},
+		{"database.max_conn_idle_time", c.Database.MaxConnIdleTime},
+		{"database.statement_timeout", c.Database.StatementTimeout},
+		{"database.connect_timeout", c.Database.ConnectTimeout},
+		{"database.max_replica_lag", c.Database.MaxReplicaLag},
+	} {
+		check(duration.value >= 0, "%s must not be negative, got %v", duration.key, duration.value)
+	}
+
+	_, err := logrus.ParseLevel(c.Log.Level)
+	check(err == nil, "log.level must be one of panic, fatal, error, warn, info, debug, trace, got %q", c.Log.Level)
+	check(c.Log.Format == "text" || c.Log.Format == "json", "log.format must be text or json, got %q", c.Log.Format)
 
+	check(c.Limits.MaxBodyBytes > 0, "limits.max_body_bytes must be positive, got %d", c.Limits.MaxBodyBytes)
+	check(c.Limits.MaxHeaderBytes > 0, "limits.max_header_bytes must be positive, got %d", c.Limits.MaxHeaderBytes)
+	check(c.Limits.RateLimit >= 0, "limits.rate_limit must not be negative, got %d", c.Limits.RateLimit)
+	check(c.Limits.RateBurst >= 0, "limits.rate_burst must not be negative, got %d", c.Limits.RateBurst)
+	check(c.Limits.MaxBatchSize > 0 && c.Limits.MaxBatchSize <= wallet.MaxBatchSize, "limits.max_batch_size must be between 1 and %d, got %d", wallet.MaxBatchSize, c.Limits.MaxBatchSize)
+	for _, currency := range slices.Sorted(maps.Keys(c.Limits.MaxAmount)) {
+		amount, err := wallet.ParseMoney(c.Limits.MaxAmount[currency], currency)
+		check(err == nil && amount.IsPositive(), "limits.max_amount.%s must be a positive amount in a supported currency, got %q", currency, c.Limits.MaxAmount[currency])
+	}
+
+	check(c.Features.CoalesceWindow >= 0, "features.coalesce_window must not be negative, got %v", c.Features.CoalesceWindow)
+
+	spread, err := wallet.ParseRate(c.Exchange.Spread)
+	check(err == nil && spread.Cmp(big.NewRat(1, 1)) < 0, "exchange.spread must be a decimal from 0 to 1, got %q", c.Exchange.Spread)
+	check(c.Exchange.QuoteTTL > 0, "exchange.quote_ttl must be a positive duration, got %v", c.Exchange.QuoteTTL)
+
+	return errors.Join(errs...)
+}
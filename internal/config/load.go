@@ -0,0 +1,244 @@
+package config
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// setting связывает поле Config с его переменной окружения и флагом. Имя флага
+// совпадает с путем к полю в файле: -http.port, -database.url. Настройки с reload
+// Watcher применяет без перезапуска.
+type setting struct {
+	key    string
+	env    string
+	secret bool
+	reload bool
+	value  any
+}
+
+func (c *Config) settings() []setting {
+	return []setting{
+		{key: "storage", env: "STORAGE", value: &c.Storage},
+
+		{key: "http.port", env: "HTTP_PORT", value: &c.HTTP.Port},
+		{key: "http.read_header_timeout", env: "HTTP_READ_HEADER_TIMEOUT", value: &c.HTTP.ReadHeaderTimeout},
+		{key: "http.read_timeout", env: "HTTP_READ_TIMEOUT", value: &c.HTTP.ReadTimeout},
+		{key: "http.write_timeout", env: "HTTP_WRITE_TIMEOUT", value: &c.HTTP.WriteTimeout},
+		{key: "http.idle_timeout", env: "HTTP_IDLE_TIMEOUT", value: &c.HTTP.IdleTimeout},
+		{key: "http.shutdown_timeout", env: "HTTP_SHUTDOWN_TIMEOUT", value: &c.HTTP.ShutdownTimeout},
+		{key: "http.trusted_proxies", env: "HTTP_TRUSTED_PROXIES", value: &c.HTTP.TrustedProxies},
+
+		{key: "database.url", env: "POSTGRES_DATABASE_URL", secret: true, value: &c.Database.URL},
+		{key: "database.replica_url", env: "POSTGRES_REPLICA_URL", secret: true, value: &c.Database.ReplicaURL},
+		{key: "database.max_conns", env: "POSTGRES_MAX_CONNS", value: &c.Database.MaxConns},
+		{key: "database.min_conns", env: "POSTGRES_MIN_CONNS", value: &c.Database.MinConns},
+		{key: "database.max_conn_lifetime", env: "POSTGRES_MAX_CONN_LIFETIME", value: &c.Database.MaxConnLifetime},
+		{key: "database.max_conn_idle_time", env: "POSTGRES_MAX_CONN_IDLE_TIME", value: &c.Database.MaxConnIdleTime},
+		{key: "database.statement_timeout", env: "POSTGRES_STATEMENT_TIMEOUT", value: &c.Database.StatementTimeout},
+		{key: "database.application_name", env: "POSTGRES_APPLICATION_NAME", value: &c.Database.ApplicationName},
+		{key: "database.connect_timeout", env: "POSTGRES_CONNECT_TIMEOUT", value: &c.Database.ConnectTimeout},
+		{key: "database.max_replica_lag", env: "POSTGRES_MAX_REPLICA_LAG", value: &c.Database.MaxReplicaLag},
+
+		{key: "log.level", env: "LOG_LEVEL", reload: true, value: &c.Log.Level},
+		{key: "log.format", env: "LOG_FORMAT", reload: true, value: &c.Log.Format},
+
+		{key: "limits.max_body_bytes", env: "HTTP_MAX_BODY_BYTES", value: &c.Limits.MaxBodyBytes},
+		{key: "limits.max_header_bytes", env: "HTTP_MAX_HEADER_BYTES", value: &c.Limits.MaxHeaderBytes},
+		{key: "limits.rate_limit", env: "RATE_LIMIT", reload: true, value: &c.Limits.RateLimit},
+		{key: "limits.rate_burst", env: "RATE_LIMIT_BURST", reload: true, value: &c.Limits.RateBurst},
+		{key: "limits.max_batch_size", env: "MAX_BATCH_SIZE", reload: true, value: &c.Limits.MaxBatchSize},
+
+		{key: "features.auto_migrate", env: "AUTO_MIGRATE", value: &c.Features.AutoMigrate},
+		{key: "features.maintenance", env: "MAINTENANCE", reload: true, value: &c.Features.Maintenance},
+		{key: "features.coalesce_window", env: "COALESCE_WINDOW", value: &c.Features.CoalesceWindow},
+
+		{key: "exchange.rates_file", env: "RATES_FILE", value: &c.Exchange.RatesFile},
+		{key: "exchange.spread", env: "EXCHANGE_SPREAD", value: &c.Exchange.Spread},
+		{key: "exchange.quote_ttl", env: "QUOTE_TTL", value: &c.Exchange.QuoteTTL},
+	}
+}
+
+func (s setting) set(raw string) error {
+	switch value := s.value.(type) {
+	case *string:
+		*value = raw
+	case *bool:
+		parsed, err := strconv.ParseBool(raw)
+		if err != nil {
+			return fmt.Errorf("expected true or false, got %q", raw)
+		}
+		*value = parsed
+	case *int:
+		parsed, err := strconv.Atoi(raw)
+		if err != nil {
+			return fmt.Errorf("expected an integer, got %q", raw)
+		}
+		*value = parsed
+	case *int32:
+		parsed, err := strconv.ParseInt(raw, 10, 32)
+		if err != nil {
+			return fmt.Errorf("expected an integer, got %q", raw)
+		}
+		*value = int32(parsed)
+	case *int64:
+		parsed, err := strconv.ParseInt(raw, 10, 64)
+		if err != nil {
+			return fmt.Errorf("expected an integer, got %q", raw)
+		}
+		*value = parsed
+	case *time.Duration:
+		parsed, err := time.ParseDuration(raw)
+		if err != nil {
+			return fmt.Errorf("expected a duration such as 500ms or 30s, got %q", raw)
+		}
+		*value = parsed
+	default:
+		panic(fmt.Sprintf("config: unsupported type %T of %s", s.value, s.key))
+	}
+
+	return nil
+}
+
+const fileEnv = "CONFIG_FILE"
+
+// Load собирает настройки из args (обычно os.Args[1:]) и окружения. Каждый
+// следующий источник перекрывает предыдущий:
+//
+//  1. значения по умолчанию из Default;
+//  2. YAML-файл из флага -config или переменной CONFIG_FILE;
+//  3. переменные окружения;
+//  4. флаги командной строки.
+//
+// Флаги разбираются до первого аргумента, который не флаг, остальные аргументы
+// возвращаются как команда. Ошибки всех источников и проверки Validate
+// возвращаются вместе. Вместе с *Error возвращаются и собранные настройки, чтобы
+// config print мог показать, откуда ошибка; запускать с ними ничего нельзя.
+func Load(args []string) (*Config, []string, error) {
+	cfg := Default()
+	settings := cfg.settings()
+
+	flags := flag.NewFlagSet("wallet-app", flag.ContinueOnError)
+	flags.SetOutput(io.Discard)
+
+	file := flags.String("config", os.Getenv(fileEnv), "path to the YAML config file")
+	overrides := make(map[string]string)
+	for _, s := range settings {
+		flags.Func(s.key, "overrides "+s.env, func(raw string) error {
+			overrides[s.key] = raw
+			return nil
+		})
+	}
+	if err := flags.Parse(args); err != nil {
+		return nil, nil, err
+	}
+
+	var errs []error
+
+	if *file != "" {
+		//Окружение и флаги разбираются и при ошибке в файле, чтобы показать все ошибки сразу
+		if err := cfg.loadFile(*file); err != nil {
+			errs = append(errs, err)
+		} else {
+			cfg.File = *file
+		}
+	}
+
+	for _, s := range settings {
+		if raw, ok := os.LookupEnv(s.env); ok && raw != "" {
+			if err := s.set(raw); err != nil {
+				errs = append(errs, fmt.Errorf("%s: %w", s.env, err))
+			}
+		}
+	}
+
+	for _, s := range settings {
+		if raw, ok := overrides[s.key]; ok {
+			if err := s.set(raw); err != nil {
+				errs = append(errs, fmt.Errorf("-%s: %w", s.key, err))
+			}
+		}
+	}
+
+	//Неразобранные значения остались прежними, проверка их не повторит
+	if err := cfg.Validate(); err != nil {
+		errs = append(errs, err)
+	}
+	if len(errs) > 0 {
+		return cfg, flags.Args(), &Error{Err: errors.Join(errs...)}
+	}
+
+	return cfg, flags.Args(), nil
+}
+
+func (c *Config) loadFile(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("failed to read config file: %w", err)
+	}
+
+	//Неизвестный ключ - скорее всего опечатка, молча его не пропускаем
+	decoder := yaml.NewDecoder(bytes.NewReader(data))
+	decoder.KnownFields(true)
+	if err := decoder.Decode(c); err != nil && !errors.Is(err, io.EOF) {
+		return fmt.Errorf("failed to parse config file %s: %w", path, err)
+	}
+
+	return nil
+}
+
+// Error - настройки, которые не прошли разбор или проверку, по одной на строку.
+type Error struct {
+	Err error
+}
+
+func (e *Error) Error() string {
+	return "invalid configuration:\n  - " + strings.ReplaceAll(e.Err.Error(), "\n", "\n  - ")
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// Print пишет настройки в w в формате файла конфигурации. С redacted пароли в
+// адресах баз заменяются на xxxxx, остальные секреты - целиком.
+func (c *Config) Print(w io.Writer, redacted bool) error {
+	printed := *c
+	if redacted {
+		for _, s := range printed.settings() {
+			if value, ok := s.value.(*string); ok && s.secret && *value != "" {
+				*value = redact(*value)
+			}
+		}
+	}
+
+	encoder := yaml.NewEncoder(w)
+	encoder.SetIndent(2)
+	if err := encoder.Encode(&printed); err != nil {
+		return fmt.Errorf("failed to print config: %w", err)
+	}
+
+	return encoder.Close()
+}
+
+func redact(secret string) string {
+	u, err := url.Parse(secret)
+	if err != nil || u.Scheme == "" || u.Host == "" {
+		return "REDACTED"
+	}
+
+	if query := u.Query(); query.Has("password") {
+		query.Set("password", "xxxxx")
+		u.RawQuery = query.Encode()
+	}
+	return u.Redacted()
+}
@@ -0,0 +1,160 @@
+package config
+
+import (
+	"context"
+	"os"
+	"os/signal"
+	"reflect"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// filePollInterval - как часто проверяется, не изменился ли файл конфигурации.
+const filePollInterval = 5 * time.Second
+
+// Watcher перечитывает конфигурацию по SIGHUP и при изменении файла. Новая
+// конфигурация проходит ту же проверку, что и при старте, и если она неверна,
+// остается прежняя. Без перезапуска действуют только настройки с reload, об
+// изменении остальных Watcher предупреждает в логе, а в Current они остаются
+// прежними до перезапуска.
+type Watcher struct {
+	args     []string
+	logger   *logrus.Logger
+	interval time.Duration
+
+	mu       sync.Mutex
+	current  atomic.Pointer[Config]
+	onChange []func(*Config)
+}
+
+// NewWatcher следит за конфигурацией cfg, загруженной Load из args.
+func NewWatcher(cfg *Config, args []string, logger *logrus.Logger) *Watcher {
+	w := &Watcher{args: args, logger: logger, interval: filePollInterval}
+	w.current.Store(cfg)
+	return w
+}
+
+func (w *Watcher) Current() *Config {
+	return w.current.Load()
+}
+
+// OnChange добавляет получателя новой конфигурации. Получатели вызываются по
+// очереди после каждой успешной перезагрузки.
+func (w *Watcher) OnChange(fn func(*Config)) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	w.onChange = append(w.onChange, fn)
+}
+
+// Run ждет SIGHUP и изменений файла, пока не отменен ctx.
+func (w *Watcher) Run(ctx context.Context) {
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	defer signal.Stop(hup)
+
+	ticker := time.NewTicker(w.interval)
+	defer ticker.Stop()
+
+	stamp := statFile(w.Current().File)
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-hup:
+			w.logger.Info("Received SIGHUP, reloading configuration")
+			w.Reload()
+		case <-ticker.C:
+			file := w.Current().File
+			if file == "" {
+				continue
+			}
+
+			//Файл мог пропасть на время сохранения, тогда перезагрузка не пройдет и
+			//повторится, когда он появится
+			next := statFile(file)
+			if next == stamp {
+				continue
+			}
+			stamp = next
+
+			w.logger.Infof("Config file %s changed, reloading configuration", file)
+			w.Reload()
+		}
+	}
+}
+
+// Reload перечитывает конфигурацию и, если она верна, заменяет текущую и
+// передает получателям. При ошибке текущая конфигурация остается.
+func (w *Watcher) Reload() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	next, _, err := Load(w.args)
+	if err != nil {
+		w.logger.WithError(err).Error("Failed to reload configuration, keeping the current one")
+		return err
+	}
+
+	current := w.current.Load()
+	if keys := restartRequired(current, next); len(keys) > 0 {
+		w.logger.Warnf("Changes to %s take effect after restart", strings.Join(keys, ", "))
+	}
+	//Current должен показывать то, с чем сервис работает, а не то, что в файле
+	keepRunning(current, next)
+
+	w.current.Store(next)
+	for _, fn := range w.onChange {
+		fn(next)
+	}
+
+	w.logger.Info("Configuration reloaded")
+	return nil
+}
+
+// restartRequired возвращает измененные настройки, которые не применяются на ходу.
+func restartRequired(current, next *Config) []string {
+	var keys []string
+
+	nextSettings := next.settings()
+	for i, s := range current.settings() {
+		if !s.reload && !reflect.DeepEqual(s.value, nextSettings[i].value) {
+			keys = append(keys, s.key)
+		}
+	}
+
+	return keys
+}
+
+// keepRunning переносит в next значения current для настроек, которые не
+// применяются на ходу.
+func keepRunning(current, next *Config) {
+	nextSettings := next.settings()
+	for i, s := range current.settings() {
+		if !s.reload {
+			reflect.ValueOf(nextSettings[i].value).Elem().Set(reflect.ValueOf(s.value).Elem())
+		}
+	}
+}
+
+type fileStamp struct {
+	modTime time.Time
+	size    int64
+}
+
+func statFile(path string) fileStamp {
+	if path == "" {
+		return fileStamp{}
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		return fileStamp{}
+	}
+	return fileStamp{modTime: info.ModTime(), size: info.Size()}
+}
@@ -0,0 +1,118 @@
+package config
+
+import (
+	"context"
+	"io"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+func newTestWatcher(t *testing.T, path string) *Watcher {
+	t.Helper()
+
+	cfg, _, err := Load([]string{"-config", path})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	logger := logrus.New()
+	logger.SetOutput(io.Discard)
+	return NewWatcher(cfg, []string{"-config", path}, logger)
+}
+
+func TestWatcher_ReloadsOnFileChange(t *testing.T) {
+	clearEnv(t)
+	path := writeFile(t, "storage: memory\n")
+	w := newTestWatcher(t, path)
+	w.interval = 10 * time.Millisecond
+
+	changed := make(chan *Config, 1)
+	w.OnChange(func(cfg *Config) { changed <- cfg })
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go w.Run(ctx)
+
+	//Даем Run запомнить исходный файл
+	time.Sleep(50 * time.Millisecond)
+	content := "storage: memory\nlimits:\n  rate_limit: 5\n  max_amount:\n    RUB: \"1000.00\"\nfeatures:\n  maintenance: true\n"
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatalf("failed to write config: %v", err)
+	}
+
+	select {
+	case cfg := <-changed:
+		if cfg.Limits.RateLimit != 5 || !cfg.Features.Maintenance || cfg.Limits.MaxAmount["RUB"] != "1000.00" {
+			t.Errorf("expected new settings, got %+v", cfg)
+		}
+		if w.Current() != cfg {
+			t.Errorf("expected current config to be swapped")
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatalf("expected config to be reloaded after the file changed")
+	}
+}
+
+func TestWatcher_KeepsCurrentOnInvalidConfig(t *testing.T) {
+	clearEnv(t)
+	path := writeFile(t, "storage: memory\n")
+	w := newTestWatcher(t, path)
+	current := w.Current()
+
+	w.OnChange(func(cfg *Config) { t.Errorf("unexpected reload to %+v", cfg) })
+
+	for _, content := range []string{
+		"storage: memory\nlog:\n  level: loud\n",
+		"storage: memory\nlimits:\n  max_amount:\n    RUB: \"-1\"\n",
+		"storage: [memory\n",
+	} {
+		if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+			t.Fatalf("failed to write config: %v", err)
+		}
+		if err := w.Reload(); err == nil {
+			t.Errorf("expected error for %q", content)
+		}
+		if w.Current() != current {
+			t.Errorf("expected current config to stay after %q", content)
+		}
+	}
+}
+
+func TestWatcher_KeepsRestartOnlySettings(t *testing.T) {
+	clearEnv(t)
+	path := writeFile(t, "storage: memory\nhttp:\n  port: 8000\n")
+	w := newTestWatcher(t, path)
+
+	content := "storage: memory\nhttp:\n  port: 9000\nlimits:\n  rate_limit: 5\n"
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatalf("failed to write config: %v", err)
+	}
+	if err := w.Reload(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	//Порт меняется только после перезапуска, лимит - сразу
+	cfg := w.Current()
+	if cfg.HTTP.Port != 8000 {
+		t.Errorf("expected running port 8000 to stay, got %d", cfg.HTTP.Port)
+	}
+	if cfg.Limits.RateLimit != 5 {
+		t.Errorf("expected rate limit to be reloaded, got %d", cfg.Limits.RateLimit)
+	}
+}
+
+func TestRestartRequired(t *testing.T) {
+	current := Default()
+	next := Default()
+	next.HTTP.Port = 8080
+	next.Log.Level = "debug"
+	next.Limits.RateLimit = 10
+
+	keys := restartRequired(current, next)
+	if len(keys) != 1 || keys[0] != "http.port" {
+		t.Errorf("expected only http.port to require restart, got %v", keys)
+	}
+}
@@ -0,0 +1,134 @@
+// Package coalesce объединяет одновременные изменения баланса одного кошелька
+// в пакеты, чтобы горячий кошелек не упирался в блокировку строки на каждый запрос.
+package coalesce
+
+import (
+	"context"
+	"slices"
+	"sync"
+	"time"
+
+	"walet_rest_api/internal/domain/wallet"
+
+	"github.com/google/uuid"
+)
+
+// Storage собирает изменения баланса одного кошелька за окно window и применяет
+// их одним ChangeBalanceBatch в порядке поступления. Каждый вызывающий получает
+// итог своей операции, отказ одной операции не влияет на остальные. Операции с
+// ключом идемпотентности и все остальные методы идут в хранилище напрямую.
+type Storage struct {
+	wallet.Storage
+	window   time.Duration
+	maxBatch int
+
+	mu      sync.Mutex
+	pending map[uuid.UUID]*group
+}
+
+type group struct {
+	operations []*wallet.WalletChangeBalanceDTO
+	results    []chan wallet.BatchResult
+}
+
+func New(storage wallet.Storage, window time.Duration) *Storage {
+	return &Storage{
+		Storage:  storage,
+		window:   window,
+		maxBatch: wallet.MaxBatchSize,
+		pending:  make(map[uuid.UUID]*group),
+	}
+}
+
+// ChangeBalance ждет окно и применяет операцию вместе с остальными операциями
+// кошелька. Если ctx отменен до отправки пакета, операция убирается из него и
+// не применяется. После отправки вызывающий ждет настоящий итог, чтобы ошибка
+// не вернулась вместо уже проведенной операции.
+func (s *Storage) ChangeBalance(ctx context.Context, dto *wallet.WalletChangeBalanceDTO) (*wallet.Wallet, error) {
+	if dto.Idempotency != nil {
+		return s.Storage.ChangeBalance(ctx, dto)
+	}
+
+	done := make(chan wallet.BatchResult, 1)
+
+	s.mu.Lock()
+	g, ok := s.pending[dto.ID]
+	if !ok {
+		g = &group{}
+		s.pending[dto.ID] = g
+		time.AfterFunc(s.window, func() { s.flush(dto.ID, g) })
+	}
+	g.operations = append(g.operations, dto)
+	g.results = append(g.results, done)
+	//Полный пакет уходит сразу, не дожидаясь окна
+	full := len(g.operations) >= s.maxBatch
+	if full {
+		delete(s.pending, dto.ID)
+	}
+	s.mu.Unlock()
+
+	if full {
+		go s.apply(g)
+	}
+
+	select {
+	case result := <-done:
+		return result.Wallet, result.Err
+	case <-ctx.Done():
+	}
+
+	if s.withdraw(dto.ID, g, done) {
+		return nil, ctx.Err()
+	}
+	result := <-done
+	return result.Wallet, result.Err
+}
+
+// withdraw убирает операцию из еще не отправленного пакета. false - пакет уже
+// применяется.
+func (s *Storage) withdraw(walletID uuid.UUID, g *group, done chan wallet.BatchResult) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.pending[walletID] != g {
+		return false
+	}
+
+	for i, result := range g.results {
+		if result == done {
+			g.operations = slices.Delete(g.operations, i, i+1)
+			g.results = slices.Delete(g.results, i, i+1)
+			break
+		}
+	}
+	//Пустой пакет отправлять незачем, flush его пропустит
+	if len(g.operations) == 0 {
+		delete(s.pending, walletID)
+	}
+	return true
+}
+
+func (s *Storage) flush(walletID uuid.UUID, g *group) {
+	s.mu.Lock()
+	//Пакет мог уйти раньше окна, когда набрался полностью
+	if s.pending[walletID] != g {
+		s.mu.Unlock()
+		return
+	}
+	delete(s.pending, walletID)
+	s.mu.Unlock()
+
+	s.apply(g)
+}
+
+func (s *Storage) apply(g *group) {
+	results, err := s.Storage.ChangeBalanceBatch(context.Background(), &wallet.BatchDTO{Operations: g.operations})
+
+	for i, done := range g.results {
+		if err != nil {
+			done <- wallet.BatchResult{Err: err}
+			continue
+		}
+		done <- results[i]
+	}
+}
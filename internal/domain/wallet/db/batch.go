@@ -0,0 +1,204 @@
+package db
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+
+	"walet_rest_api/internal/domain/wallet"
+	"walet_rest_api/pkg/client/postgres"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+)
+
+// batchChangeQuery - изменение баланса целиком одним запросом, чтобы пакет уходил
+// в базу за один проход. $1 - сумма со знаком операции. Баланс, версия, история и
+// проводки по CASH меняются только вместе с updated, по остальным колонкам
+// результата понятно, почему операция не прошла.
+const batchChangeQuery = `WITH locked AS (
+	SELECT id, version FROM wallets WHERE id = $2 FOR NO KEY UPDATE
+), updated AS (
+	UPDATE wallet_balances b SET balance = b.balance + $1
+	FROM locked
+	WHERE b.wallet_id = locked.id AND b.currency = $3
+		AND ($1 > 0 OR b.balance - b.held >= -$1)
+		AND ($5::bigint IS NULL OR locked.version = $5)
+	RETURNING b.wallet_id, b.balance
+), bumped AS (
+	UPDATE wallets w SET version = w.version + 1 FROM updated WHERE w.id = updated.wallet_id RETURNING w.version
+), entry AS (
+	INSERT INTO journal_entries (id, operation_type) SELECT $4::uuid, $6::text FROM updated
+), logged AS (
+	INSERT INTO wallet_transactions (wallet_id, operation_type, amount, currency, balance_after, entry_id)
+	SELECT wallet_id, $6, abs($1), $3, balance, $4 FROM updated
+), posted AS (
+	INSERT INTO postings (entry_id, wallet_id, account, currency, amount)
+	SELECT $4, wallet_id, NULL, $3, $1 FROM updated
+	UNION ALL
+	SELECT $4, NULL, 'CASH', $3, -$1 FROM updated
+)
+SELECT (SELECT version FROM locked), (SELECT version FROM bumped), (SELECT balance FROM updated),
+	EXISTS (SELECT 1 FROM wallet_balances WHERE wallet_id = $2 AND currency = $3)`
+
+func (w *WalletDB) ChangeBalanceBatch(ctx context.Context, dto *wallet.BatchDTO) ([]wallet.BatchResult, error) {
+	results := make([]wallet.BatchResult, len(dto.Operations))
+	pending := make([]int, 0, len(dto.Operations))
+
+	for i, op := range dto.Operations {
+		if op.OperationType != "DEPOSIT" && op.OperationType != "WITHDRAW" {
+			results[i].Err = fmt.Errorf("%w: %s, expected DEPOSIT or WITHDRAW", wallet.ErrInvalidOperation, op.OperationType)
+			continue
+		}
+		pending = append(pending, i)
+	}
+
+	if len(pending) < len(results) && dto.Atomic {
+		wallet.AbortBatch(results)
+		return results, nil
+	}
+
+	//Горячие кошельки неатомарного пакета идут через слоты по одной операции:
+	//общий путь перенес бы слоты в основной баланс и снова собрал бы всех писателей
+	//на строке кошелька. Операции кошелька остаются в порядке пакета
+	if !dto.Atomic {
+		regular := pending[:0]
+		for _, i := range pending {
+			op := dto.Operations[i]
+			if !w.isSharded(op.ID) {
+				regular = append(regular, i)
+				continue
+			}
+			updated, err := w.ChangeBalance(ctx, op)
+			results[i] = wallet.BatchResult{Wallet: updated, Err: err}
+		}
+		pending = regular
+	}
+
+	//Ошибка запроса обрывает всю транзакцию. Атомарный пакет на этом заканчивается,
+	//в неатомарном операция с ошибкой исключается и пакет повторяется без нее
+	for len(pending) > 0 {
+		failed, err := w.applyBatch(ctx, dto, pending, results)
+		if err != nil {
+			return nil, err
+		}
+		if failed < 0 {
+			break
+		}
+		if dto.Atomic {
+			wallet.AbortBatch(results)
+			break
+		}
+		pending = slices.DeleteFunc(pending, func(i int) bool { return i == failed })
+	}
+
+	return results, nil
+}
+
+// errBatchRollback откатывает транзакцию пакета в WithTx, когда итоги уже
+// разложены по results и ошибкой для вызывающего это не является.
+var errBatchRollback = errors.New("batch rolled back")
+
+// applyBatch применяет операции pending одной транзакцией и раскладывает итоги
+// по results. Возвращает индекс операции, на которой оборвалась транзакция, или -1.
+func (w *WalletDB) applyBatch(ctx context.Context, dto *wallet.BatchDTO, pending []int, results []wallet.BatchResult) (int, error) {
+	//Кошельки пакета блокируются заранее в порядке id, как в lockWallets, иначе
+	//два пакета с одними кошельками в разном порядке взаимно заблокируются. Слоты
+	//горячих кошельков переносятся в основные балансы, как в lockWallet
+	walletIDs := make([]uuid.UUID, 0, len(pending))
+	for _, i := range pending {
+		walletIDs = append(walletIDs, dto.Operations[i].ID)
+	}
+	slices.SortFunc(walletIDs, func(a, b uuid.UUID) int { return bytes.Compare(a[:], b[:]) })
+	lockIDs := walletIDStrings(slices.Compact(walletIDs))
+
+	failedAt := -1
+	err := postgres.WithTx(ctx, w.client, pgx.TxOptions{}, func(tx pgx.Tx) error {
+		//При повторе транзакции итоги прошлой попытки недействительны
+		failedAt = -1
+		for _, i := range pending {
+			results[i] = wallet.BatchResult{}
+		}
+
+		batch := &pgx.Batch{}
+		batch.Queue(`SELECT id FROM wallets WHERE id = ANY($1::uuid[]) ORDER BY id FOR NO KEY UPDATE`, lockIDs)
+		batch.Queue(consolidateQuery, lockIDs)
+		for _, i := range pending {
+			op := dto.Operations[i]
+			amount := op.Amount.Amount
+			if op.OperationType == "WITHDRAW" {
+				amount = -amount
+			}
+			batch.Queue(batchChangeQuery, amount, op.ID, op.Amount.Currency, uuid.New(), op.ExpectedVersion, op.OperationType)
+		}
+		w.logger.Info(fmt.Sprintf("SQL query: %s, batch of %d operations, atomic: %t", batchChangeQuery, len(pending), dto.Atomic))
+
+		br := tx.SendBatch(ctx, batch)
+		defer br.Close()
+
+		if _, err := br.Exec(); err != nil {
+			return fmt.Errorf("failed to lock batch wallets: %w", err)
+		}
+		if _, err := br.Exec(); err != nil {
+			return fmt.Errorf("failed to consolidate balance slots: %w", err)
+		}
+
+		failed := false
+		for _, i := range pending {
+			op := dto.Operations[i]
+
+			var locked, version, balance *int64
+			var hasBalance bool
+			if err := br.QueryRow().Scan(&locked, &version, &balance, &hasBalance); err != nil {
+				if isPgError(err, numericOutOfRangeCode) {
+					results[i] = wallet.BatchResult{Err: fmt.Errorf("%w: balance of wallet %v would overflow", wallet.ErrInvalidAmount, op.ID)}
+					failedAt = i
+					return errBatchRollback
+				}
+				return fmt.Errorf("failed to apply batch operation: %w", err)
+			}
+
+			results[i] = batchResult(op, locked, version, balance, hasBalance)
+			if results[i].Err != nil {
+				failed = true
+			}
+		}
+
+		if err := br.Close(); err != nil {
+			return fmt.Errorf("failed to apply batch: %w", err)
+		}
+
+		if failed && dto.Atomic {
+			return errBatchRollback
+		}
+		return nil
+	})
+	if errors.Is(err, errBatchRollback) {
+		if failedAt < 0 {
+			wallet.AbortBatch(results)
+		}
+		return failedAt, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	return -1, nil
+}
+
+func batchResult(op *wallet.WalletChangeBalanceDTO, locked, version, balance *int64, hasBalance bool) wallet.BatchResult {
+	switch {
+	case locked == nil:
+		return wallet.BatchResult{Err: &wallet.WalletError{WalletID: op.ID, Err: wallet.ErrWalletNotFound}}
+	case balance != nil:
+		return wallet.BatchResult{Wallet: &wallet.Wallet{ID: op.ID, Version: *version, Balance: wallet.NewMoney(*balance, op.Amount.Currency)}}
+	case op.ExpectedVersion != nil && *op.ExpectedVersion != *locked:
+		return wallet.BatchResult{Err: fmt.Errorf("%w: wallet %v is at version %d, expected %d", wallet.ErrVersionMismatch, op.ID, *locked, *op.ExpectedVersion)}
+	case !hasBalance:
+		return wallet.BatchResult{Err: currencyMismatch(op.ID, op.Amount.Currency)}
+	default:
+		return wallet.BatchResult{Err: &wallet.WalletError{WalletID: op.ID, Err: wallet.ErrInsufficientFunds}}
+	}
+}
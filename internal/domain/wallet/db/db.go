@@ -1,89 +1,358 @@
 package db
 
 import (
+	"bytes"
 	"context"
 	"errors"
 	"fmt"
+	"slices"
+	"sync/atomic"
 
 	"walet_rest_api/internal/domain/wallet"
 	"walet_rest_api/pkg/client/postgres"
 
 	"github.com/google/uuid"
 	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
 	"github.com/sirupsen/logrus"
 )
 
+const (
+	uniqueViolationCode     = "23505"
+	foreignKeyViolationCode = "23503"
+	numericOutOfRangeCode   = "22003"
+)
+
 type WalletDB struct {
-	client postgres.Client
+	client postgres.Pool
 	logger *logrus.Logger
+	// sharded - кошельки со слотами, список обновляет ConsolidateSlots
+	sharded atomic.Pointer[map[uuid.UUID]struct{}]
 }
 
-func NewWalletDB(client postgres.Client, logger *logrus.Logger) wallet.Storage {
+func NewWalletDB(client postgres.Pool, logger *logrus.Logger) wallet.Storage {
 	return &WalletDB{client: client, logger: logger}
 }
 
+// replicaReader - клиент с репликой для чтений, например postgres.Router.
+type replicaReader interface {
+	Read(ctx context.Context, fn func(client postgres.Client) error) error
+}
+
+// read выполняет чтение на реплике, если она есть и ctx не требует строгой
+// согласованности, иначе на основной базе.
+func (w *WalletDB) read(ctx context.Context, fn func(client postgres.Client) error) error {
+	if reader, ok := w.client.(replicaReader); ok && !wallet.StrongConsistency(ctx) {
+		return reader.Read(ctx, fn)
+	}
+
+	return fn(w.client)
+}
+
+func (w *WalletDB) CreateWallet(ctx context.Context, dto *wallet.WalletCreateDTO) (*wallet.Wallet, error) {
+	//Баланс в основной валюте открывается вместе с кошельком, начальный баланс
+	//фиксируется в истории как DEPOSIT тем же запросом
+	query := `WITH created AS (
+		INSERT INTO wallets (id, currency) VALUES ($1, $3) RETURNING id, currency, version
+	), opened AS (
+		INSERT INTO wallet_balances (wallet_id, currency, balance)
+		SELECT id, currency, $2 FROM created RETURNING wallet_id, balance
+	), logged AS (
+		INSERT INTO wallet_transactions (wallet_id, operation_type, amount, currency, balance_after, entry_id)
+		SELECT wallet_id, 'DEPOSIT', balance, $3, balance, $4 FROM opened WHERE balance > 0
+	)
+	SELECT opened.wallet_id, opened.balance, created.version FROM opened, created`
+	w.logger.Info(fmt.Sprintf("SQL query: %s, balance: %s %s, walletID: %v", query, dto.Balance, dto.Balance.Currency, dto.ID))
+
+	var created wallet.Wallet
+
+	err := postgres.WithTx(ctx, w.client, pgx.TxOptions{}, func(tx pgx.Tx) error {
+		entryID := uuid.New()
+		created = wallet.Wallet{Currency: dto.Balance.Currency, Balance: wallet.Money{Currency: dto.Balance.Currency}}
+
+		var entry *uuid.UUID
+		if dto.Balance.IsPositive() {
+			entry = &entryID
+		}
+
+		if err := tx.QueryRow(ctx, query, dto.ID, dto.Balance.Amount, dto.Balance.Currency, entry).Scan(&created.ID, &created.Balance.Amount, &created.Version); err != nil {
+			if isPgError(err, uniqueViolationCode) {
+				return &wallet.WalletError{WalletID: dto.ID, Err: wallet.ErrWalletAlreadyExists}
+			}
+			return fmt.Errorf("failed to create wallet: %w", err)
+		}
+
+		if entry == nil {
+			return nil
+		}
+		return w.postEntry(ctx, tx, entryID, "DEPOSIT",
+			walletPosting(dto.ID, dto.Balance.Amount, dto.Balance.Currency),
+			accountPosting(accountCash, -dto.Balance.Amount, dto.Balance.Currency))
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	created.Balances = []wallet.SubBalance{{Balance: created.Balance, Available: created.Balance}}
+
+	return &created, nil
+}
+
+func (w *WalletDB) OpenBalance(ctx context.Context, dto *wallet.OpenBalanceDTO) (*wallet.Wallet, error) {
+	//Новый баланс меняет кошелек, поэтому версия растет и здесь
+	query := `WITH locked AS (
+		UPDATE wallets SET version = version + 1 WHERE id = $1 RETURNING id
+	)
+	INSERT INTO wallet_balances (wallet_id, currency) SELECT id, $2 FROM locked`
+	w.logger.Info(fmt.Sprintf("SQL query: %s, currency: %s, walletID: %v", query, dto.Currency, dto.WalletID))
+
+	err := postgres.WithTx(ctx, w.client, pgx.TxOptions{}, func(tx pgx.Tx) error {
+		tag, err := tx.Exec(ctx, query, dto.WalletID, dto.Currency)
+		if err != nil {
+			if isPgError(err, uniqueViolationCode) {
+				return fmt.Errorf("%w: %s", wallet.ErrBalanceAlreadyExists, dto.Currency)
+			}
+			return fmt.Errorf("failed to open balance: %w", err)
+		}
+		if tag.RowsAffected() == 0 {
+			return &wallet.WalletError{WalletID: dto.WalletID, Err: wallet.ErrWalletNotFound}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	//Реплика могла еще не получить новый баланс
+	return w.GetBalance(wallet.WithStrongConsistency(ctx), dto.WalletID.String())
+}
+
 func (w *WalletDB) ChangeBalance(ctx context.Context, dto *wallet.WalletChangeBalanceDTO) (*wallet.Wallet, error) {
-	//Проверка существования кошелька в базе
-	exists, err := walletExists(ctx, w.client, dto.ID)
+	if dto.Idempotency != nil {
+		return w.changeBalanceIdempotent(ctx, dto)
+	}
+
+	var updated *wallet.Wallet
+
+	err := postgres.WithTx(ctx, w.client, pgx.TxOptions{}, func(tx pgx.Tx) error {
+		//Горячий кошелек без If-Match меняет баланс в слоте, не блокируя кошелек
+		var slotted bool
+		var err error
+		if dto.ExpectedVersion == nil && w.isSharded(dto.ID) {
+			updated, slotted, err = w.changeSlot(ctx, tx, dto)
+			if err != nil || slotted {
+				return err
+			}
+		}
+
+		updated, err = w.changeBalance(ctx, tx, dto)
+		return err
+	})
 	if err != nil {
-		return nil, fmt.Errorf("failed to check wallet existence: %w", err)
+		return nil, err
 	}
-	if !exists {
-		return nil, fmt.Errorf("wallet with id %v not found", dto.ID)
+
+	return updated, nil
+}
+
+func (w *WalletDB) changeBalance(ctx context.Context, client postgres.Client, dto *wallet.WalletChangeBalanceDTO) (*wallet.Wallet, error) {
+	//Блокировка кошелька заодно проверяет его существование и ожидаемую версию
+	version, err := lockWallet(ctx, client, dto.ID)
+	if err != nil {
+		return nil, err
+	}
+	if dto.ExpectedVersion != nil && *dto.ExpectedVersion != version-1 {
+		return nil, fmt.Errorf("%w: wallet %v is at version %d, expected %d", wallet.ErrVersionMismatch, dto.ID, version-1, *dto.ExpectedVersion)
 	}
 
 	var query string
 	var execErr error
 
+	entryID := uuid.New()
+
+	//Обновление баланса и запись в wallet_transactions идут одним запросом,
+	//проводка по счету CASH - следующим в той же транзакции
 	switch dto.OperationType {
 	case "DEPOSIT":
-		query = `UPDATE wallets SET balance = balance + $1 WHERE id = $2 RETURNING id, balance`
-		w.logger.Info(fmt.Sprintf("SQL query: %s, amount: %d, walletID: %v", query, dto.Balance, dto.ID))
+		query = `WITH updated AS (
+			UPDATE wallet_balances SET balance = balance + $1 WHERE wallet_id = $2 AND currency = $3 RETURNING wallet_id, balance
+		), logged AS (
+			INSERT INTO wallet_transactions (wallet_id, operation_type, amount, currency, balance_after, entry_id)
+			SELECT wallet_id, 'DEPOSIT', $1, $3, balance, $4 FROM updated
+		)
+		SELECT wallet_id, balance FROM updated`
+		w.logger.Info(fmt.Sprintf("SQL query: %s, amount: %s %s, walletID: %v", query, dto.Amount, dto.Amount.Currency, dto.ID))
 
-		var wallet wallet.Wallet
-		
-		execErr = w.client.QueryRow(ctx, query, dto.Balance, dto.ID).Scan(&wallet.ID, &wallet.Balance)
+		updated := wallet.Wallet{Version: version, Balance: wallet.Money{Currency: dto.Amount.Currency}}
+
+		execErr = client.QueryRow(ctx, query, dto.Amount.Amount, dto.ID, dto.Amount.Currency, entryID).Scan(&updated.ID, &updated.Balance.Amount)
 		if execErr != nil {
+			//Кошелек существует, значит нет баланса в валюте операции
 			if errors.Is(execErr, pgx.ErrNoRows) {
-				return nil, fmt.Errorf("wallet with id %v not found", dto.ID)
+				return nil, currencyMismatch(dto.ID, dto.Amount.Currency)
+			}
+			if isPgError(execErr, numericOutOfRangeCode) {
+				return nil, fmt.Errorf("%w: balance of wallet %v would overflow", wallet.ErrInvalidAmount, dto.ID)
 			}
 			return nil, fmt.Errorf("failed to deposit balance: %w", execErr)
 		}
 
-		return &wallet, nil
+		err := w.postEntry(ctx, client, entryID, "DEPOSIT",
+			walletPosting(dto.ID, dto.Amount.Amount, dto.Amount.Currency),
+			accountPosting(accountCash, -dto.Amount.Amount, dto.Amount.Currency))
+		if err != nil {
+			return nil, err
+		}
+
+		return &updated, nil
 
 	case "WITHDRAW":
-		query = `UPDATE wallets SET balance = balance - $1 WHERE id = $2 AND balance >= $1 RETURNING id, balance`
-		w.logger.Info(fmt.Sprintf("SQL query: %s, amount: %d, walletID: %v", query, dto.Balance, dto.ID))
+		//Списать можно только доступный баланс: зарезервированное холдами не трогаем
+		query = `WITH updated AS (
+			UPDATE wallet_balances SET balance = balance - $1 WHERE wallet_id = $2 AND currency = $3 AND balance - held >= $1 RETURNING wallet_id, balance
+		), logged AS (
+			INSERT INTO wallet_transactions (wallet_id, operation_type, amount, currency, balance_after, entry_id)
+			SELECT wallet_id, 'WITHDRAW', $1, $3, balance, $4 FROM updated
+		)
+		SELECT wallet_id, balance FROM updated`
+		w.logger.Info(fmt.Sprintf("SQL query: %s, amount: %s %s, walletID: %v", query, dto.Amount, dto.Amount.Currency, dto.ID))
+
+		updated := wallet.Wallet{Version: version, Balance: wallet.Money{Currency: dto.Amount.Currency}}
 
-		var wallet wallet.Wallet
-		
-		execErr = w.client.QueryRow(ctx, query, dto.Balance, dto.ID).Scan(&wallet.ID, &wallet.Balance)
+		execErr = client.QueryRow(ctx, query, dto.Amount.Amount, dto.ID, dto.Amount.Currency, entryID).Scan(&updated.ID, &updated.Balance.Amount)
 		if execErr != nil {
 			if errors.Is(execErr, pgx.ErrNoRows) {
-				return nil, fmt.Errorf("insufficient balance for withdrawal")
+				held, err := balanceExists(ctx, client, dto.ID, dto.Amount.Currency)
+				if err != nil {
+					return nil, fmt.Errorf("failed to check balance existence: %w", err)
+				}
+				if !held {
+					return nil, currencyMismatch(dto.ID, dto.Amount.Currency)
+				}
+				return nil, &wallet.WalletError{WalletID: dto.ID, Err: wallet.ErrInsufficientFunds}
 			}
 			return nil, fmt.Errorf("failed to withdraw balance: %w", execErr)
 		}
 
-		return &wallet, nil
+		err := w.postEntry(ctx, client, entryID, "WITHDRAW",
+			walletPosting(dto.ID, -dto.Amount.Amount, dto.Amount.Currency),
+			accountPosting(accountCash, dto.Amount.Amount, dto.Amount.Currency))
+		if err != nil {
+			return nil, err
+		}
+
+		return &updated, nil
 
 	default:
-		return nil, fmt.Errorf("invalid operation type: %s. Expected DEPOSIT or WITHDRAW", dto.OperationType)
+		return nil, fmt.Errorf("%w: %s, expected DEPOSIT or WITHDRAW", wallet.ErrInvalidOperation, dto.OperationType)
+	}
+}
+
+// GetBalance возвращает кошелек со всеми балансами. Balance и Available - балансы
+// в основной валюте.
+func (w *WalletDB) GetBalance(ctx context.Context, walletID string) (*wallet.Wallet, error) {
+	var found *wallet.Wallet
+	err := w.read(ctx, func(client postgres.Client) error {
+		var err error
+		found, err = w.getBalance(ctx, client, walletID)
+		return err
+	})
+	if err != nil {
+		return nil, err
 	}
+
+	return found, nil
 }
 
-func (w *WalletDB) GetBalance(ctx context.Context, walletID string) (int, error) {
-	query := `SELECT balance FROM wallets WHERE id = $1`
+func (w *WalletDB) getBalance(ctx context.Context, client postgres.Client, walletID string) (*wallet.Wallet, error) {
+	//Баланс и версия горячего кошелька складываются с его слотами
+	query := `SELECT w.id, w.currency, b.currency,
+			(b.balance + COALESCE(s.balance, 0))::bigint,
+			(b.balance + COALESCE(s.balance, 0) - b.held)::bigint,
+			(w.version + COALESCE((SELECT SUM(changes) FROM wallet_balance_slots WHERE wallet_id = w.id), 0))::bigint
+		FROM wallets w
+		JOIN wallet_balances b ON b.wallet_id = w.id
+		LEFT JOIN (
+			SELECT currency, SUM(balance) AS balance FROM wallet_balance_slots WHERE wallet_id = $1 GROUP BY currency
+		) s ON s.currency = b.currency
+		WHERE w.id = $1
+		ORDER BY b.currency`
 
 	w.logger.Info(fmt.Sprintf("SQL query: %s", query))
 
-	var balance int
-	if err := w.client.QueryRow(ctx, query, walletID).Scan(&balance); err != nil {
-		return 0, err
+	rows, err := client.Query(ctx, query, walletID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get balance: %w", err)
 	}
+	defer rows.Close()
 
-	return balance, nil
+	var found wallet.Wallet
+	for rows.Next() {
+		var sub wallet.SubBalance
+		if err := rows.Scan(&found.ID, &found.Currency, &sub.Balance.Currency, &sub.Balance.Amount, &sub.Available.Amount, &found.Version); err != nil {
+			return nil, fmt.Errorf("failed to scan balance: %w", err)
+		}
+		sub.Available.Currency = sub.Balance.Currency
+		if sub.Balance.Currency == found.Currency {
+			found.Balance = sub.Balance
+			found.Available = &sub.Available
+		}
+		found.Balances = append(found.Balances, sub)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to get balance: %w", err)
+	}
+
+	if len(found.Balances) == 0 {
+		return nil, fmt.Errorf("%w: %s", wallet.ErrWalletNotFound, walletID)
+	}
+
+	return &found, nil
+}
+
+// lockWallet блокирует кошелек до конца транзакции и увеличивает его версию.
+// Операции блокируют кошелек раньше его балансов, несколько кошельков - в
+// порядке id через lockWallets. Слоты кошелька переносятся в основной баланс,
+// так что дальше операция работает только с wallet_balances.
+func lockWallet(ctx context.Context, client postgres.Client, walletID uuid.UUID) (int64, error) {
+	query := `UPDATE wallets SET version = version + 1 WHERE id = $1
+		RETURNING version, EXISTS (SELECT 1 FROM wallet_balance_slots WHERE wallet_id = $1 AND (balance <> 0 OR changes <> 0))`
+
+	var version int64
+	var slotted bool
+	if err := client.QueryRow(ctx, query, walletID).Scan(&version, &slotted); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return 0, &wallet.WalletError{WalletID: walletID, Err: wallet.ErrWalletNotFound}
+		}
+		return 0, fmt.Errorf("failed to lock wallet: %w", err)
+	}
+
+	if slotted {
+		folded, err := consolidateSlots(ctx, client, walletID)
+		if err != nil {
+			return 0, err
+		}
+		version += folded
+	}
+
+	return version, nil
+}
+
+// lockWallets блокирует кошельки в порядке id и возвращает их новые версии.
+func lockWallets(ctx context.Context, client postgres.Client, walletIDs ...uuid.UUID) (map[uuid.UUID]int64, error) {
+	sorted := slices.Clone(walletIDs)
+	slices.SortFunc(sorted, func(a, b uuid.UUID) int { return bytes.Compare(a[:], b[:]) })
+
+	versions := make(map[uuid.UUID]int64, len(sorted))
+	for _, id := range slices.Compact(sorted) {
+		version, err := lockWallet(ctx, client, id)
+		if err != nil {
+			return nil, err
+		}
+		versions[id] = version
+	}
+
+	return versions, nil
 }
 
 func walletExists(ctx context.Context, client postgres.Client, walletID uuid.UUID) (bool, error) {
@@ -96,3 +365,23 @@ func walletExists(ctx context.Context, client postgres.Client, walletID uuid.UUI
 
 	return exists, nil
 }
+
+func balanceExists(ctx context.Context, client postgres.Client, walletID uuid.UUID, currency string) (bool, error) {
+	balanceExistsQuery := `SELECT EXISTS(SELECT 1 FROM wallet_balances WHERE wallet_id = $1 AND currency = $2)`
+
+	var exists bool
+	if err := client.QueryRow(ctx, balanceExistsQuery, walletID, currency).Scan(&exists); err != nil {
+		return false, err
+	}
+
+	return exists, nil
+}
+
+func currencyMismatch(walletID uuid.UUID, currency string) error {
+	return fmt.Errorf("%w: wallet %v holds no %s balance", wallet.ErrCurrencyMismatch, walletID, currency)
+}
+
+func isPgError(err error, code string) bool {
+	var pgErr *pgconn.PgError
+	return errors.As(err, &pgErr) && pgErr.Code == code
+}
@@ -0,0 +1,207 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/big"
+
+	"walet_rest_api/internal/domain/wallet"
+	"walet_rest_api/pkg/client/postgres"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+)
+
+func (w *WalletDB) SaveQuote(ctx context.Context, quote *wallet.Quote) error {
+	query := `INSERT INTO exchange_quotes
+		(id, wallet_id, to_wallet_id, debit_amount, debit_currency, credit_amount, credit_currency, rate, spread, source, expires_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11)`
+	w.logger.Info(fmt.Sprintf("SQL query: %s, quoteID: %v", query, quote.ID))
+
+	_, err := w.client.Exec(ctx, query,
+		quote.ID, quote.WalletID, quote.ToWalletID,
+		quote.Debit.Amount, quote.Debit.Currency, quote.Credit.Amount, quote.Credit.Currency,
+		quote.Rate, quote.Spread, quote.Source, quote.ExpiresAt)
+	if err != nil {
+		if isPgError(err, foreignKeyViolationCode) {
+			return fmt.Errorf("%w: quote references unknown wallet", wallet.ErrWalletNotFound)
+		}
+		return fmt.Errorf("failed to save quote: %w", err)
+	}
+
+	return nil
+}
+
+func (w *WalletDB) Exchange(ctx context.Context, dto *wallet.ExchangeDTO) (*wallet.Exchange, error) {
+	var result *wallet.Exchange
+
+	err := postgres.WithTx(ctx, w.client, pgx.TxOptions{}, func(tx pgx.Tx) error {
+		//Котировка помечается использованной в той же транзакции, что и обмен:
+		//при ошибке обмена ее можно исполнить повторно, пока она не истекла
+		claimQuery := `UPDATE exchange_quotes SET used_at = now()
+			WHERE id = $1 AND used_at IS NULL AND expires_at > now()
+			RETURNING id, wallet_id, to_wallet_id, debit_amount, debit_currency, credit_amount, credit_currency,
+				rate::text, spread::text, source, expires_at`
+		w.logger.Info(fmt.Sprintf("SQL query: %s, quoteID: %v", claimQuery, dto.QuoteID))
+
+		var quote wallet.Quote
+		err := tx.QueryRow(ctx, claimQuery, dto.QuoteID).Scan(
+			&quote.ID, &quote.WalletID, &quote.ToWalletID,
+			&quote.Debit.Amount, &quote.Debit.Currency, &quote.Credit.Amount, &quote.Credit.Currency,
+			&quote.Rate, &quote.Spread, &quote.Source, &quote.ExpiresAt)
+		if err != nil {
+			if errors.Is(err, pgx.ErrNoRows) {
+				return w.unusableQuote(ctx, tx, dto.QuoteID)
+			}
+			return fmt.Errorf("failed to claim quote: %w", err)
+		}
+
+		debit := balanceKey{quote.WalletID, quote.Debit.Currency}
+		credit := balanceKey{quote.ToWalletID, quote.Credit.Currency}
+
+		if _, err := lockWallets(ctx, tx, quote.WalletID, quote.ToWalletID); err != nil {
+			return err
+		}
+
+		//Блокируем оба баланса в порядке (wallet_id, currency), как и в переводах
+		lockQuery := `SELECT wallet_id, currency, balance - held FROM wallet_balances
+			WHERE (wallet_id = $1 AND currency = $2) OR (wallet_id = $3 AND currency = $4)
+			ORDER BY wallet_id, currency FOR UPDATE`
+		w.logger.Info(fmt.Sprintf("SQL query: %s, debit: %v, credit: %v", lockQuery, debit, credit))
+
+		rows, err := tx.Query(ctx, lockQuery, debit.walletID, debit.currency, credit.walletID, credit.currency)
+		if err != nil {
+			return fmt.Errorf("failed to lock balances: %w", err)
+		}
+
+		available := make(map[balanceKey]int64, 2)
+		for rows.Next() {
+			var key balanceKey
+			var balance int64
+			if err := rows.Scan(&key.walletID, &key.currency, &balance); err != nil {
+				rows.Close()
+				return fmt.Errorf("failed to scan balance: %w", err)
+			}
+			available[key] = balance
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return fmt.Errorf("failed to lock balances: %w", err)
+		}
+
+		for _, key := range []balanceKey{debit, credit} {
+			if _, ok := available[key]; !ok {
+				return currencyMismatch(key.walletID, key.currency)
+			}
+		}
+
+		if available[debit] < quote.Debit.Amount {
+			return &wallet.WalletError{WalletID: quote.WalletID, Err: wallet.ErrInsufficientFunds}
+		}
+
+		result = &wallet.Exchange{
+			ID:    dto.ID,
+			Quote: quote,
+			From:  wallet.Wallet{Balance: wallet.Money{Currency: quote.Debit.Currency}},
+			To:    wallet.Wallet{Balance: wallet.Money{Currency: quote.Credit.Currency}},
+		}
+
+		debitQuery := `UPDATE wallet_balances SET balance = balance - $1 WHERE wallet_id = $2 AND currency = $3 RETURNING wallet_id, balance`
+		w.logger.Info(fmt.Sprintf("SQL query: %s, amount: %s %s, walletID: %v", debitQuery, quote.Debit, quote.Debit.Currency, quote.WalletID))
+
+		if err := tx.QueryRow(ctx, debitQuery, quote.Debit.Amount, quote.WalletID, quote.Debit.Currency).Scan(&result.From.ID, &result.From.Balance.Amount); err != nil {
+			return fmt.Errorf("failed to debit wallet: %w", err)
+		}
+
+		creditQuery := `UPDATE wallet_balances SET balance = balance + $1 WHERE wallet_id = $2 AND currency = $3 RETURNING wallet_id, balance`
+		w.logger.Info(fmt.Sprintf("SQL query: %s, amount: %s %s, walletID: %v", creditQuery, quote.Credit, quote.Credit.Currency, quote.ToWalletID))
+
+		if err := tx.QueryRow(ctx, creditQuery, quote.Credit.Amount, quote.ToWalletID, quote.Credit.Currency).Scan(&result.To.ID, &result.To.Balance.Amount); err != nil {
+			if isPgError(err, numericOutOfRangeCode) {
+				return fmt.Errorf("%w: balance of wallet %v would overflow", wallet.ErrInvalidAmount, quote.ToWalletID)
+			}
+			return fmt.Errorf("failed to credit wallet: %w", err)
+		}
+
+		//Обмен внутри одного кошелька записывается без контрагента
+		var counterpartyOut, counterpartyIn *uuid.UUID
+		if quote.WalletID != quote.ToWalletID {
+			counterpartyOut, counterpartyIn = &quote.ToWalletID, &quote.WalletID
+		}
+
+		entryID := uuid.New()
+
+		logQuery := `INSERT INTO wallet_transactions
+			(wallet_id, operation_type, amount, currency, balance_after, exchange_id, counterparty_wallet_id, rate, spread, rate_source, entry_id)
+			VALUES ($1, 'EXCHANGE_OUT', $2, $3, $4, $9, $10, $12, $13, $14, $15),
+				($5, 'EXCHANGE_IN', $6, $7, $8, $9, $11, $12, $13, $14, $15)`
+		w.logger.Info(fmt.Sprintf("SQL query: %s, exchangeID: %v", logQuery, dto.ID))
+
+		_, err = tx.Exec(ctx, logQuery,
+			quote.WalletID, quote.Debit.Amount, quote.Debit.Currency, result.From.Balance.Amount,
+			quote.ToWalletID, quote.Credit.Amount, quote.Credit.Currency, result.To.Balance.Amount,
+			dto.ID, counterpartyOut, counterpartyIn, quote.Rate, quote.Spread, quote.Source, entryID)
+		if err != nil {
+			return fmt.Errorf("failed to record exchange: %w", err)
+		}
+
+		//Позиция EXCHANGE получает списанную валюту и отдает зачисляемую по курсу без
+		//спреда, разница между ними и зачислением кошельку - доход FEE
+		gross, err := grossCredit(&quote)
+		if err != nil {
+			return err
+		}
+
+		return w.postEntry(ctx, tx, entryID, "EXCHANGE",
+			walletPosting(quote.WalletID, -quote.Debit.Amount, quote.Debit.Currency),
+			accountPosting(accountExchange, quote.Debit.Amount, quote.Debit.Currency),
+			accountPosting(accountExchange, -gross, quote.Credit.Currency),
+			walletPosting(quote.ToWalletID, quote.Credit.Amount, quote.Credit.Currency),
+			accountPosting(accountFee, gross-quote.Credit.Amount, quote.Credit.Currency))
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+// grossCredit пересчитывает котировку по курсу без спреда. Курс в котировке
+// округлен, поэтому сумма без спреда не бывает меньше зачисления.
+func grossCredit(quote *wallet.Quote) (int64, error) {
+	rate, err := wallet.ParseRate(quote.Rate)
+	if err != nil {
+		return 0, fmt.Errorf("failed to parse quote rate: %w", err)
+	}
+
+	gross, err := wallet.Convert(quote.Debit, quote.Credit.Currency, rate, new(big.Rat))
+	if err != nil {
+		return 0, err
+	}
+
+	return max(gross.Amount, quote.Credit.Amount), nil
+}
+
+type balanceKey struct {
+	walletID uuid.UUID
+	currency string
+}
+
+// unusableQuote объясняет, почему котировку нельзя исполнить.
+func (w *WalletDB) unusableQuote(ctx context.Context, client postgres.Client, quoteID uuid.UUID) error {
+	query := `SELECT used_at IS NOT NULL FROM exchange_quotes WHERE id = $1`
+
+	var used bool
+	if err := client.QueryRow(ctx, query, quoteID).Scan(&used); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return fmt.Errorf("%w: %v", wallet.ErrQuoteNotFound, quoteID)
+		}
+		return fmt.Errorf("failed to load quote: %w", err)
+	}
+
+	if used {
+		return fmt.Errorf("%w: %v", wallet.ErrQuoteAlreadyUsed, quoteID)
+	}
+	return fmt.Errorf("%w: %v", wallet.ErrQuoteExpired, quoteID)
+}
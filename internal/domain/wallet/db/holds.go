@@ -0,0 +1,284 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"walet_rest_api/internal/domain/wallet"
+	"walet_rest_api/pkg/client/postgres"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+)
+
+// Холд резервирует сумму в wallet_balances.held. Доступный баланс - balance - held,
+// его проверяют WITHDRAW, переводы и обмены. Порядок блокировок: сначала холд,
+// потом кошелек, потом баланс. Проводку создает только CAPTURE.
+
+const holdColumns = `id, wallet_id, currency, amount, captured_amount, status, expires_at, created_at`
+
+func (w *WalletDB) AuthorizeHold(ctx context.Context, dto *wallet.HoldDTO) (*wallet.Hold, error) {
+	var hold *wallet.Hold
+
+	err := postgres.WithTx(ctx, w.client, pgx.TxOptions{}, func(tx pgx.Tx) error {
+		if _, err := lockWallet(ctx, tx, dto.WalletID); err != nil {
+			return err
+		}
+
+		query := `WITH reserved AS (
+			UPDATE wallet_balances SET held = held + $3
+			WHERE wallet_id = $2 AND currency = $4 AND balance - held >= $3
+			RETURNING wallet_id, currency
+		)
+		INSERT INTO holds (id, wallet_id, currency, amount, expires_at)
+		SELECT $1, wallet_id, currency, $3, now() + $5::interval FROM reserved
+		RETURNING ` + holdColumns
+		w.logger.Info(fmt.Sprintf("SQL query: %s, amount: %s %s, walletID: %v", query, dto.Amount, dto.Amount.Currency, dto.WalletID))
+
+		var err error
+		hold, err = scanHold(tx.QueryRow(ctx, query, dto.ID, dto.WalletID, dto.Amount.Amount, dto.Amount.Currency, dto.TTL))
+		if err != nil {
+			if !errors.Is(err, pgx.ErrNoRows) {
+				return fmt.Errorf("failed to authorize hold: %w", err)
+			}
+
+			held, err := balanceExists(ctx, tx, dto.WalletID, dto.Amount.Currency)
+			if err != nil {
+				return fmt.Errorf("failed to check balance existence: %w", err)
+			}
+			if !held {
+				return currencyMismatch(dto.WalletID, dto.Amount.Currency)
+			}
+			return &wallet.WalletError{WalletID: dto.WalletID, Err: wallet.ErrInsufficientFunds}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return hold, nil
+}
+
+func (w *WalletDB) CaptureHold(ctx context.Context, dto *wallet.CaptureDTO) (*wallet.Hold, error) {
+	var updated *wallet.Hold
+
+	err := postgres.WithTx(ctx, w.client, pgx.TxOptions{}, func(tx pgx.Tx) error {
+		hold, err := w.lockActiveHold(ctx, tx, dto.HoldID, true)
+		if err != nil {
+			return err
+		}
+		if _, err := lockWallet(ctx, tx, hold.WalletID); err != nil {
+			return err
+		}
+
+		captured := hold.Amount
+		if dto.Amount != nil {
+			if dto.Amount.Currency != hold.Amount.Currency {
+				return fmt.Errorf("%w: hold %v is in %s, capture is in %s", wallet.ErrCurrencyMismatch, hold.ID, hold.Amount.Currency, dto.Amount.Currency)
+			}
+			if dto.Amount.Amount > hold.Amount.Amount {
+				return fmt.Errorf("%w: capture of %s exceeds hold of %s", wallet.ErrInvalidAmount, dto.Amount, hold.Amount)
+			}
+			captured = *dto.Amount
+		}
+
+		//Списываем подтвержденную сумму и снимаем резерв целиком, остаток снова доступен
+		settleQuery := `WITH settled AS (
+			UPDATE wallet_balances SET balance = balance - $1, held = held - $2
+			WHERE wallet_id = $3 AND currency = $4
+			RETURNING wallet_id, balance
+		), logged AS (
+			INSERT INTO wallet_transactions (wallet_id, operation_type, amount, currency, balance_after, hold_id, entry_id)
+			SELECT wallet_id, 'CAPTURE', $1, $4, balance, $5, $6 FROM settled
+		)
+		SELECT balance FROM settled`
+		w.logger.Info(fmt.Sprintf("SQL query: %s, amount: %s %s, holdID: %v", settleQuery, captured, captured.Currency, hold.ID))
+
+		entryID := uuid.New()
+
+		var balance int64
+		if err := tx.QueryRow(ctx, settleQuery, captured.Amount, hold.Amount.Amount, hold.WalletID, hold.Amount.Currency, hold.ID, entryID).Scan(&balance); err != nil {
+			return fmt.Errorf("failed to capture hold: %w", err)
+		}
+
+		err = w.postEntry(ctx, tx, entryID, "CAPTURE",
+			walletPosting(hold.WalletID, -captured.Amount, captured.Currency),
+			accountPosting(accountCash, captured.Amount, captured.Currency))
+		if err != nil {
+			return err
+		}
+
+		updated, err = w.closeHold(ctx, tx, hold.ID, wallet.HoldCaptured, &captured.Amount)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return updated, nil
+}
+
+func (w *WalletDB) VoidHold(ctx context.Context, holdID uuid.UUID) (*wallet.Hold, error) {
+	var updated *wallet.Hold
+
+	err := postgres.WithTx(ctx, w.client, pgx.TxOptions{}, func(tx pgx.Tx) error {
+		//Просроченный, но еще не снятый холд можно отменить: это только освобождает резерв
+		hold, err := w.lockActiveHold(ctx, tx, holdID, false)
+		if err != nil {
+			return err
+		}
+		if _, err := lockWallet(ctx, tx, hold.WalletID); err != nil {
+			return err
+		}
+
+		if err := releaseHeld(ctx, tx, hold); err != nil {
+			return err
+		}
+
+		updated, err = w.closeHold(ctx, tx, hold.ID, wallet.HoldVoided, nil)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return updated, nil
+}
+
+// ExpireHolds снимает холды с истекшим сроком. Блокировки берутся в общем
+// порядке: холды, затем кошельки по id, как в lockWallets, иначе снятие
+// взаимно заблокировалось бы с Capture и Void. Холды, занятые ими сейчас,
+// пропускаются до следующего запуска.
+func (w *WalletDB) ExpireHolds(ctx context.Context) (int64, error) {
+	var expired int64
+
+	err := postgres.WithTx(ctx, w.client, pgx.TxOptions{}, func(tx pgx.Tx) error {
+		query := `SELECT id::text, wallet_id FROM holds
+			WHERE status = 'ACTIVE' AND expires_at <= now()
+			ORDER BY id
+			FOR UPDATE SKIP LOCKED`
+		w.logger.Debug(fmt.Sprintf("SQL query: %s", query))
+
+		rows, err := tx.Query(ctx, query)
+		if err != nil {
+			return fmt.Errorf("failed to select expired holds: %w", err)
+		}
+		defer rows.Close()
+
+		var holdIDs []string
+		var walletIDs []uuid.UUID
+		for rows.Next() {
+			var holdID string
+			var walletID uuid.UUID
+			if err := rows.Scan(&holdID, &walletID); err != nil {
+				return fmt.Errorf("failed to scan expired hold: %w", err)
+			}
+			holdIDs = append(holdIDs, holdID)
+			walletIDs = append(walletIDs, walletID)
+		}
+		if err := rows.Err(); err != nil {
+			return fmt.Errorf("failed to select expired holds: %w", err)
+		}
+		rows.Close()
+
+		expired = 0
+		if len(holdIDs) == 0 {
+			return nil
+		}
+
+		//Блокировка кошелька заодно меняет его версию: доступный баланс вырос
+		if _, err := lockWallets(ctx, tx, walletIDs...); err != nil {
+			return err
+		}
+
+		query = `WITH expired AS (
+			UPDATE holds SET status = 'EXPIRED', updated_at = now()
+			WHERE id = ANY($1::uuid[])
+			RETURNING wallet_id, currency, amount
+		), released AS (
+			SELECT wallet_id, currency, SUM(amount) AS amount FROM expired GROUP BY wallet_id, currency
+		), updated AS (
+			UPDATE wallet_balances b SET held = b.held - r.amount
+			FROM released r
+			WHERE b.wallet_id = r.wallet_id AND b.currency = r.currency
+		)
+		SELECT count(*) FROM expired`
+		w.logger.Debug(fmt.Sprintf("SQL query: %s, holds: %d", query, len(holdIDs)))
+
+		if err := tx.QueryRow(ctx, query, holdIDs).Scan(&expired); err != nil {
+			return fmt.Errorf("failed to expire holds: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	return expired, nil
+}
+
+// lockActiveHold блокирует холд до конца транзакции. С rejectExpired холд с
+// истекшим сроком считается неактивным, даже если его еще не снял ExpireHolds.
+func (w *WalletDB) lockActiveHold(ctx context.Context, client postgres.Client, holdID uuid.UUID, rejectExpired bool) (*wallet.Hold, error) {
+	query := `SELECT ` + holdColumns + ` FROM holds WHERE id = $1 FOR UPDATE`
+	w.logger.Info(fmt.Sprintf("SQL query: %s, holdID: %v", query, holdID))
+
+	hold, err := scanHold(client.QueryRow(ctx, query, holdID))
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, fmt.Errorf("%w: %v", wallet.ErrHoldNotFound, holdID)
+		}
+		return nil, fmt.Errorf("failed to lock hold: %w", err)
+	}
+
+	if hold.Status != wallet.HoldActive {
+		return nil, fmt.Errorf("%w: hold %v is %s", wallet.ErrHoldNotActive, holdID, hold.Status)
+	}
+	if rejectExpired && !hold.ExpiresAt.After(time.Now()) {
+		return nil, fmt.Errorf("%w: hold %v expired at %s", wallet.ErrHoldNotActive, holdID, hold.ExpiresAt.Format(time.RFC3339))
+	}
+
+	return hold, nil
+}
+
+func releaseHeld(ctx context.Context, client postgres.Client, hold *wallet.Hold) error {
+	query := `UPDATE wallet_balances SET held = held - $1 WHERE wallet_id = $2 AND currency = $3`
+
+	if _, err := client.Exec(ctx, query, hold.Amount.Amount, hold.WalletID, hold.Amount.Currency); err != nil {
+		return fmt.Errorf("failed to release hold: %w", err)
+	}
+
+	return nil
+}
+
+func (w *WalletDB) closeHold(ctx context.Context, client postgres.Client, holdID uuid.UUID, status string, captured *int64) (*wallet.Hold, error) {
+	query := `UPDATE holds SET status = $2, captured_amount = $3, updated_at = now()
+		WHERE id = $1
+		RETURNING ` + holdColumns
+	w.logger.Info(fmt.Sprintf("SQL query: %s, holdID: %v, status: %s", query, holdID, status))
+
+	hold, err := scanHold(client.QueryRow(ctx, query, holdID, status, captured))
+	if err != nil {
+		return nil, fmt.Errorf("failed to update hold: %w", err)
+	}
+
+	return hold, nil
+}
+
+func scanHold(row pgx.Row) (*wallet.Hold, error) {
+	var hold wallet.Hold
+	var captured *int64
+
+	if err := row.Scan(&hold.ID, &hold.WalletID, &hold.Amount.Currency, &hold.Amount.Amount, &captured, &hold.Status, &hold.ExpiresAt, &hold.CreatedAt); err != nil {
+		return nil, err
+	}
+
+	if captured != nil {
+		hold.Captured = &wallet.Money{Amount: *captured, Currency: hold.Amount.Currency}
+	}
+
+	return &hold, nil
+}
@@ -0,0 +1,88 @@
+package db
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"walet_rest_api/internal/domain/wallet"
+	"walet_rest_api/pkg/client/postgres"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// Ключ, операция и сохранение ответа выполняются в одной транзакции: при ошибке
+// операции ключ освобождается, повтор с тем же ключом выполнит ее заново
+func (w *WalletDB) changeBalanceIdempotent(ctx context.Context, dto *wallet.WalletChangeBalanceDTO) (*wallet.Wallet, error) {
+	var updated *wallet.Wallet
+
+	err := postgres.WithTx(ctx, w.client, pgx.TxOptions{}, func(tx pgx.Tx) error {
+		stored, err := w.claimIdempotencyKey(ctx, tx, dto.Idempotency)
+		if err != nil {
+			return err
+		}
+		if stored != nil {
+			dto.Idempotency.Replayed = true
+			updated = stored
+			return nil
+		}
+
+		updated, err = w.changeBalance(ctx, tx, dto)
+		if err != nil {
+			return err
+		}
+
+		response, err := json.Marshal(updated)
+		if err != nil {
+			return fmt.Errorf("failed to encode idempotent response: %w", err)
+		}
+
+		query := `UPDATE idempotency_keys SET response = $2 WHERE key = $1`
+		w.logger.Info(fmt.Sprintf("SQL query: %s, key: %s", query, dto.Idempotency.Key))
+
+		if _, err := tx.Exec(ctx, query, dto.Idempotency.Key, response); err != nil {
+			return fmt.Errorf("failed to store idempotent response: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return updated, nil
+}
+
+// claimIdempotencyKey занимает ключ. Если ключ уже использован, возвращает
+// сохраненный ответ или ошибку, когда отпечаток запроса не совпадает.
+func (w *WalletDB) claimIdempotencyKey(ctx context.Context, client postgres.Client, key *wallet.IdempotencyKey) (*wallet.Wallet, error) {
+	//ON CONFLICT ждет завершения конкурирующей транзакции с тем же ключом
+	query := `INSERT INTO idempotency_keys (key, fingerprint) VALUES ($1, $2) ON CONFLICT (key) DO NOTHING`
+	w.logger.Info(fmt.Sprintf("SQL query: %s, key: %s", query, key.Key))
+
+	tag, err := client.Exec(ctx, query, key.Key, key.Fingerprint)
+	if err != nil {
+		return nil, fmt.Errorf("failed to claim idempotency key: %w", err)
+	}
+	if tag.RowsAffected() == 1 {
+		return nil, nil
+	}
+
+	var fingerprint string
+	var response []byte
+
+	query = `SELECT fingerprint, response FROM idempotency_keys WHERE key = $1`
+	if err := client.QueryRow(ctx, query, key.Key).Scan(&fingerprint, &response); err != nil {
+		return nil, fmt.Errorf("failed to load idempotency key: %w", err)
+	}
+
+	if fingerprint != key.Fingerprint {
+		return nil, fmt.Errorf("%w: %q", wallet.ErrIdempotencyKeyReused, key.Key)
+	}
+
+	var stored wallet.Wallet
+	if err := json.Unmarshal(response, &stored); err != nil {
+		return nil, fmt.Errorf("failed to decode idempotent response: %w", err)
+	}
+
+	return &stored, nil
+}
@@ -0,0 +1,130 @@
+package db
+
+import (
+	"context"
+	"fmt"
+
+	"walet_rest_api/internal/domain/wallet"
+	"walet_rest_api/pkg/client/postgres"
+
+	"github.com/google/uuid"
+)
+
+// Деньги двигаются только проводками двойной записи, wallet_balances.balance -
+// проекция проводок кошелька, которую обновляет та же транзакция. Холды проводок
+// не создают: резерв не меняет баланс, его меняет только CAPTURE.
+
+// Системные счета. Через CASH деньги приходят в систему и уходят из нее, обмен
+// валют проходит через позицию EXCHANGE, спред обмена - доход FEE.
+const (
+	accountCash     = "CASH"
+	accountFee      = "FEE"
+	accountExchange = "EXCHANGE"
+)
+
+// posting - движение по кошельку или системному счету: плюс зачисляет, минус списывает.
+type posting struct {
+	walletID uuid.UUID
+	account  string
+	amount   wallet.Money
+}
+
+func walletPosting(walletID uuid.UUID, amount int64, currency string) posting {
+	return posting{walletID: walletID, amount: wallet.Money{Amount: amount, Currency: currency}}
+}
+
+func accountPosting(account string, amount int64, currency string) posting {
+	return posting{account: account, amount: wallet.Money{Amount: amount, Currency: currency}}
+}
+
+// postEntry записывает проводку entryID. Несбалансированную проводку не пропустит
+// и триггер postings_balanced при коммите, здесь она отсекается до запроса.
+func (w *WalletDB) postEntry(ctx context.Context, client postgres.Client, entryID uuid.UUID, operationType string, postings ...posting) error {
+	sums := make(map[string]int64, 2)
+	walletIDs := make([]string, 0, len(postings))
+	accounts := make([]string, 0, len(postings))
+	currencies := make([]string, 0, len(postings))
+	amounts := make([]int64, 0, len(postings))
+
+	for _, p := range postings {
+		sums[p.amount.Currency] += p.amount.Amount
+		//Нулевые движения не записываются, например спред обмена, округленный до нуля
+		if p.amount.Amount == 0 {
+			continue
+		}
+
+		walletID := ""
+		if p.account == "" {
+			walletID = p.walletID.String()
+		}
+		walletIDs = append(walletIDs, walletID)
+		accounts = append(accounts, p.account)
+		currencies = append(currencies, p.amount.Currency)
+		amounts = append(amounts, p.amount.Amount)
+	}
+
+	for currency, sum := range sums {
+		if sum != 0 {
+			return fmt.Errorf("journal entry %v for %s does not balance: %s postings sum to %d", entryID, operationType, currency, sum)
+		}
+	}
+
+	query := `WITH entry AS (
+		INSERT INTO journal_entries (id, operation_type) VALUES ($1, $2)
+	)
+	INSERT INTO postings (entry_id, wallet_id, account, currency, amount)
+	SELECT $1, NULLIF(p.wallet_id, '')::uuid, NULLIF(p.account, ''), p.currency, p.amount
+	FROM unnest($3::text[], $4::text[], $5::text[], $6::bigint[]) AS p(wallet_id, account, currency, amount)`
+	w.logger.Info(fmt.Sprintf("SQL query: %s, entryID: %v, operation: %s", query, entryID, operationType))
+
+	if _, err := client.Exec(ctx, query, entryID, operationType, walletIDs, accounts, currencies, amounts); err != nil {
+		return fmt.Errorf("failed to post journal entry: %w", err)
+	}
+
+	return nil
+}
+
+// CheckLedger сверяет проводки с балансами. Пустой результат - инварианты соблюдены.
+func (w *WalletDB) CheckLedger(ctx context.Context) ([]wallet.LedgerViolation, error) {
+	query := `SELECT NULL::uuid, currency, 0::bigint, SUM(amount)::bigint
+		FROM postings
+		GROUP BY currency
+		HAVING SUM(amount) <> 0
+	UNION ALL
+	SELECT b.wallet_id, b.currency, COALESCE(p.total, 0)::bigint, (b.balance + COALESCE(s.total, 0))::bigint
+		FROM wallet_balances b
+		LEFT JOIN (
+			SELECT wallet_id, currency, SUM(amount) AS total
+			FROM postings
+			WHERE wallet_id IS NOT NULL
+			GROUP BY wallet_id, currency
+		) p ON p.wallet_id = b.wallet_id AND p.currency = b.currency
+		LEFT JOIN (
+			SELECT wallet_id, currency, SUM(balance) AS total
+			FROM wallet_balance_slots
+			GROUP BY wallet_id, currency
+		) s ON s.wallet_id = b.wallet_id AND s.currency = b.currency
+		WHERE b.balance + COALESCE(s.total, 0) <> COALESCE(p.total, 0)`
+	w.logger.Debug(fmt.Sprintf("SQL query: %s", query))
+
+	rows, err := w.client.Query(ctx, query)
+	if err != nil {
+		return nil, fmt.Errorf("failed to check ledger: %w", err)
+	}
+	defer rows.Close()
+
+	var violations []wallet.LedgerViolation
+	for rows.Next() {
+		var violation wallet.LedgerViolation
+		if err := rows.Scan(&violation.WalletID, &violation.Actual.Currency, &violation.Expected.Amount, &violation.Actual.Amount); err != nil {
+			return nil, fmt.Errorf("failed to scan ledger violation: %w", err)
+		}
+		violation.Expected.Currency = violation.Actual.Currency
+		violations = append(violations, violation)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to check ledger: %w", err)
+	}
+
+	return violations, nil
+}
@@ -0,0 +1,121 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"walet_rest_api/internal/domain/wallet"
+	"walet_rest_api/pkg/client/postgres"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+)
+
+// Отменить можно только DEPOSIT и WITHDRAW. Исходная запись не меняется:
+// отмена - новая запись с обратным движением и ссылкой reversal_of.
+var reversalTypes = map[string]string{
+	"DEPOSIT":  "REVERSAL_OUT",
+	"WITHDRAW": "REVERSAL_IN",
+}
+
+func (w *WalletDB) ReverseTransaction(ctx context.Context, dto *wallet.ReversalDTO) (*wallet.Transaction, error) {
+	var reversal wallet.Transaction
+
+	err := postgres.WithTx(ctx, w.client, pgx.TxOptions{}, func(tx pgx.Tx) error {
+		//Блокировка строки не меняет ее, но не дает двум отменам одной операции
+		//посчитать остаток одновременно
+		originalQuery := `SELECT wallet_id, operation_type, amount, currency,
+				(SELECT COALESCE(SUM(r.amount), 0) FROM wallet_transactions r WHERE r.reversal_of = t.id)::bigint
+			FROM wallet_transactions t
+			WHERE id = $1
+			FOR UPDATE`
+		w.logger.Info(fmt.Sprintf("SQL query: %s, transactionID: %v", originalQuery, dto.TransactionID))
+
+		var original wallet.Transaction
+		var reversed int64
+		err := tx.QueryRow(ctx, originalQuery, dto.TransactionID).Scan(&original.WalletID, &original.OperationType, &original.Amount.Amount, &original.Amount.Currency, &reversed)
+		if err != nil {
+			if errors.Is(err, pgx.ErrNoRows) {
+				return fmt.Errorf("%w: %v", wallet.ErrTransactionNotFound, dto.TransactionID)
+			}
+			return fmt.Errorf("failed to load transaction: %w", err)
+		}
+
+		if _, err := lockWallet(ctx, tx, original.WalletID); err != nil {
+			return err
+		}
+
+		operationType, ok := reversalTypes[original.OperationType]
+		if !ok {
+			return fmt.Errorf("%w: %s transactions cannot be reversed", wallet.ErrInvalidOperation, original.OperationType)
+		}
+
+		remaining := original.Amount.Amount - reversed
+		if remaining <= 0 {
+			return fmt.Errorf("%w: %v", wallet.ErrAlreadyReversed, dto.TransactionID)
+		}
+
+		amount := wallet.Money{Amount: remaining, Currency: original.Amount.Currency}
+		if dto.Amount != nil {
+			if dto.Amount.Currency != original.Amount.Currency {
+				return fmt.Errorf("%w: transaction %v is in %s, reversal is in %s", wallet.ErrCurrencyMismatch, dto.TransactionID, original.Amount.Currency, dto.Amount.Currency)
+			}
+			if dto.Amount.Amount > remaining {
+				return fmt.Errorf("%w: only %s %s of transaction %v is left to reverse", wallet.ErrInvalidAmount, amount, amount.Currency, dto.TransactionID)
+			}
+			amount = *dto.Amount
+		}
+
+		//Отмена пополнения списывает деньги и, как WITHDRAW, не трогает зарезервированное холдами
+		update := `UPDATE wallet_balances SET balance = balance + $1 WHERE wallet_id = $2 AND currency = $3 RETURNING wallet_id, balance`
+		if operationType == "REVERSAL_OUT" {
+			update = `UPDATE wallet_balances SET balance = balance - $1 WHERE wallet_id = $2 AND currency = $3 AND balance - held >= $1 RETURNING wallet_id, balance`
+		}
+
+		query := `WITH updated AS (
+			` + update + `
+		)
+		INSERT INTO wallet_transactions (wallet_id, operation_type, amount, currency, balance_after, reversal_of, entry_id)
+		SELECT wallet_id, $5, $1, $3, balance, $4, $6 FROM updated
+		RETURNING id, balance_after, created_at`
+		w.logger.Info(fmt.Sprintf("SQL query: %s, amount: %s %s, transactionID: %v", query, amount, amount.Currency, dto.TransactionID))
+
+		reversal = wallet.Transaction{
+			WalletID:      original.WalletID,
+			OperationType: operationType,
+			Amount:        amount,
+			BalanceAfter:  wallet.Money{Currency: amount.Currency},
+			ReversalOf:    &dto.TransactionID,
+		}
+
+		entryID := uuid.New()
+
+		err = tx.QueryRow(ctx, query, amount.Amount, original.WalletID, amount.Currency, dto.TransactionID, operationType, entryID).
+			Scan(&reversal.ID, &reversal.BalanceAfter.Amount, &reversal.CreatedAt)
+		if err != nil {
+			if errors.Is(err, pgx.ErrNoRows) {
+				return &wallet.WalletError{WalletID: original.WalletID, Err: wallet.ErrInsufficientFunds}
+			}
+			if isPgError(err, numericOutOfRangeCode) {
+				return fmt.Errorf("%w: balance of wallet %v would overflow", wallet.ErrInvalidAmount, original.WalletID)
+			}
+			return fmt.Errorf("failed to reverse transaction: %w", err)
+		}
+
+		//Отмена зеркалит проводку исходной операции по счету CASH
+		credit := amount.Amount
+		if operationType == "REVERSAL_OUT" {
+			credit = -credit
+		}
+
+		return w.postEntry(ctx, tx, entryID, operationType,
+			walletPosting(original.WalletID, credit, amount.Currency),
+			accountPosting(accountCash, -credit, amount.Currency))
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &reversal, nil
+}
@@ -0,0 +1,273 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"walet_rest_api/internal/domain/wallet"
+	"walet_rest_api/pkg/client/postgres"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+)
+
+// Горячий кошелек (wallets.slots > 1) держит часть баланса в слотах
+// wallet_balance_slots. Пополнения и списания без If-Match меняют один слот и
+// блокируют кошелек только на чтение. Все остальные операции блокируют кошелек
+// через lockWallet, который сначала переносит слоты в основной баланс, поэтому
+// дальше работают только с wallet_balances. Баланс валюты - основной баланс плюс
+// ее слоты, версия кошелька - wallets.version плюс изменения в слотах.
+//
+// Операция по слоту пишет историю последней. Перед этим она берет slotLockQuery,
+// а баланс и версию для истории читает следующим запросом, поэтому видит все
+// операции по слотам, завершенные раньше нее. Так balance_after и версии в
+// истории идут подряд, как у кошелька без слотов. Операции по слотам ждут друг
+// друга только на записи истории и коммите.
+
+// slotDepositQuery зачисляет сумму в случайный слот. Строки нет, если у кошелька
+// один слот или нет баланса в валюте. Кошелек блокируется на чтение, чтобы
+// операция по слоту не шла одновременно с обычной, которая переносит слоты.
+const slotDepositQuery = `WITH target AS (
+	SELECT w.id, floor(random() * w.slots)::int AS slot FROM wallets w
+	JOIN wallet_balances b ON b.wallet_id = w.id AND b.currency = $3
+	WHERE w.id = $2 AND w.slots > 1
+	FOR SHARE OF w
+)
+INSERT INTO wallet_balance_slots AS s (wallet_id, currency, slot, balance, changes)
+SELECT id, $3, slot, $1, 1 FROM target
+ON CONFLICT (wallet_id, currency, slot) DO UPDATE SET balance = s.balance + EXCLUDED.balance, changes = s.changes + 1
+RETURNING s.wallet_id`
+
+// slotWithdrawQuery списывает сумму со свободного слота, в котором ее хватает.
+// Занятые слоты пропускаются. Основной баланс блокируется на чтение: пока холды не
+// превышают его, списание из слота не уводит доступный баланс в минус.
+const slotWithdrawQuery = `WITH target AS (
+	SELECT id FROM wallets WHERE id = $2 AND slots > 1
+	FOR SHARE
+), candidate AS (
+	SELECT s.wallet_id, s.slot FROM wallet_balance_slots s, target
+	WHERE s.wallet_id = target.id AND s.currency = $3 AND s.balance >= $1
+	ORDER BY random() LIMIT 1
+	FOR UPDATE OF s SKIP LOCKED
+), main AS (
+	SELECT b.wallet_id FROM wallet_balances b, candidate
+	WHERE b.wallet_id = $2 AND b.currency = $3 AND b.held <= b.balance
+	FOR SHARE OF b
+)
+UPDATE wallet_balance_slots s SET balance = s.balance - $1, changes = s.changes + 1
+FROM candidate, main
+WHERE s.wallet_id = candidate.wallet_id AND s.currency = $3 AND s.slot = candidate.slot
+RETURNING s.wallet_id`
+
+// slotLockQuery пропускает операции по слотам одного кошелька к записи истории по
+// одной. Блокировка снимается с коммитом.
+const slotLockQuery = `SELECT pg_advisory_xact_lock(hashtext('wallet_balance_slots'), hashtext($1))`
+
+// slotHistoryQuery дописывает историю операции по слоту и возвращает кошелек с
+// балансом и версией так, как их увидит GetBalance.
+const slotHistoryQuery = `WITH totals AS (
+	SELECT b.wallet_id,
+		(b.balance + (SELECT COALESCE(SUM(s.balance), 0) FROM wallet_balance_slots s
+			WHERE s.wallet_id = b.wallet_id AND s.currency = b.currency))::bigint AS balance,
+		(w.version + (SELECT COALESCE(SUM(s.changes), 0) FROM wallet_balance_slots s
+			WHERE s.wallet_id = b.wallet_id))::bigint AS version
+	FROM wallet_balances b
+	JOIN wallets w ON w.id = b.wallet_id
+	WHERE b.wallet_id = $2 AND b.currency = $3
+), logged AS (
+	INSERT INTO wallet_transactions (wallet_id, operation_type, amount, currency, balance_after, entry_id)
+	SELECT wallet_id, $5, $1, $3, balance, $4 FROM totals
+)
+SELECT wallet_id, balance, version FROM totals`
+
+// consolidateQuery переносит непустые слоты кошельков $1 в основные балансы, а их
+// изменения - в wallets.version. Видимые баланс и версия при этом не меняются.
+// Возвращает число перенесенных изменений.
+const consolidateQuery = `WITH slots AS (
+	SELECT wallet_id, currency, slot, balance, changes FROM wallet_balance_slots
+	WHERE wallet_id = ANY($1::uuid[]) AND (balance <> 0 OR changes <> 0)
+	ORDER BY wallet_id, currency, slot
+	FOR UPDATE
+), cleared AS (
+	UPDATE wallet_balance_slots s SET balance = 0, changes = 0
+	FROM slots WHERE s.wallet_id = slots.wallet_id AND s.currency = slots.currency AND s.slot = slots.slot
+), merged AS (
+	UPDATE wallet_balances b SET balance = b.balance + m.balance
+	FROM (SELECT wallet_id, currency, SUM(balance) AS balance FROM slots GROUP BY wallet_id, currency) m
+	WHERE b.wallet_id = m.wallet_id AND b.currency = m.currency
+), versioned AS (
+	UPDATE wallets w SET version = w.version + m.changes
+	FROM (SELECT wallet_id, SUM(changes) AS changes FROM slots GROUP BY wallet_id) m
+	WHERE w.id = m.wallet_id
+)
+SELECT COALESCE(SUM(changes), 0)::bigint FROM slots`
+
+func (w *WalletDB) isSharded(walletID uuid.UUID) bool {
+	sharded := w.sharded.Load()
+	if sharded == nil {
+		return false
+	}
+	_, ok := (*sharded)[walletID]
+	return ok
+}
+
+// changeSlot проводит операцию через слот. false - слот не подошел, операция
+// должна пойти обычным путем в той же транзакции.
+func (w *WalletDB) changeSlot(ctx context.Context, client postgres.Client, dto *wallet.WalletChangeBalanceDTO) (*wallet.Wallet, bool, error) {
+	query := slotDepositQuery
+	walletAmount := dto.Amount.Amount
+	if dto.OperationType == "WITHDRAW" {
+		query = slotWithdrawQuery
+		walletAmount = -walletAmount
+	}
+	w.logger.Info(fmt.Sprintf("SQL query: %s, amount: %s %s, walletID: %v", query, dto.Amount, dto.Amount.Currency, dto.ID))
+
+	var walletID uuid.UUID
+	if err := client.QueryRow(ctx, query, dto.Amount.Amount, dto.ID, dto.Amount.Currency).Scan(&walletID); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, false, nil
+		}
+		if isPgError(err, numericOutOfRangeCode) {
+			return nil, false, fmt.Errorf("%w: balance of wallet %v would overflow", wallet.ErrInvalidAmount, dto.ID)
+		}
+		return nil, false, fmt.Errorf("failed to change slot balance: %w", err)
+	}
+
+	entryID := uuid.New()
+	err := w.postEntry(ctx, client, entryID, dto.OperationType,
+		walletPosting(dto.ID, walletAmount, dto.Amount.Currency),
+		accountPosting(accountCash, -walletAmount, dto.Amount.Currency))
+	if err != nil {
+		return nil, false, err
+	}
+
+	if _, err := client.Exec(ctx, slotLockQuery, dto.ID.String()); err != nil {
+		return nil, false, fmt.Errorf("failed to lock slot history: %w", err)
+	}
+
+	updated := wallet.Wallet{Balance: wallet.Money{Currency: dto.Amount.Currency}}
+	err = client.QueryRow(ctx, slotHistoryQuery, dto.Amount.Amount, dto.ID, dto.Amount.Currency, entryID, dto.OperationType).Scan(&updated.ID, &updated.Balance.Amount, &updated.Version)
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to log slot operation: %w", err)
+	}
+
+	return &updated, true, nil
+}
+
+// consolidateSlots переносит слоты кошельков в основные балансы. Кошельки уже
+// должны быть заблокированы этой транзакцией.
+func consolidateSlots(ctx context.Context, client postgres.Client, walletIDs ...uuid.UUID) (int64, error) {
+	var folded int64
+	if err := client.QueryRow(ctx, consolidateQuery, walletIDStrings(walletIDs)).Scan(&folded); err != nil {
+		return 0, fmt.Errorf("failed to consolidate balance slots: %w", err)
+	}
+
+	return folded, nil
+}
+
+func walletIDStrings(walletIDs []uuid.UUID) []string {
+	ids := make([]string, 0, len(walletIDs))
+	for _, id := range walletIDs {
+		ids = append(ids, id.String())
+	}
+	return ids
+}
+
+// ConsolidateSlots переносит слоты всех кошельков в основные балансы и обновляет
+// список горячих кошельков. Возвращает число кошельков, чьи слоты перенесены.
+func (w *WalletDB) ConsolidateSlots(ctx context.Context) (int64, error) {
+	query := `SELECT id, slots > 1,
+			EXISTS (SELECT 1 FROM wallet_balance_slots s WHERE s.wallet_id = wallets.id AND (s.balance <> 0 OR s.changes <> 0))
+		FROM wallets
+		WHERE slots > 1 OR id IN (SELECT wallet_id FROM wallet_balance_slots WHERE balance <> 0 OR changes <> 0)`
+	w.logger.Debug(fmt.Sprintf("SQL query: %s", query))
+
+	rows, err := w.client.Query(ctx, query)
+	if err != nil {
+		return 0, fmt.Errorf("failed to list balance slots: %w", err)
+	}
+	defer rows.Close()
+
+	sharded := make(map[uuid.UUID]struct{})
+	var pending []uuid.UUID
+	for rows.Next() {
+		var walletID uuid.UUID
+		var hot, filled bool
+		if err := rows.Scan(&walletID, &hot, &filled); err != nil {
+			return 0, fmt.Errorf("failed to scan balance slots: %w", err)
+		}
+		if hot {
+			sharded[walletID] = struct{}{}
+		}
+		if filled {
+			pending = append(pending, walletID)
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return 0, fmt.Errorf("failed to list balance slots: %w", err)
+	}
+	rows.Close()
+
+	w.sharded.Store(&sharded)
+
+	var consolidated int64
+	for _, walletID := range pending {
+		folded, err := w.consolidateWallet(ctx, walletID)
+		if err != nil {
+			return consolidated, err
+		}
+		if folded > 0 {
+			consolidated++
+		}
+	}
+
+	return consolidated, nil
+}
+
+// consolidateWallet блокирует кошелек без изменения версии и переносит его слоты.
+func (w *WalletDB) consolidateWallet(ctx context.Context, walletID uuid.UUID) (int64, error) {
+	var folded int64
+	err := postgres.WithTx(ctx, w.client, pgx.TxOptions{}, func(tx pgx.Tx) error {
+		if _, err := tx.Exec(ctx, `SELECT 1 FROM wallets WHERE id = $1 FOR NO KEY UPDATE`, walletID); err != nil {
+			return fmt.Errorf("failed to lock wallet: %w", err)
+		}
+
+		var err error
+		folded, err = consolidateSlots(ctx, tx, walletID)
+		return err
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	return folded, nil
+}
+
+// MaxSlots - наибольшее число слотов кошелька, как в ограничении wallets.slots.
+const MaxSlots = 64
+
+// SetSlots задает число слотов кошелька, 1 - без слотов. Слоты сначала
+// переносятся в основной баланс, поэтому уменьшение их числа не теряет денег.
+// Запущенные экземпляры начинают писать в слоты после ближайшего ConsolidateSlots.
+func (w *WalletDB) SetSlots(ctx context.Context, walletID uuid.UUID, slots int) error {
+	if slots < 1 || slots > MaxSlots {
+		return fmt.Errorf("%w: slots must be between 1 and %d, got %d", wallet.ErrInvalidOperation, MaxSlots, slots)
+	}
+
+	query := `UPDATE wallets SET slots = $2 WHERE id = $1`
+	w.logger.Info(fmt.Sprintf("SQL query: %s, walletID: %v, slots: %d", query, walletID, slots))
+
+	return postgres.WithTx(ctx, w.client, pgx.TxOptions{}, func(tx pgx.Tx) error {
+		tag, err := tx.Exec(ctx, query, walletID, slots)
+		if err != nil {
+			return fmt.Errorf("failed to set balance slots: %w", err)
+		}
+		if tag.RowsAffected() == 0 {
+			return &wallet.WalletError{WalletID: walletID, Err: wallet.ErrWalletNotFound}
+		}
+
+		_, err = consolidateSlots(ctx, tx, walletID)
+		return err
+	})
+}
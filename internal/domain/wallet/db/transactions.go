@@ -0,0 +1,134 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"walet_rest_api/internal/domain/wallet"
+	"walet_rest_api/pkg/client/postgres"
+
+	"github.com/jackc/pgx/v5"
+)
+
+func (w *WalletDB) ListTransactions(ctx context.Context, filter *wallet.TransactionFilter) (*wallet.TransactionPage, error) {
+	var page *wallet.TransactionPage
+	err := w.read(ctx, func(client postgres.Client) error {
+		var err error
+		page, err = w.listTransactions(ctx, client, filter)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return page, nil
+}
+
+func (w *WalletDB) listTransactions(ctx context.Context, client postgres.Client, filter *wallet.TransactionFilter) (*wallet.TransactionPage, error) {
+	exists, err := walletExists(ctx, client, filter.WalletID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to check wallet existence: %w", err)
+	}
+	if !exists {
+		return nil, &wallet.WalletError{WalletID: filter.WalletID, Err: wallet.ErrWalletNotFound}
+	}
+
+	conditions := []string{"wallet_id = $1"}
+	args := []any{filter.WalletID}
+
+	order := "DESC"
+	cursorOp := "<"
+	if filter.Ascending {
+		order = "ASC"
+		cursorOp = ">"
+	}
+
+	if filter.After != nil {
+		//Курсор - id транзакции, пагинация идет по порядковому номеру seq.
+		//Все записи истории кошелька пишутся под его блокировкой до коммита (lockWallet,
+		//lockWallets, slotLockQuery), поэтому seq внутри кошелька растет в порядке коммитов
+		//и строка с меньшим seq не может появиться позже за уже выданным курсором
+		var cursorSeq int64
+
+		cursorQuery := `SELECT seq FROM wallet_transactions WHERE id = $1 AND wallet_id = $2`
+		if err := client.QueryRow(ctx, cursorQuery, *filter.After, filter.WalletID).Scan(&cursorSeq); err != nil {
+			if errors.Is(err, pgx.ErrNoRows) {
+				return nil, fmt.Errorf("%w: transaction %v not found", wallet.ErrInvalidCursor, *filter.After)
+			}
+			return nil, fmt.Errorf("failed to resolve cursor: %w", err)
+		}
+
+		args = append(args, cursorSeq)
+		conditions = append(conditions, fmt.Sprintf("seq %s $%d", cursorOp, len(args)))
+	}
+
+	if filter.OperationType != "" {
+		args = append(args, filter.OperationType)
+		conditions = append(conditions, fmt.Sprintf("operation_type = $%d", len(args)))
+	}
+
+	if filter.Currency != "" {
+		args = append(args, filter.Currency)
+		conditions = append(conditions, fmt.Sprintf("currency = $%d", len(args)))
+	}
+
+	if filter.From != nil {
+		args = append(args, *filter.From)
+		conditions = append(conditions, fmt.Sprintf("created_at >= $%d", len(args)))
+	}
+
+	if filter.To != nil {
+		args = append(args, *filter.To)
+		conditions = append(conditions, fmt.Sprintf("created_at < $%d", len(args)))
+	}
+
+	//Берем на одну запись больше, чтобы понять, есть ли следующая страница
+	args = append(args, filter.Limit+1)
+
+	query := fmt.Sprintf(`SELECT id, wallet_id, operation_type, amount, currency, balance_after, transfer_id, counterparty_wallet_id,
+			exchange_id, rate::text, spread::text, rate_source, hold_id, reversal_of,
+			(SELECT SUM(r.amount) FROM wallet_transactions r WHERE r.reversal_of = wallet_transactions.id)::bigint,
+			created_at
+		FROM wallet_transactions
+		WHERE %s
+		ORDER BY seq %s
+		LIMIT $%d`, strings.Join(conditions, " AND "), order, len(args))
+
+	w.logger.Info(fmt.Sprintf("SQL query: %s, args: %v", query, args))
+
+	rows, err := client.Query(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list transactions: %w", err)
+	}
+	defer rows.Close()
+
+	page := &wallet.TransactionPage{Transactions: []wallet.Transaction{}}
+
+	for rows.Next() {
+		var tx wallet.Transaction
+		var reversed *int64
+		if err := rows.Scan(&tx.ID, &tx.WalletID, &tx.OperationType, &tx.Amount.Amount, &tx.Amount.Currency, &tx.BalanceAfter.Amount, &tx.TransferID, &tx.CounterpartyWalletID,
+			&tx.ExchangeID, &tx.Rate, &tx.Spread, &tx.RateSource, &tx.HoldID, &tx.ReversalOf,
+			&reversed, &tx.CreatedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan transaction: %w", err)
+		}
+		tx.BalanceAfter.Currency = tx.Amount.Currency
+		if reversed != nil {
+			tx.Reversed = &wallet.Money{Amount: *reversed, Currency: tx.Amount.Currency}
+		}
+		page.Transactions = append(page.Transactions, tx)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to list transactions: %w", err)
+	}
+
+	if len(page.Transactions) > filter.Limit {
+		page.Transactions = page.Transactions[:filter.Limit]
+		next := page.Transactions[filter.Limit-1].ID
+		page.NextCursor = &next
+	}
+
+	return page, nil
+}
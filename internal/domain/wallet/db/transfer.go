@@ -0,0 +1,103 @@
+package db
+
+import (
+	"context"
+	"fmt"
+
+	"walet_rest_api/internal/domain/wallet"
+	"walet_rest_api/pkg/client/postgres"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+)
+
+func (w *WalletDB) Transfer(ctx context.Context, dto *wallet.TransferDTO) (*wallet.Transfer, error) {
+	var result *wallet.Transfer
+
+	err := postgres.WithTx(ctx, w.client, pgx.TxOptions{}, func(tx pgx.Tx) error {
+		versions, err := lockWallets(ctx, tx, dto.FromID, dto.ToID)
+		if err != nil {
+			return err
+		}
+
+		//Блокируем балансы обоих кошельков в порядке id, чтобы встречные переводы не взаимоблокировались
+		//Для проверки списания берется доступный баланс, за вычетом холдов
+		lockQuery := `SELECT wallet_id, balance - held FROM wallet_balances
+			WHERE wallet_id IN ($1, $2) AND currency = $3
+			ORDER BY wallet_id FOR UPDATE`
+		w.logger.Info(fmt.Sprintf("SQL query: %s, from: %v, to: %v, currency: %s", lockQuery, dto.FromID, dto.ToID, dto.Amount.Currency))
+
+		rows, err := tx.Query(ctx, lockQuery, dto.FromID, dto.ToID, dto.Amount.Currency)
+		if err != nil {
+			return fmt.Errorf("failed to lock wallets: %w", err)
+		}
+
+		available := make(map[uuid.UUID]int64, 2)
+		for rows.Next() {
+			var id uuid.UUID
+			var balance int64
+			if err := rows.Scan(&id, &balance); err != nil {
+				rows.Close()
+				return fmt.Errorf("failed to scan wallet: %w", err)
+			}
+			available[id] = balance
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return fmt.Errorf("failed to lock wallets: %w", err)
+		}
+
+		for _, id := range []uuid.UUID{dto.FromID, dto.ToID} {
+			if _, ok := available[id]; !ok {
+				return currencyMismatch(id, dto.Amount.Currency)
+			}
+		}
+
+		if available[dto.FromID] < dto.Amount.Amount {
+			return &wallet.WalletError{WalletID: dto.FromID, Err: wallet.ErrInsufficientFunds}
+		}
+
+		result = &wallet.Transfer{
+			ID:     dto.ID,
+			Amount: dto.Amount,
+			From:   wallet.Wallet{Version: versions[dto.FromID], Balance: wallet.Money{Currency: dto.Amount.Currency}},
+			To:     wallet.Wallet{Version: versions[dto.ToID], Balance: wallet.Money{Currency: dto.Amount.Currency}},
+		}
+
+		debitQuery := `UPDATE wallet_balances SET balance = balance - $1 WHERE wallet_id = $2 AND currency = $3 RETURNING wallet_id, balance`
+		w.logger.Info(fmt.Sprintf("SQL query: %s, amount: %s, walletID: %v", debitQuery, dto.Amount, dto.FromID))
+
+		if err := tx.QueryRow(ctx, debitQuery, dto.Amount.Amount, dto.FromID, dto.Amount.Currency).Scan(&result.From.ID, &result.From.Balance.Amount); err != nil {
+			return fmt.Errorf("failed to debit wallet: %w", err)
+		}
+
+		creditQuery := `UPDATE wallet_balances SET balance = balance + $1 WHERE wallet_id = $2 AND currency = $3 RETURNING wallet_id, balance`
+		w.logger.Info(fmt.Sprintf("SQL query: %s, amount: %s, walletID: %v", creditQuery, dto.Amount, dto.ToID))
+
+		if err := tx.QueryRow(ctx, creditQuery, dto.Amount.Amount, dto.ToID, dto.Amount.Currency).Scan(&result.To.ID, &result.To.Balance.Amount); err != nil {
+			if isPgError(err, numericOutOfRangeCode) {
+				return fmt.Errorf("%w: balance of wallet %v would overflow", wallet.ErrInvalidAmount, dto.ToID)
+			}
+			return fmt.Errorf("failed to credit wallet: %w", err)
+		}
+
+		entryID := uuid.New()
+
+		logQuery := `INSERT INTO wallet_transactions (wallet_id, operation_type, amount, currency, balance_after, transfer_id, counterparty_wallet_id, entry_id)
+			VALUES ($1, 'TRANSFER_OUT', $3, $7, $4, $6, $2, $8), ($2, 'TRANSFER_IN', $3, $7, $5, $6, $1, $8)`
+		w.logger.Info(fmt.Sprintf("SQL query: %s, transferID: %v", logQuery, dto.ID))
+
+		if _, err := tx.Exec(ctx, logQuery, dto.FromID, dto.ToID, dto.Amount.Amount, result.From.Balance.Amount, result.To.Balance.Amount, dto.ID, dto.Amount.Currency, entryID); err != nil {
+			return fmt.Errorf("failed to record transfer: %w", err)
+		}
+
+		return w.postEntry(ctx, tx, entryID, "TRANSFER",
+			walletPosting(dto.FromID, -dto.Amount.Amount, dto.Amount.Currency),
+			walletPosting(dto.ToID, dto.Amount.Amount, dto.Amount.Currency))
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
@@ -0,0 +1,48 @@
+package wallet
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/google/uuid"
+)
+
+var (
+	ErrWalletNotFound       = errors.New("wallet not found")
+	ErrWalletAlreadyExists  = errors.New("wallet already exists")
+	ErrInsufficientFunds    = errors.New("insufficient funds")
+	ErrInvalidOperation     = errors.New("invalid operation")
+	ErrInvalidAmount        = errors.New("invalid amount")
+	ErrUnsupportedCurrency  = errors.New("unsupported currency")
+	ErrCurrencyMismatch     = errors.New("wallet has no balance in this currency")
+	ErrBalanceAlreadyExists = errors.New("wallet already has a balance in this currency")
+	ErrRateUnavailable      = errors.New("exchange rate unavailable")
+	ErrQuoteNotFound        = errors.New("quote not found")
+	ErrQuoteExpired         = errors.New("quote expired")
+	ErrQuoteAlreadyUsed     = errors.New("quote already used")
+	ErrHoldNotFound         = errors.New("hold not found")
+	ErrHoldNotActive        = errors.New("hold is not active")
+	ErrTransactionNotFound  = errors.New("transaction not found")
+	ErrAlreadyReversed      = errors.New("transaction already reversed")
+	ErrInvalidWalletID      = errors.New("invalid wallet id")
+	ErrInvalidCursor        = errors.New("invalid cursor")
+	ErrIdempotencyKeyReused = errors.New("idempotency key was already used with a different request")
+	ErrVersionMismatch      = errors.New("wallet was modified since the expected version")
+	ErrBatchAborted         = errors.New("batch aborted by a failed operation")
+	ErrLimitExceeded        = errors.New("operation limit exceeded")
+)
+
+// WalletError привязывает доменную ошибку к конкретному кошельку. Проверяется
+// через errors.Is(err, ErrWalletNotFound), id достается через errors.As.
+type WalletError struct {
+	WalletID uuid.UUID
+	Err      error
+}
+
+func (e *WalletError) Error() string {
+	return fmt.Sprintf("%v: %v", e.Err, e.WalletID)
+}
+
+func (e *WalletError) Unwrap() error {
+	return e.Err
+}
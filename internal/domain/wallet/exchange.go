@@ -0,0 +1,100 @@
+package wallet
+
+import (
+	"context"
+	"fmt"
+	"math/big"
+	"strings"
+	"time"
+)
+
+const (
+	// DefaultQuoteTTL - сколько котировка держит курс, если не задано иное.
+	DefaultQuoteTTL = 30 * time.Second
+
+	// maxRateDecimals - точность курса и спреда. Курс хранится и применяется
+	// ровно в том виде, в каком записан в истории.
+	maxRateDecimals = 12
+)
+
+// ExchangeRate - курс from -> to: сколько единиц to дают за одну единицу from.
+type ExchangeRate struct {
+	From   string
+	To     string
+	Rate   *big.Rat
+	Source string
+}
+
+// RateProvider отдает текущий курс обмена. Неизвестная пара - ErrRateUnavailable.
+type RateProvider interface {
+	Rate(ctx context.Context, from, to string) (*ExchangeRate, error)
+}
+
+// ExchangeConfig задает источник курсов, спред (доля от курса, например 0.005)
+// и время жизни котировки. Без Rates обмен валют недоступен.
+type ExchangeConfig struct {
+	Rates    RateProvider
+	Spread   *big.Rat
+	QuoteTTL time.Duration
+}
+
+// ParseRate разбирает неотрицательную десятичную строку курса или спреда.
+func ParseRate(value string) (*big.Rat, error) {
+	whole, fraction, hasPoint := strings.Cut(value, ".")
+	if whole == "" || (hasPoint && fraction == "") || !isDigits(whole) || !isDigits(fraction) {
+		return nil, fmt.Errorf("%q is not a decimal number", value)
+	}
+	if len(strings.TrimRight(fraction, "0")) > maxRateDecimals {
+		return nil, fmt.Errorf("%q has more than %d decimal places", value, maxRateDecimals)
+	}
+
+	rate, ok := new(big.Rat).SetString(value)
+	if !ok {
+		return nil, fmt.Errorf("%q is not a decimal number", value)
+	}
+	return rate, nil
+}
+
+// RoundRate округляет курс до точности, с которой он хранится.
+func RoundRate(rate *big.Rat) *big.Rat {
+	rounded, _ := new(big.Rat).SetString(rate.FloatString(maxRateDecimals))
+	return rounded
+}
+
+// FormatRate форматирует курс десятичной строкой без незначащих нулей.
+func FormatRate(rate *big.Rat) string {
+	s := rate.FloatString(maxRateDecimals)
+	s = strings.TrimRight(s, "0")
+	return strings.TrimSuffix(s, ".")
+}
+
+// Convert переводит сумму в валюту currency по курсу за вычетом спреда.
+// Результат округляется вниз до минимальной единицы валюты.
+func Convert(amount Money, currency string, rate, spread *big.Rat) (Money, error) {
+	fromExponent, ok := CurrencyExponent(amount.Currency)
+	if !ok {
+		return Money{}, fmt.Errorf("%w: %q", ErrUnsupportedCurrency, amount.Currency)
+	}
+	toExponent, ok := CurrencyExponent(currency)
+	if !ok {
+		return Money{}, fmt.Errorf("%w: %q", ErrUnsupportedCurrency, currency)
+	}
+
+	applied := new(big.Rat).Sub(big.NewRat(1, 1), spread)
+	applied.Mul(applied, rate)
+
+	converted := new(big.Rat).SetInt64(amount.Amount)
+	converted.Mul(converted, applied)
+	converted.Mul(converted, new(big.Rat).SetFrac(pow10(toExponent), pow10(fromExponent)))
+
+	minor := new(big.Int).Quo(converted.Num(), converted.Denom())
+	if !minor.IsInt64() {
+		return Money{}, fmt.Errorf("%w: converted amount is out of range", ErrInvalidAmount)
+	}
+
+	return Money{Amount: minor.Int64(), Currency: currency}, nil
+}
+
+func pow10(n int) *big.Int {
+	return new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(n)), nil)
+}
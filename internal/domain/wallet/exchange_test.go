@@ -0,0 +1,72 @@
+package wallet
+
+import (
+	"errors"
+	"math/big"
+	"testing"
+)
+
+func TestConvert(t *testing.T) {
+	cases := []struct {
+		amount Money
+		to     string
+		rate   string
+		spread string
+		want   Money
+	}{
+		{NewMoney(10000, "USD"), "RUB", "92.5", "0", NewMoney(925000, "RUB")},
+		{NewMoney(10000, "USD"), "RUB", "92.5", "0.005", NewMoney(920375, "RUB")},
+		{NewMoney(100, "RUB"), "USD", "0.0108", "0", NewMoney(1, "USD")},
+		{NewMoney(150, "USD"), "JPY", "151.37", "0", NewMoney(227, "JPY")},
+		{NewMoney(1000, "JPY"), "KWD", "0.00203", "0", NewMoney(2030, "KWD")},
+	}
+
+	for _, tc := range cases {
+		rate, err := ParseRate(tc.rate)
+		if err != nil {
+			t.Fatalf("rate %s: %v", tc.rate, err)
+		}
+		spread, err := ParseRate(tc.spread)
+		if err != nil {
+			t.Fatalf("spread %s: %v", tc.spread, err)
+		}
+
+		got, err := Convert(tc.amount, tc.to, rate, spread)
+		if err != nil {
+			t.Errorf("%+v: unexpected error: %v", tc.amount, err)
+			continue
+		}
+		if got != tc.want {
+			t.Errorf("%s %s at %s: expected %+v, got %+v", tc.amount, tc.amount.Currency, tc.rate, tc.want, got)
+		}
+	}
+}
+
+func TestConvert_Overflow(t *testing.T) {
+	_, err := Convert(NewMoney(1<<62, "USD"), "RUB", big.NewRat(100, 1), new(big.Rat))
+	if !errors.Is(err, ErrInvalidAmount) {
+		t.Errorf("expected invalid amount error, got %v", err)
+	}
+}
+
+func TestParseRate_Invalid(t *testing.T) {
+	for _, value := range []string{"", "-1", "1e3", "abc", "1.", "0.0000000000001"} {
+		if _, err := ParseRate(value); err == nil {
+			t.Errorf("expected error for %q", value)
+		}
+	}
+}
+
+func TestFormatRate(t *testing.T) {
+	cases := map[string]string{"92.500": "92.5", "1": "1", "0.0125": "0.0125", "0": "0"}
+
+	for value, want := range cases {
+		rate, err := ParseRate(value)
+		if err != nil {
+			t.Fatalf("%s: %v", value, err)
+		}
+		if got := FormatRate(rate); got != want {
+			t.Errorf("%s: expected %s, got %s", value, want, got)
+		}
+	}
+}
@@ -0,0 +1,118 @@
+package memory
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"walet_rest_api/internal/domain/wallet"
+
+	"github.com/google/uuid"
+)
+
+type quote struct {
+	wallet.Quote
+	used bool
+}
+
+func (s *Storage) SaveQuote(ctx context.Context, q *wallet.Quote) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, id := range []uuid.UUID{q.WalletID, q.ToWalletID} {
+		if _, ok := s.wallets[id]; !ok {
+			return fmt.Errorf("%w: quote references unknown wallet", wallet.ErrWalletNotFound)
+		}
+	}
+	if _, ok := s.quotes[q.ID]; ok {
+		return fmt.Errorf("failed to save quote: quote %v already exists", q.ID)
+	}
+
+	s.quotes[q.ID] = &quote{Quote: *q}
+
+	return nil
+}
+
+func (s *Storage) Exchange(ctx context.Context, dto *wallet.ExchangeDTO) (*wallet.Exchange, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	//Котировка помечается использованной только вместе с обменом: при ошибке
+	//обмена ее можно исполнить повторно, пока она не истекла
+	claimed, ok := s.quotes[dto.QuoteID]
+	switch {
+	case !ok:
+		return nil, fmt.Errorf("%w: %v", wallet.ErrQuoteNotFound, dto.QuoteID)
+	case claimed.used:
+		return nil, fmt.Errorf("%w: %v", wallet.ErrQuoteAlreadyUsed, dto.QuoteID)
+	case !claimed.ExpiresAt.After(time.Now()):
+		return nil, fmt.Errorf("%w: %v", wallet.ErrQuoteExpired, dto.QuoteID)
+	}
+	q := claimed.Quote
+
+	accounts, err := s.accounts(q.WalletID, q.ToWalletID)
+	if err != nil {
+		return nil, err
+	}
+
+	debit, ok := accounts[q.WalletID].balances[q.Debit.Currency]
+	if !ok {
+		return nil, currencyMismatch(q.WalletID, q.Debit.Currency)
+	}
+	credit, ok := accounts[q.ToWalletID].balances[q.Credit.Currency]
+	if !ok {
+		return nil, currencyMismatch(q.ToWalletID, q.Credit.Currency)
+	}
+
+	if debit.available() < q.Debit.Amount {
+		return nil, &wallet.WalletError{WalletID: q.WalletID, Err: wallet.ErrInsufficientFunds}
+	}
+
+	debit.amount -= q.Debit.Amount
+	if err := credit.credit(q.ToWalletID, q.Credit.Amount); err != nil {
+		debit.amount += q.Debit.Amount
+		return nil, err
+	}
+	for _, acc := range accounts {
+		acc.version++
+	}
+	claimed.used = true
+
+	result := &wallet.Exchange{
+		ID:    dto.ID,
+		Quote: q,
+		From:  wallet.Wallet{ID: q.WalletID, Balance: wallet.NewMoney(debit.amount, q.Debit.Currency)},
+		To:    wallet.Wallet{ID: q.ToWalletID, Balance: wallet.NewMoney(credit.amount, q.Credit.Currency)},
+	}
+
+	//Обмен внутри одного кошелька записывается без контрагента
+	var counterpartyOut, counterpartyIn *uuid.UUID
+	if q.WalletID != q.ToWalletID {
+		counterpartyOut, counterpartyIn = &q.ToWalletID, &q.WalletID
+	}
+
+	s.record(accounts[q.WalletID], wallet.Transaction{
+		WalletID:             q.WalletID,
+		OperationType:        "EXCHANGE_OUT",
+		Amount:               q.Debit,
+		BalanceAfter:         result.From.Balance,
+		ExchangeID:           &dto.ID,
+		CounterpartyWalletID: counterpartyOut,
+		Rate:                 &q.Rate,
+		Spread:               &q.Spread,
+		RateSource:           &q.Source,
+	})
+	s.record(accounts[q.ToWalletID], wallet.Transaction{
+		WalletID:             q.ToWalletID,
+		OperationType:        "EXCHANGE_IN",
+		Amount:               q.Credit,
+		BalanceAfter:         result.To.Balance,
+		ExchangeID:           &dto.ID,
+		CounterpartyWalletID: counterpartyIn,
+		Rate:                 &q.Rate,
+		Spread:               &q.Spread,
+		RateSource:           &q.Source,
+	})
+
+	return result, nil
+}
@@ -0,0 +1,160 @@
+package memory
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"walet_rest_api/internal/domain/wallet"
+
+	"github.com/google/uuid"
+)
+
+// Холд резервирует сумму в balance.held, как wallet_balances.held в db.WalletDB.
+// Баланс меняет только CAPTURE.
+
+func (s *Storage) AuthorizeHold(ctx context.Context, dto *wallet.HoldDTO) (*wallet.Hold, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	acc, err := s.account(dto.WalletID)
+	if err != nil {
+		return nil, err
+	}
+	b, ok := acc.balances[dto.Amount.Currency]
+	if !ok {
+		return nil, currencyMismatch(dto.WalletID, dto.Amount.Currency)
+	}
+	if b.available() < dto.Amount.Amount {
+		return nil, &wallet.WalletError{WalletID: dto.WalletID, Err: wallet.ErrInsufficientFunds}
+	}
+	if _, ok := s.holds[dto.ID]; ok {
+		return nil, fmt.Errorf("failed to authorize hold: hold %v already exists", dto.ID)
+	}
+
+	b.held += dto.Amount.Amount
+	acc.version++
+
+	now := time.Now()
+	hold := &wallet.Hold{
+		ID:        dto.ID,
+		WalletID:  dto.WalletID,
+		Amount:    dto.Amount,
+		Status:    wallet.HoldActive,
+		ExpiresAt: now.Add(dto.TTL),
+		CreatedAt: now,
+	}
+	s.holds[hold.ID] = hold
+
+	result := *hold
+	return &result, nil
+}
+
+func (s *Storage) CaptureHold(ctx context.Context, dto *wallet.CaptureDTO) (*wallet.Hold, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	hold, err := s.activeHold(dto.HoldID, true)
+	if err != nil {
+		return nil, err
+	}
+
+	captured := hold.Amount
+	if dto.Amount != nil {
+		if dto.Amount.Currency != hold.Amount.Currency {
+			return nil, fmt.Errorf("%w: hold %v is in %s, capture is in %s", wallet.ErrCurrencyMismatch, hold.ID, hold.Amount.Currency, dto.Amount.Currency)
+		}
+		if dto.Amount.Amount > hold.Amount.Amount {
+			return nil, fmt.Errorf("%w: capture of %s exceeds hold of %s", wallet.ErrInvalidAmount, dto.Amount, hold.Amount)
+		}
+		captured = *dto.Amount
+	}
+
+	//Списываем подтвержденную сумму и снимаем резерв целиком, остаток снова доступен
+	acc := s.wallets[hold.WalletID]
+	b := acc.balances[hold.Amount.Currency]
+	b.amount -= captured.Amount
+	b.held -= hold.Amount.Amount
+	acc.version++
+
+	s.record(acc, wallet.Transaction{
+		WalletID:      hold.WalletID,
+		OperationType: "CAPTURE",
+		Amount:        captured,
+		BalanceAfter:  wallet.NewMoney(b.amount, captured.Currency),
+		HoldID:        &hold.ID,
+	})
+
+	hold.Status = wallet.HoldCaptured
+	hold.Captured = &captured
+
+	result := *hold
+	return &result, nil
+}
+
+func (s *Storage) VoidHold(ctx context.Context, holdID uuid.UUID) (*wallet.Hold, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	//Просроченный, но еще не снятый холд можно отменить: это только освобождает резерв
+	hold, err := s.activeHold(holdID, false)
+	if err != nil {
+		return nil, err
+	}
+
+	acc := s.wallets[hold.WalletID]
+	acc.balances[hold.Amount.Currency].held -= hold.Amount.Amount
+	acc.version++
+
+	hold.Status = wallet.HoldVoided
+
+	result := *hold
+	return &result, nil
+}
+
+func (s *Storage) ExpireHolds(ctx context.Context) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	released := make(map[uuid.UUID]*account)
+
+	var expired int64
+	for _, hold := range s.holds {
+		if hold.Status != wallet.HoldActive || hold.ExpiresAt.After(now) {
+			continue
+		}
+
+		acc := s.wallets[hold.WalletID]
+		acc.balances[hold.Amount.Currency].held -= hold.Amount.Amount
+		released[hold.WalletID] = acc
+
+		hold.Status = wallet.HoldExpired
+		expired++
+	}
+
+	//Версия кошелька растет один раз, сколько бы его холдов ни истекло
+	for _, acc := range released {
+		acc.version++
+	}
+
+	return expired, nil
+}
+
+// activeHold возвращает активный холд. С rejectExpired холд с истекшим сроком
+// считается неактивным, даже если его еще не снял ExpireHolds.
+func (s *Storage) activeHold(holdID uuid.UUID, rejectExpired bool) (*wallet.Hold, error) {
+	hold, ok := s.holds[holdID]
+	if !ok {
+		return nil, fmt.Errorf("%w: %v", wallet.ErrHoldNotFound, holdID)
+	}
+
+	if hold.Status != wallet.HoldActive {
+		return nil, fmt.Errorf("%w: hold %v is %s", wallet.ErrHoldNotActive, holdID, hold.Status)
+	}
+	if rejectExpired && !hold.ExpiresAt.After(time.Now()) {
+		return nil, fmt.Errorf("%w: hold %v expired at %s", wallet.ErrHoldNotActive, holdID, hold.ExpiresAt.Format(time.RFC3339))
+	}
+
+	return hold, nil
+}
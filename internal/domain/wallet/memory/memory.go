@@ -0,0 +1,538 @@
+// Package memory хранит кошельки в памяти процесса. Хранилище повторяет поведение
+// db.WalletDB, но ничего не сохраняет между запусками: оно для демо, локальной
+// разработки и тестов, которым не нужна база.
+package memory
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"slices"
+	"sync"
+	"time"
+
+	"walet_rest_api/internal/domain/wallet"
+
+	"github.com/google/uuid"
+)
+
+// Storage - wallet.Storage в памяти. Все операции идут под одной блокировкой,
+// поэтому каждая из них атомарна, как транзакция в db.WalletDB.
+type Storage struct {
+	mu           sync.Mutex
+	wallets      map[uuid.UUID]*account
+	transactions map[uuid.UUID]*record
+	quotes       map[uuid.UUID]*quote
+	holds        map[uuid.UUID]*wallet.Hold
+	idempotency  map[string]idempotentResponse
+}
+
+type account struct {
+	currency string
+	version  int64
+	balances map[string]*balance
+	// history - записи истории в порядке создания, как seq в wallet_transactions
+	history []*record
+}
+
+// balance - баланс в одной валюте, held - сумма активных холдов.
+type balance struct {
+	amount int64
+	held   int64
+}
+
+type record struct {
+	tx wallet.Transaction
+	// reversed - сколько уже возвращено отменами, nil - отмен не было
+	reversed *int64
+}
+
+type idempotentResponse struct {
+	fingerprint string
+	wallet      wallet.Wallet
+}
+
+func New() *Storage {
+	return &Storage{
+		wallets:      make(map[uuid.UUID]*account),
+		transactions: make(map[uuid.UUID]*record),
+		quotes:       make(map[uuid.UUID]*quote),
+		holds:        make(map[uuid.UUID]*wallet.Hold),
+		idempotency:  make(map[string]idempotentResponse),
+	}
+}
+
+func (s *Storage) CreateWallet(ctx context.Context, dto *wallet.WalletCreateDTO) (*wallet.Wallet, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.wallets[dto.ID]; ok {
+		return nil, &wallet.WalletError{WalletID: dto.ID, Err: wallet.ErrWalletAlreadyExists}
+	}
+
+	acc := &account{
+		currency: dto.Balance.Currency,
+		version:  1,
+		balances: map[string]*balance{dto.Balance.Currency: {amount: dto.Balance.Amount}},
+	}
+	s.wallets[dto.ID] = acc
+
+	//Начальный баланс фиксируется в истории как DEPOSIT
+	if dto.Balance.IsPositive() {
+		s.record(acc, wallet.Transaction{WalletID: dto.ID, OperationType: "DEPOSIT", Amount: dto.Balance, BalanceAfter: dto.Balance})
+	}
+
+	return &wallet.Wallet{
+		ID:       dto.ID,
+		Version:  acc.version,
+		Currency: dto.Balance.Currency,
+		Balance:  dto.Balance,
+		Balances: []wallet.SubBalance{{Balance: dto.Balance, Available: dto.Balance}},
+	}, nil
+}
+
+func (s *Storage) OpenBalance(ctx context.Context, dto *wallet.OpenBalanceDTO) (*wallet.Wallet, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	acc, err := s.account(dto.WalletID)
+	if err != nil {
+		return nil, err
+	}
+	if _, ok := acc.balances[dto.Currency]; ok {
+		return nil, fmt.Errorf("%w: %s", wallet.ErrBalanceAlreadyExists, dto.Currency)
+	}
+
+	acc.balances[dto.Currency] = &balance{}
+	acc.version++
+
+	return s.getBalance(dto.WalletID.String())
+}
+
+func (s *Storage) ChangeBalance(ctx context.Context, dto *wallet.WalletChangeBalanceDTO) (*wallet.Wallet, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if dto.Idempotency == nil {
+		return s.changeBalance(dto)
+	}
+
+	//Ответ сохраняется только после успешной операции: при ошибке ключ остается
+	//свободным, повтор с тем же ключом выполнит операцию заново
+	if stored, ok := s.idempotency[dto.Idempotency.Key]; ok {
+		if stored.fingerprint != dto.Idempotency.Fingerprint {
+			return nil, fmt.Errorf("%w: %q", wallet.ErrIdempotencyKeyReused, dto.Idempotency.Key)
+		}
+		dto.Idempotency.Replayed = true
+		replayed := stored.wallet
+		return &replayed, nil
+	}
+
+	updated, err := s.changeBalance(dto)
+	if err != nil {
+		return nil, err
+	}
+
+	s.idempotency[dto.Idempotency.Key] = idempotentResponse{fingerprint: dto.Idempotency.Fingerprint, wallet: *updated}
+
+	return updated, nil
+}
+
+func (s *Storage) changeBalance(dto *wallet.WalletChangeBalanceDTO) (*wallet.Wallet, error) {
+	acc, err := s.account(dto.ID)
+	if err != nil {
+		return nil, err
+	}
+	if dto.ExpectedVersion != nil && *dto.ExpectedVersion != acc.version {
+		return nil, fmt.Errorf("%w: wallet %v is at version %d, expected %d", wallet.ErrVersionMismatch, dto.ID, acc.version, *dto.ExpectedVersion)
+	}
+	if dto.OperationType != "DEPOSIT" && dto.OperationType != "WITHDRAW" {
+		return nil, fmt.Errorf("%w: %s, expected DEPOSIT or WITHDRAW", wallet.ErrInvalidOperation, dto.OperationType)
+	}
+
+	b, ok := acc.balances[dto.Amount.Currency]
+	if !ok {
+		return nil, currencyMismatch(dto.ID, dto.Amount.Currency)
+	}
+
+	if dto.OperationType == "DEPOSIT" {
+		if err := b.credit(dto.ID, dto.Amount.Amount); err != nil {
+			return nil, err
+		}
+	} else {
+		//Списать можно только доступный баланс: зарезервированное холдами не трогаем
+		if b.available() < dto.Amount.Amount {
+			return nil, &wallet.WalletError{WalletID: dto.ID, Err: wallet.ErrInsufficientFunds}
+		}
+		b.amount -= dto.Amount.Amount
+	}
+	acc.version++
+
+	s.record(acc, wallet.Transaction{
+		WalletID:      dto.ID,
+		OperationType: dto.OperationType,
+		Amount:        dto.Amount,
+		BalanceAfter:  wallet.NewMoney(b.amount, dto.Amount.Currency),
+	})
+
+	return &wallet.Wallet{ID: dto.ID, Version: acc.version, Balance: wallet.NewMoney(b.amount, dto.Amount.Currency)}, nil
+}
+
+func (s *Storage) ChangeBalanceBatch(ctx context.Context, dto *wallet.BatchDTO) ([]wallet.BatchResult, error) {
+	results := make([]wallet.BatchResult, len(dto.Operations))
+
+	pending := 0
+	for i, op := range dto.Operations {
+		if op.OperationType != "DEPOSIT" && op.OperationType != "WITHDRAW" {
+			results[i].Err = fmt.Errorf("%w: %s, expected DEPOSIT or WITHDRAW", wallet.ErrInvalidOperation, op.OperationType)
+			continue
+		}
+		pending++
+	}
+
+	if pending < len(results) && dto.Atomic {
+		wallet.AbortBatch(results)
+		return results, nil
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var applied []*wallet.WalletChangeBalanceDTO
+	failed := false
+	for i, op := range dto.Operations {
+		if results[i].Err != nil {
+			continue
+		}
+
+		updated, err := s.changeBalance(op)
+		if err != nil {
+			results[i].Err = err
+			failed = true
+			//Переполнение обрывает транзакцию пакета в db.WalletDB, остальные
+			//операции атомарного пакета там уже не проверяются
+			if dto.Atomic && errors.Is(err, wallet.ErrInvalidAmount) {
+				break
+			}
+			continue
+		}
+		results[i].Wallet = updated
+		applied = append(applied, op)
+	}
+
+	if failed && dto.Atomic {
+		for _, op := range slices.Backward(applied) {
+			s.undoChange(op)
+		}
+		wallet.AbortBatch(results)
+	}
+
+	return results, nil
+}
+
+// undoChange откатывает последнюю успешную операцию changeBalance над кошельком.
+func (s *Storage) undoChange(op *wallet.WalletChangeBalanceDTO) {
+	acc := s.wallets[op.ID]
+	b := acc.balances[op.Amount.Currency]
+
+	if op.OperationType == "DEPOSIT" {
+		b.amount -= op.Amount.Amount
+	} else {
+		b.amount += op.Amount.Amount
+	}
+	acc.version--
+
+	last := acc.history[len(acc.history)-1]
+	acc.history = acc.history[:len(acc.history)-1]
+	delete(s.transactions, last.tx.ID)
+}
+
+// GetBalance возвращает кошелек со всеми балансами. Balance и Available - балансы
+// в основной валюте.
+func (s *Storage) GetBalance(ctx context.Context, walletID string) (*wallet.Wallet, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.getBalance(walletID)
+}
+
+func (s *Storage) getBalance(walletID string) (*wallet.Wallet, error) {
+	id, err := uuid.Parse(walletID)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", wallet.ErrWalletNotFound, walletID)
+	}
+	acc, ok := s.wallets[id]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", wallet.ErrWalletNotFound, walletID)
+	}
+
+	found := wallet.Wallet{ID: id, Version: acc.version, Currency: acc.currency}
+
+	currencies := make([]string, 0, len(acc.balances))
+	for currency := range acc.balances {
+		currencies = append(currencies, currency)
+	}
+	slices.Sort(currencies)
+
+	for _, currency := range currencies {
+		b := acc.balances[currency]
+		sub := wallet.SubBalance{
+			Balance:   wallet.NewMoney(b.amount, currency),
+			Available: wallet.NewMoney(b.available(), currency),
+		}
+		if currency == acc.currency {
+			found.Balance = sub.Balance
+			found.Available = &sub.Available
+		}
+		found.Balances = append(found.Balances, sub)
+	}
+
+	return &found, nil
+}
+
+func (s *Storage) ListTransactions(ctx context.Context, filter *wallet.TransactionFilter) (*wallet.TransactionPage, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	acc, err := s.account(filter.WalletID)
+	if err != nil {
+		return nil, err
+	}
+
+	//Курсор - id транзакции, страница начинается со следующей за ней записи
+	start, step := len(acc.history)-1, -1
+	if filter.Ascending {
+		start, step = 0, 1
+	}
+	if filter.After != nil {
+		cursor := slices.IndexFunc(acc.history, func(r *record) bool { return r.tx.ID == *filter.After })
+		if cursor < 0 {
+			return nil, fmt.Errorf("%w: transaction %v not found", wallet.ErrInvalidCursor, *filter.After)
+		}
+		start = cursor + step
+	}
+
+	page := &wallet.TransactionPage{Transactions: []wallet.Transaction{}}
+
+	//Берем на одну запись больше, чтобы понять, есть ли следующая страница
+	for i := start; i >= 0 && i < len(acc.history) && len(page.Transactions) <= filter.Limit; i += step {
+		r := acc.history[i]
+		if !r.matches(filter) {
+			continue
+		}
+
+		tx := r.tx
+		if r.reversed != nil {
+			tx.Reversed = &wallet.Money{Amount: *r.reversed, Currency: tx.Amount.Currency}
+		}
+		page.Transactions = append(page.Transactions, tx)
+	}
+
+	if len(page.Transactions) > filter.Limit {
+		page.Transactions = page.Transactions[:filter.Limit]
+		next := page.Transactions[filter.Limit-1].ID
+		page.NextCursor = &next
+	}
+
+	return page, nil
+}
+
+func (r *record) matches(filter *wallet.TransactionFilter) bool {
+	switch {
+	case filter.OperationType != "" && r.tx.OperationType != filter.OperationType:
+		return false
+	case filter.Currency != "" && r.tx.Amount.Currency != filter.Currency:
+		return false
+	case filter.From != nil && r.tx.CreatedAt.Before(*filter.From):
+		return false
+	case filter.To != nil && !r.tx.CreatedAt.Before(*filter.To):
+		return false
+	}
+	return true
+}
+
+func (s *Storage) Transfer(ctx context.Context, dto *wallet.TransferDTO) (*wallet.Transfer, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	accounts, err := s.accounts(dto.FromID, dto.ToID)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, id := range []uuid.UUID{dto.FromID, dto.ToID} {
+		if _, ok := accounts[id].balances[dto.Amount.Currency]; !ok {
+			return nil, currencyMismatch(id, dto.Amount.Currency)
+		}
+	}
+
+	from := accounts[dto.FromID].balances[dto.Amount.Currency]
+	to := accounts[dto.ToID].balances[dto.Amount.Currency]
+
+	//Для проверки списания берется доступный баланс, за вычетом холдов
+	if from.available() < dto.Amount.Amount {
+		return nil, &wallet.WalletError{WalletID: dto.FromID, Err: wallet.ErrInsufficientFunds}
+	}
+
+	from.amount -= dto.Amount.Amount
+	if err := to.credit(dto.ToID, dto.Amount.Amount); err != nil {
+		from.amount += dto.Amount.Amount
+		return nil, err
+	}
+	for _, acc := range accounts {
+		acc.version++
+	}
+
+	result := &wallet.Transfer{
+		ID:     dto.ID,
+		Amount: dto.Amount,
+		From:   wallet.Wallet{ID: dto.FromID, Version: accounts[dto.FromID].version, Balance: wallet.NewMoney(from.amount, dto.Amount.Currency)},
+		To:     wallet.Wallet{ID: dto.ToID, Version: accounts[dto.ToID].version, Balance: wallet.NewMoney(to.amount, dto.Amount.Currency)},
+	}
+
+	s.record(accounts[dto.FromID], wallet.Transaction{
+		WalletID:             dto.FromID,
+		OperationType:        "TRANSFER_OUT",
+		Amount:               dto.Amount,
+		BalanceAfter:         result.From.Balance,
+		TransferID:           &dto.ID,
+		CounterpartyWalletID: &dto.ToID,
+	})
+	s.record(accounts[dto.ToID], wallet.Transaction{
+		WalletID:             dto.ToID,
+		OperationType:        "TRANSFER_IN",
+		Amount:               dto.Amount,
+		BalanceAfter:         result.To.Balance,
+		TransferID:           &dto.ID,
+		CounterpartyWalletID: &dto.FromID,
+	})
+
+	return result, nil
+}
+
+// Отменить можно только DEPOSIT и WITHDRAW. Исходная запись не меняется:
+// отмена - новая запись с обратным движением и ссылкой ReversalOf.
+var reversalTypes = map[string]string{
+	"DEPOSIT":  "REVERSAL_OUT",
+	"WITHDRAW": "REVERSAL_IN",
+}
+
+func (s *Storage) ReverseTransaction(ctx context.Context, dto *wallet.ReversalDTO) (*wallet.Transaction, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	original, ok := s.transactions[dto.TransactionID]
+	if !ok {
+		return nil, fmt.Errorf("%w: %v", wallet.ErrTransactionNotFound, dto.TransactionID)
+	}
+
+	operationType, ok := reversalTypes[original.tx.OperationType]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s transactions cannot be reversed", wallet.ErrInvalidOperation, original.tx.OperationType)
+	}
+
+	var reversed int64
+	if original.reversed != nil {
+		reversed = *original.reversed
+	}
+	remaining := original.tx.Amount.Amount - reversed
+	if remaining <= 0 {
+		return nil, fmt.Errorf("%w: %v", wallet.ErrAlreadyReversed, dto.TransactionID)
+	}
+
+	amount := wallet.Money{Amount: remaining, Currency: original.tx.Amount.Currency}
+	if dto.Amount != nil {
+		if dto.Amount.Currency != original.tx.Amount.Currency {
+			return nil, fmt.Errorf("%w: transaction %v is in %s, reversal is in %s", wallet.ErrCurrencyMismatch, dto.TransactionID, original.tx.Amount.Currency, dto.Amount.Currency)
+		}
+		if dto.Amount.Amount > remaining {
+			return nil, fmt.Errorf("%w: only %s %s of transaction %v is left to reverse", wallet.ErrInvalidAmount, amount, amount.Currency, dto.TransactionID)
+		}
+		amount = *dto.Amount
+	}
+
+	walletID := original.tx.WalletID
+	acc := s.wallets[walletID]
+	b := acc.balances[amount.Currency]
+
+	//Отмена пополнения списывает деньги и, как WITHDRAW, не трогает зарезервированное холдами
+	if operationType == "REVERSAL_OUT" {
+		if b.available() < amount.Amount {
+			return nil, &wallet.WalletError{WalletID: walletID, Err: wallet.ErrInsufficientFunds}
+		}
+		b.amount -= amount.Amount
+	} else if err := b.credit(walletID, amount.Amount); err != nil {
+		return nil, err
+	}
+	acc.version++
+
+	reversed += amount.Amount
+	original.reversed = &reversed
+
+	reversal := s.record(acc, wallet.Transaction{
+		WalletID:      walletID,
+		OperationType: operationType,
+		Amount:        amount,
+		BalanceAfter:  wallet.NewMoney(b.amount, amount.Currency),
+		ReversalOf:    &dto.TransactionID,
+	})
+
+	return &reversal, nil
+}
+
+// account возвращает кошелек или ошибку, как lockWallet в db.WalletDB.
+func (s *Storage) account(walletID uuid.UUID) (*account, error) {
+	acc, ok := s.wallets[walletID]
+	if !ok {
+		return nil, &wallet.WalletError{WalletID: walletID, Err: wallet.ErrWalletNotFound}
+	}
+	return acc, nil
+}
+
+// accounts проверяет кошельки в порядке id, как lockWallets, поэтому из двух
+// ненайденных кошельков в ошибке будет тот же, что и у db.WalletDB.
+func (s *Storage) accounts(walletIDs ...uuid.UUID) (map[uuid.UUID]*account, error) {
+	sorted := slices.Clone(walletIDs)
+	slices.SortFunc(sorted, func(a, b uuid.UUID) int { return bytes.Compare(a[:], b[:]) })
+
+	accounts := make(map[uuid.UUID]*account, len(sorted))
+	for _, id := range slices.Compact(sorted) {
+		acc, err := s.account(id)
+		if err != nil {
+			return nil, err
+		}
+		accounts[id] = acc
+	}
+
+	return accounts, nil
+}
+
+// record добавляет запись в историю кошелька и возвращает ее с id и временем.
+func (s *Storage) record(acc *account, tx wallet.Transaction) wallet.Transaction {
+	tx.ID = uuid.New()
+	tx.CreatedAt = time.Now()
+
+	r := &record{tx: tx}
+	acc.history = append(acc.history, r)
+	s.transactions[tx.ID] = r
+
+	return tx
+}
+
+func (b *balance) available() int64 {
+	return b.amount - b.held
+}
+
+func (b *balance) credit(walletID uuid.UUID, amount int64) error {
+	if b.amount > math.MaxInt64-amount {
+		return fmt.Errorf("%w: balance of wallet %v would overflow", wallet.ErrInvalidAmount, walletID)
+	}
+	b.amount += amount
+	return nil
+}
+
+func currencyMismatch(walletID uuid.UUID, currency string) error {
+	return fmt.Errorf("%w: wallet %v holds no %s balance", wallet.ErrCurrencyMismatch, walletID, currency)
+}
@@ -0,0 +1,191 @@
+package memory
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"walet_rest_api/internal/domain/wallet"
+	"walet_rest_api/internal/domain/wallet/storagetest"
+
+	"github.com/google/uuid"
+)
+
+func rub(amount int64) wallet.Money {
+	return wallet.NewMoney(amount, wallet.DefaultCurrency)
+}
+
+func change(walletID uuid.UUID, operationType string, amount int64) *wallet.WalletChangeBalanceDTO {
+	return &wallet.WalletChangeBalanceDTO{ID: walletID, OperationType: operationType, Amount: rub(amount)}
+}
+
+func createWallet(t *testing.T, storage *Storage, balance int64) uuid.UUID {
+	t.Helper()
+	created, err := storage.CreateWallet(context.Background(), &wallet.WalletCreateDTO{ID: uuid.New(), Balance: rub(balance)})
+	if err != nil {
+		t.Fatalf("failed to create wallet: %v", err)
+	}
+	return created.ID
+}
+
+func TestStorage_Conformance(t *testing.T) {
+	storagetest.Run(t, func(t *testing.T) wallet.Storage { return New() })
+}
+
+func TestStorage_ChangeBalance_Idempotent(t *testing.T) {
+	storage := New()
+	walletID := createWallet(t, storage, 100)
+	ctx := context.Background()
+
+	dto := change(walletID, "DEPOSIT", 50)
+	dto.Idempotency = &wallet.IdempotencyKey{Key: "key", Fingerprint: "a"}
+	if _, err := storage.ChangeBalance(ctx, dto); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	replay := change(walletID, "DEPOSIT", 50)
+	replay.Idempotency = &wallet.IdempotencyKey{Key: "key", Fingerprint: "a"}
+	replayed, err := storage.ChangeBalance(ctx, replay)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !replay.Idempotency.Replayed || replayed.Balance.Amount != 150 || replayed.Version != 2 {
+		t.Errorf("expected stored response, got %+v, replayed %t", replayed, replay.Idempotency.Replayed)
+	}
+
+	conflict := change(walletID, "DEPOSIT", 60)
+	conflict.Idempotency = &wallet.IdempotencyKey{Key: "key", Fingerprint: "b"}
+	if _, err := storage.ChangeBalance(ctx, conflict); !errors.Is(err, wallet.ErrIdempotencyKeyReused) {
+		t.Errorf("expected reused key error, got %v", err)
+	}
+
+	found, _ := storage.GetBalance(ctx, walletID.String())
+	if found.Balance.Amount != 150 {
+		t.Errorf("expected deposit to be applied once, balance is %d", found.Balance.Amount)
+	}
+}
+
+func TestStorage_ChangeBalanceBatch_AtomicRollsBack(t *testing.T) {
+	storage := New()
+	walletID := createWallet(t, storage, 100)
+	ctx := context.Background()
+
+	results, err := storage.ChangeBalanceBatch(ctx, &wallet.BatchDTO{Atomic: true, Operations: []*wallet.WalletChangeBalanceDTO{
+		change(walletID, "DEPOSIT", 50),
+		change(walletID, "WITHDRAW", 500),
+	}})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !errors.Is(results[0].Err, wallet.ErrBatchAborted) || !errors.Is(results[1].Err, wallet.ErrInsufficientFunds) {
+		t.Fatalf("expected aborted batch, got %+v", results)
+	}
+
+	found, _ := storage.GetBalance(ctx, walletID.String())
+	if found.Balance.Amount != 100 || found.Version != 1 {
+		t.Errorf("expected untouched wallet, got balance %d version %d", found.Balance.Amount, found.Version)
+	}
+	page, _ := storage.ListTransactions(ctx, &wallet.TransactionFilter{WalletID: walletID, Limit: 10})
+	if len(page.Transactions) != 1 {
+		t.Errorf("expected only the opening deposit in history, got %d records", len(page.Transactions))
+	}
+}
+
+func TestStorage_ListTransactions_Pages(t *testing.T) {
+	storage := New()
+	walletID := createWallet(t, storage, 0)
+	ctx := context.Background()
+
+	for amount := int64(1); amount <= 3; amount++ {
+		if _, err := storage.ChangeBalance(ctx, change(walletID, "DEPOSIT", amount)); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+
+	first, err := storage.ListTransactions(ctx, &wallet.TransactionFilter{WalletID: walletID, Limit: 2})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(first.Transactions) != 2 || first.Transactions[0].Amount.Amount != 3 || first.NextCursor == nil {
+		t.Fatalf("expected newest two deposits and a cursor, got %+v", first)
+	}
+
+	second, err := storage.ListTransactions(ctx, &wallet.TransactionFilter{WalletID: walletID, Limit: 2, After: first.NextCursor})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(second.Transactions) != 1 || second.Transactions[0].Amount.Amount != 1 || second.NextCursor != nil {
+		t.Errorf("expected the oldest deposit on the last page, got %+v", second)
+	}
+
+	unknown := uuid.New()
+	if _, err := storage.ListTransactions(ctx, &wallet.TransactionFilter{WalletID: walletID, Limit: 2, After: &unknown}); !errors.Is(err, wallet.ErrInvalidCursor) {
+		t.Errorf("expected invalid cursor error, got %v", err)
+	}
+}
+
+func TestStorage_Holds_ReserveAvailableBalance(t *testing.T) {
+	storage := New()
+	walletID := createWallet(t, storage, 100)
+	ctx := context.Background()
+
+	hold, err := storage.AuthorizeHold(ctx, &wallet.HoldDTO{ID: uuid.New(), WalletID: walletID, Amount: rub(80), TTL: time.Hour})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if _, err := storage.ChangeBalance(ctx, change(walletID, "WITHDRAW", 30)); !errors.Is(err, wallet.ErrInsufficientFunds) {
+		t.Errorf("expected held funds to be unavailable, got %v", err)
+	}
+
+	partial := rub(50)
+	captured, err := storage.CaptureHold(ctx, &wallet.CaptureDTO{HoldID: hold.ID, Amount: &partial})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if captured.Status != wallet.HoldCaptured || captured.Captured.Amount != 50 {
+		t.Errorf("expected captured hold, got %+v", captured)
+	}
+
+	found, _ := storage.GetBalance(ctx, walletID.String())
+	if found.Balance.Amount != 50 || found.Available.Amount != 50 {
+		t.Errorf("expected balance and available of 50, got %d and %d", found.Balance.Amount, found.Available.Amount)
+	}
+	if _, err := storage.VoidHold(ctx, hold.ID); !errors.Is(err, wallet.ErrHoldNotActive) {
+		t.Errorf("expected captured hold to be inactive, got %v", err)
+	}
+}
+
+func TestStorage_ReverseTransaction(t *testing.T) {
+	storage := New()
+	walletID := createWallet(t, storage, 0)
+	ctx := context.Background()
+
+	if _, err := storage.ChangeBalance(ctx, change(walletID, "DEPOSIT", 100)); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	page, _ := storage.ListTransactions(ctx, &wallet.TransactionFilter{WalletID: walletID, Limit: 1})
+	deposit := page.Transactions[0].ID
+
+	partial := rub(40)
+	reversal, err := storage.ReverseTransaction(ctx, &wallet.ReversalDTO{TransactionID: deposit, Amount: &partial})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if reversal.OperationType != "REVERSAL_OUT" || reversal.BalanceAfter.Amount != 60 {
+		t.Errorf("unexpected reversal %+v", reversal)
+	}
+
+	if _, err := storage.ReverseTransaction(ctx, &wallet.ReversalDTO{TransactionID: deposit}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, err := storage.ReverseTransaction(ctx, &wallet.ReversalDTO{TransactionID: deposit}); !errors.Is(err, wallet.ErrAlreadyReversed) {
+		t.Errorf("expected already reversed error, got %v", err)
+	}
+
+	page, _ = storage.ListTransactions(ctx, &wallet.TransactionFilter{WalletID: walletID, Limit: 10, OperationType: "DEPOSIT"})
+	if reversed := page.Transactions[0].Reversed; reversed == nil || reversed.Amount != 100 {
+		t.Errorf("expected deposit to be fully reversed, got %v", reversed)
+	}
+}
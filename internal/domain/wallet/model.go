@@ -1,14 +1,228 @@
 package wallet
 
-import "github.com/google/uuid"
+import (
+	"fmt"
+	"time"
 
+	"github.com/google/uuid"
+)
+
+const (
+	DefaultTransactionsLimit = 20
+	MaxTransactionsLimit = 100
+	MaxBatchSize = 500
+)
+
+// Wallet - кошелек с балансами в нескольких валютах. Currency - основная валюта,
+// выбранная при создании. Balance - баланс в валюте операции (для чтения - в
+// основной валюте), Available - баланс за вычетом активных холдов, заполняется
+// при чтении. Balances - все балансы кошелька. Version растет с каждым
+// изменением любого баланса кошелька.
 type Wallet struct {
 	ID uuid.UUID `json:"wallet_id"`
-	Balance int `json:"balance"`
+	Version int64 `json:"version,omitempty"`
+	Currency string `json:"currency,omitempty"`
+	Balance Money `json:"balance"`
+	Available *Money `json:"available,omitempty"`
+	Balances []SubBalance `json:"balances,omitempty"`
+}
+
+type SubBalance struct {
+	Balance Money `json:"balance"`
+	Available Money `json:"available"`
 }
 
 type WalletChangeBalanceDTO struct {
 	ID uuid.UUID `json:"wallet_id" binding:"required"`
 	OperationType string `json:"operationType" binding:"required"`
-	Balance int `json:"balance"`
+	Amount Money `json:"amount"`
+	Idempotency *IdempotencyKey `json:"-"`
+	// ExpectedVersion - версия кошелька, от которой клиент считал сумму. Если
+	// кошелек с тех пор изменился, операция отклоняется с ErrVersionMismatch
+	ExpectedVersion *int64 `json:"-"`
+}
+
+// BatchDTO - пакет изменений баланса, операции применяются в порядке пакета.
+// Atomic пакет применяется целиком или не применяется совсем, без Atomic каждая
+// операция применяется или отклоняется независимо от остальных.
+type BatchDTO struct {
+	Atomic bool
+	Operations []*WalletChangeBalanceDTO
+}
+
+// BatchResult - итог операции пакета: Wallet при успехе, Err при отказе. Когда
+// атомарный пакет откатывается, успешные операции получают ErrBatchAborted.
+type BatchResult struct {
+	Wallet *Wallet
+	Err error
+}
+
+// IdempotencyKey привязывает изменение баланса к ключу клиента. Fingerprint -
+// отпечаток тела запроса, Replayed выставляет Storage, когда вместо повторной
+// операции вернулся сохраненный ранее результат.
+type IdempotencyKey struct {
+	Key string
+	Fingerprint string
+	Replayed bool
+}
+
+type WalletCreateDTO struct {
+	ID uuid.UUID `json:"wallet_id"`
+	Balance Money `json:"balance"`
+}
+
+type OpenBalanceDTO struct {
+	WalletID uuid.UUID `json:"wallet_id"`
+	Currency string `json:"currency"`
+}
+
+// Transaction - запись истории. ReversalOf связывает компенсирующую запись с
+// исходной, Reversed - сколько исходной операции уже возвращено.
+type Transaction struct {
+	ID uuid.UUID `json:"id"`
+	WalletID uuid.UUID `json:"wallet_id"`
+	OperationType string `json:"operation_type"`
+	Amount Money `json:"amount"`
+	BalanceAfter Money `json:"balance_after"`
+	TransferID *uuid.UUID `json:"transfer_id,omitempty"`
+	CounterpartyWalletID *uuid.UUID `json:"counterparty_wallet_id,omitempty"`
+	ExchangeID *uuid.UUID `json:"exchange_id,omitempty"`
+	HoldID *uuid.UUID `json:"hold_id,omitempty"`
+	ReversalOf *uuid.UUID `json:"reversal_of,omitempty"`
+	Reversed *Money `json:"reversed,omitempty"`
+	Rate *string `json:"rate,omitempty"`
+	Spread *string `json:"spread,omitempty"`
+	RateSource *string `json:"rate_source,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// TransactionFilter задает выборку истории кошелька. After - id последней
+// полученной транзакции (курсор), следующая страница начинается после нее.
+type TransactionFilter struct {
+	WalletID uuid.UUID
+	After *uuid.UUID
+	Limit int
+	OperationType string
+	Currency string
+	From *time.Time
+	To *time.Time
+	Ascending bool
+}
+
+type TransactionPage struct {
+	Transactions []Transaction `json:"transactions"`
+	NextCursor *uuid.UUID `json:"next_cursor,omitempty"`
+}
+
+type TransferDTO struct {
+	ID uuid.UUID `json:"transfer_id"`
+	FromID uuid.UUID `json:"from_wallet_id"`
+	ToID uuid.UUID `json:"to_wallet_id"`
+	Amount Money `json:"amount"`
+}
+
+type Transfer struct {
+	ID uuid.UUID `json:"transfer_id"`
+	Amount Money `json:"amount"`
+	From Wallet `json:"from"`
+	To Wallet `json:"to"`
+}
+
+// Quote - зафиксированный курс обмена: Debit списывается с WalletID, Credit
+// зачисляется на ToWalletID. До ExpiresAt обмен по котировке идет ровно на эти суммы.
+type Quote struct {
+	ID uuid.UUID `json:"quote_id"`
+	WalletID uuid.UUID `json:"wallet_id"`
+	ToWalletID uuid.UUID `json:"to_wallet_id"`
+	Debit Money `json:"debit"`
+	Credit Money `json:"credit"`
+	Rate string `json:"rate"`
+	Spread string `json:"spread"`
+	Source string `json:"source"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// QuoteDTO - запрос котировки. Amount списывается в своей валюте, зачисление
+// идет в ToCurrency. Без ToWalletID обмен идет внутри кошелька WalletID.
+type QuoteDTO struct {
+	WalletID uuid.UUID
+	ToWalletID uuid.UUID
+	Amount Money
+	ToCurrency string
+}
+
+// ExchangeDTO - обмен по котировке QuoteID. Без QuoteID котировка берется по
+// текущему курсу из Quote и сразу исполняется.
+type ExchangeDTO struct {
+	ID uuid.UUID
+	QuoteID uuid.UUID
+	Quote *QuoteDTO
+}
+
+type Exchange struct {
+	ID uuid.UUID `json:"exchange_id"`
+	Quote Quote `json:"quote"`
+	From Wallet `json:"from"`
+	To Wallet `json:"to"`
+}
+
+const (
+	HoldActive   = "ACTIVE"
+	HoldCaptured = "CAPTURED"
+	HoldVoided   = "VOIDED"
+	HoldExpired  = "EXPIRED"
+)
+
+const (
+	DefaultHoldTTL = 7 * 24 * time.Hour
+	MaxHoldTTL     = 30 * 24 * time.Hour
+)
+
+// Hold - резерв средств: уменьшает доступный баланс, но не баланс кошелька.
+// Captured - списанная при подтверждении сумма.
+type Hold struct {
+	ID uuid.UUID `json:"hold_id"`
+	WalletID uuid.UUID `json:"wallet_id"`
+	Amount Money `json:"amount"`
+	Captured *Money `json:"captured,omitempty"`
+	Status string `json:"status"`
+	ExpiresAt time.Time `json:"expires_at"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+type HoldDTO struct {
+	ID uuid.UUID
+	WalletID uuid.UUID
+	Amount Money
+	TTL time.Duration
+}
+
+// CaptureDTO подтверждает холд. Без Amount списывается вся сумма холда,
+// остаток частичного подтверждения возвращается в доступный баланс.
+type CaptureDTO struct {
+	HoldID uuid.UUID
+	Amount *Money
+}
+
+// ReversalDTO отменяет DEPOSIT или WITHDRAW компенсирующей записью. Без Amount
+// возвращается вся еще не возвращенная сумма.
+type ReversalDTO struct {
+	TransactionID uuid.UUID
+	Amount *Money
+}
+
+// LedgerViolation - нарушение инварианта двойной записи. Без WalletID сумма всех
+// проводок в валюте не равна нулю, с WalletID баланс кошелька расходится с его
+// проводками. Expected - что должно быть по проводкам, Actual - что есть.
+type LedgerViolation struct {
+	WalletID *uuid.UUID
+	Expected Money
+	Actual Money
+}
+
+func (v LedgerViolation) String() string {
+	if v.WalletID == nil {
+		return fmt.Sprintf("postings in %s sum to %s instead of zero", v.Actual.Currency, v.Actual)
+	}
+	return fmt.Sprintf("wallet %v %s balance is %s, postings sum to %s", *v.WalletID, v.Actual.Currency, v.Actual, v.Expected)
 }
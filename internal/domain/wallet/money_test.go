@@ -0,0 +1,100 @@
+package wallet
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+)
+
+func TestParseMoney(t *testing.T) {
+	cases := []struct {
+		amount   string
+		currency string
+		minor    int64
+	}{
+		{"12.34", "RUB", 1234},
+		{"12", "RUB", 1200},
+		{"0.5", "USD", 50},
+		{"10.100", "EUR", 1010},
+		{"1500", "JPY", 1500},
+		{"1.234", "KWD", 1234},
+		{"-7.01", "RUB", -701},
+		{"92233720368547758.07", "RUB", 9223372036854775807},
+	}
+
+	for _, tc := range cases {
+		m, err := ParseMoney(tc.amount, tc.currency)
+		if err != nil {
+			t.Errorf("%s %s: unexpected error: %v", tc.amount, tc.currency, err)
+			continue
+		}
+		if m.Amount != tc.minor || m.Currency != tc.currency {
+			t.Errorf("%s %s: expected %d, got %+v", tc.amount, tc.currency, tc.minor, m)
+		}
+	}
+}
+
+func TestParseMoney_Invalid(t *testing.T) {
+	cases := []struct {
+		amount   string
+		currency string
+		err      error
+	}{
+		{"12.345", "RUB", ErrInvalidAmount},
+		{"1.5", "JPY", ErrInvalidAmount},
+		{"abc", "RUB", ErrInvalidAmount},
+		{"1.", "RUB", ErrInvalidAmount},
+		{".5", "RUB", ErrInvalidAmount},
+		{"1e3", "RUB", ErrInvalidAmount},
+		{"", "RUB", ErrInvalidAmount},
+		{"92233720368547758.08", "RUB", ErrInvalidAmount},
+		{"10", "XXX", ErrUnsupportedCurrency},
+	}
+
+	for _, tc := range cases {
+		_, err := ParseMoney(tc.amount, tc.currency)
+		if !errors.Is(err, tc.err) {
+			t.Errorf("%q %s: expected %v, got %v", tc.amount, tc.currency, tc.err, err)
+		}
+	}
+}
+
+func TestMoney_String(t *testing.T) {
+	cases := []struct {
+		money    Money
+		expected string
+	}{
+		{NewMoney(1234, "RUB"), "12.34"},
+		{NewMoney(5, "USD"), "0.05"},
+		{NewMoney(0, "EUR"), "0.00"},
+		{NewMoney(-701, "RUB"), "-7.01"},
+		{NewMoney(1500, "JPY"), "1500"},
+		{NewMoney(1234, "KWD"), "1.234"},
+	}
+
+	for _, tc := range cases {
+		if got := tc.money.String(); got != tc.expected {
+			t.Errorf("%+v: expected %s, got %s", tc.money, tc.expected, got)
+		}
+	}
+}
+
+func TestMoney_JSONRoundTrip(t *testing.T) {
+	original := NewMoney(100050, "EUR")
+
+	data, err := json.Marshal(original)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if string(data) != `{"amount":"1000.50","currency":"EUR"}` {
+		t.Errorf("unexpected json: %s", data)
+	}
+
+	var decoded Money
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if decoded != original {
+		t.Errorf("expected %+v, got %+v", original, decoded)
+	}
+}
@@ -0,0 +1,104 @@
+// Package rates содержит источники курсов обмена для wallet.RateProvider.
+package rates
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"os"
+	"strings"
+
+	"walet_rest_api/internal/domain/wallet"
+)
+
+// Static отдает курсы из фиксированной таблицы. Подходит для тестов и окружений
+// без доступа к внешнему источнику курсов.
+type Static struct {
+	source string
+	rates  map[string]*big.Rat
+}
+
+// NewStatic строит таблицу курсов. Ключ - пара "USD/RUB", значение - сколько RUB
+// дают за 1 USD. Обратный курс считается автоматически, если не задан явно.
+func NewStatic(source string, rates map[string]string) (*Static, error) {
+	s := &Static{source: source, rates: make(map[string]*big.Rat, len(rates)*2)}
+
+	for pair, value := range rates {
+		from, to, ok := strings.Cut(pair, "/")
+		if !ok {
+			return nil, fmt.Errorf("rate pair %q must look like USD/RUB", pair)
+		}
+		for _, currency := range []string{from, to} {
+			if err := wallet.ValidateCurrency(currency); err != nil {
+				return nil, fmt.Errorf("rate pair %q: %w", pair, err)
+			}
+		}
+		if from == to {
+			return nil, fmt.Errorf("rate pair %q must use different currencies", pair)
+		}
+
+		rate, err := wallet.ParseRate(value)
+		if err != nil {
+			return nil, fmt.Errorf("rate %s: %w", pair, err)
+		}
+		if rate.Sign() <= 0 {
+			return nil, fmt.Errorf("rate %s must be positive", pair)
+		}
+
+		s.rates[key(from, to)] = rate
+	}
+
+	for pair, rate := range s.rates {
+		from, to, _ := strings.Cut(pair, "/")
+		if _, ok := s.rates[key(to, from)]; !ok {
+			s.rates[key(to, from)] = wallet.RoundRate(new(big.Rat).Inv(rate))
+		}
+	}
+
+	return s, nil
+}
+
+type rateFile struct {
+	Source string            `json:"source"`
+	Rates  map[string]string `json:"rates"`
+}
+
+// LoadFile читает таблицу курсов из JSON-файла вида
+// {"source": "cbr-2024-06-01", "rates": {"USD/RUB": "89.50"}}.
+func LoadFile(path string) (*Static, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read rates file: %w", err)
+	}
+
+	var file rateFile
+	if err := json.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("failed to parse rates file %s: %w", path, err)
+	}
+
+	source := file.Source
+	if source == "" {
+		source = "file:" + path
+	}
+
+	return NewStatic(source, file.Rates)
+}
+
+func (s *Static) Rate(ctx context.Context, from, to string) (*wallet.ExchangeRate, error) {
+	rate, ok := s.rates[key(from, to)]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s/%s", wallet.ErrRateUnavailable, from, to)
+	}
+
+	return &wallet.ExchangeRate{
+		From:   from,
+		To:     to,
+		Rate:   new(big.Rat).Set(rate),
+		Source: s.source,
+	}, nil
+}
+
+func key(from, to string) string {
+	return from + "/" + to
+}
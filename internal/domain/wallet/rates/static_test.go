@@ -0,0 +1,76 @@
+package rates
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"walet_rest_api/internal/domain/wallet"
+)
+
+func TestStatic_Rate(t *testing.T) {
+	provider, err := NewStatic("test", map[string]string{"USD/RUB": "80"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	direct, err := provider.Rate(context.Background(), "USD", "RUB")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if wallet.FormatRate(direct.Rate) != "80" || direct.Source != "test" {
+		t.Errorf("unexpected direct rate: %+v", direct)
+	}
+
+	inverse, err := provider.Rate(context.Background(), "RUB", "USD")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got := wallet.FormatRate(inverse.Rate); got != "0.0125" {
+		t.Errorf("expected inverse rate 0.0125, got %s", got)
+	}
+
+	_, err = provider.Rate(context.Background(), "USD", "EUR")
+	if !errors.Is(err, wallet.ErrRateUnavailable) {
+		t.Errorf("expected rate unavailable error, got %v", err)
+	}
+}
+
+func TestNewStatic_Invalid(t *testing.T) {
+	cases := []map[string]string{
+		{"USDRUB": "80"},
+		{"USD/XXX": "80"},
+		{"USD/USD": "1"},
+		{"USD/RUB": "-80"},
+		{"USD/RUB": "0"},
+		{"USD/RUB": "eighty"},
+	}
+
+	for _, rates := range cases {
+		if _, err := NewStatic("test", rates); err == nil {
+			t.Errorf("expected error for %v", rates)
+		}
+	}
+}
+
+func TestLoadFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "rates.json")
+	if err := os.WriteFile(path, []byte(`{"source":"cbr","rates":{"EUR/RUB":"90.5"}}`), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	provider, err := LoadFile(path)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	rate, err := provider.Rate(context.Background(), "EUR", "RUB")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if wallet.FormatRate(rate.Rate) != "90.5" || rate.Source != "cbr" {
+		t.Errorf("unexpected rate: %+v", rate)
+	}
+}
@@ -2,25 +2,322 @@ package wallet
 
 import (
 	"context"
+	"fmt"
+	"math/big"
+	"sync/atomic"
+	"time"
+
+	"github.com/google/uuid"
 )
 
 type Service interface {
+	CreateWallet(ctx context.Context, dto *WalletCreateDTO) (*Wallet, error)
+	OpenBalance(ctx context.Context, dto *OpenBalanceDTO) (*Wallet, error)
 	ChangeBalanceWallet(ctx context.Context, dto *WalletChangeBalanceDTO) (*Wallet, error)
-	GetBalanceWalletByWalletID(ctx context.Context, walletID string) (int, error)
+	ChangeBalanceBatch(ctx context.Context, dto *BatchDTO) ([]BatchResult, error)
+	GetBalanceWalletByWalletID(ctx context.Context, walletID string) (*Wallet, error)
+	ListTransactions(ctx context.Context, filter *TransactionFilter) (*TransactionPage, error)
+	Transfer(ctx context.Context, dto *TransferDTO) (*Transfer, error)
+	QuoteExchange(ctx context.Context, dto *QuoteDTO) (*Quote, error)
+	Exchange(ctx context.Context, dto *ExchangeDTO) (*Exchange, error)
+	AuthorizeHold(ctx context.Context, dto *HoldDTO) (*Hold, error)
+	CaptureHold(ctx context.Context, dto *CaptureDTO) (*Hold, error)
+	VoidHold(ctx context.Context, holdID uuid.UUID) (*Hold, error)
+	ExpireHolds(ctx context.Context) (int64, error)
+	ReverseTransaction(ctx context.Context, dto *ReversalDTO) (*Transaction, error)
+}
+
+// Limits - ограничения операций, которые меняются без перезапуска.
+type Limits struct {
+	// Наибольшее число операций в пакете, не больше MaxBatchSize
+	MaxBatchSize int
+	// Наибольшая сумма одной операции в минимальных единицах по валютам.
+	// Валюты без записи не ограничены
+	MaxAmount map[string]int64
+}
+
+// LimitSetter заменяет ограничения операций. Запросы, которые уже идут,
+// дорабатывают со старыми ограничениями.
+type LimitSetter interface {
+	SetLimits(limits Limits)
 }
 
 type service struct {
-	storage Storage
+	storage  Storage
+	exchange ExchangeConfig
+	limits   atomic.Pointer[Limits]
+}
+
+func (s *service) SetLimits(limits Limits) {
+	if limits.MaxBatchSize <= 0 || limits.MaxBatchSize > MaxBatchSize {
+		limits.MaxBatchSize = MaxBatchSize
+	}
+	s.limits.Store(&limits)
+}
+
+// checkAmount отклоняет сумму больше предела ее валюты.
+func (s *service) checkAmount(amount Money) error {
+	limit, ok := s.limits.Load().MaxAmount[amount.Currency]
+	if ok && amount.Amount > limit {
+		return fmt.Errorf("%w: amount %s %s exceeds the limit of %s", ErrLimitExceeded, amount, amount.Currency, NewMoney(limit, amount.Currency))
+	}
+	return nil
+}
+
+func (s *service) CreateWallet(ctx context.Context, dto *WalletCreateDTO) (*Wallet, error) {
+	if dto.ID == uuid.Nil {
+		dto.ID = uuid.New()
+	}
+	if dto.Balance.Currency == "" {
+		dto.Balance.Currency = DefaultCurrency
+	}
+	if err := ValidateCurrency(dto.Balance.Currency); err != nil {
+		return nil, err
+	}
+	if dto.Balance.Amount < 0 {
+		return nil, fmt.Errorf("%w: opening balance must not be negative", ErrInvalidAmount)
+	}
+
+	return s.storage.CreateWallet(ctx, dto)
+}
+
+func (s *service) OpenBalance(ctx context.Context, dto *OpenBalanceDTO) (*Wallet, error) {
+	if err := ValidateCurrency(dto.Currency); err != nil {
+		return nil, err
+	}
+
+	return s.storage.OpenBalance(ctx, dto)
 }
 
 func (s *service) ChangeBalanceWallet(ctx context.Context, dto *WalletChangeBalanceDTO) (*Wallet, error) {
+	if err := s.validateChange(dto); err != nil {
+		return nil, err
+	}
+
 	return s.storage.ChangeBalance(ctx, dto)
 }
 
-func (s *service) GetBalanceWalletByWalletID(ctx context.Context, walletID string) (int, error) {
+func (s *service) ChangeBalanceBatch(ctx context.Context, dto *BatchDTO) ([]BatchResult, error) {
+	maxSize := s.limits.Load().MaxBatchSize
+	if len(dto.Operations) == 0 || len(dto.Operations) > maxSize {
+		return nil, fmt.Errorf("%w: batch must contain from 1 to %d operations", ErrInvalidOperation, maxSize)
+	}
+
+	results := make([]BatchResult, len(dto.Operations))
+	valid := &BatchDTO{Atomic: dto.Atomic}
+	index := make([]int, 0, len(dto.Operations))
+
+	for i, op := range dto.Operations {
+		if err := s.validateChange(op); err != nil {
+			results[i].Err = err
+			continue
+		}
+		valid.Operations = append(valid.Operations, op)
+		index = append(index, i)
+	}
+
+	//Атомарный пакет с невалидной операцией отклоняется, не доходя до хранилища
+	if len(index) < len(results) && dto.Atomic {
+		AbortBatch(results)
+		return results, nil
+	}
+	if len(index) == 0 {
+		return results, nil
+	}
+
+	applied, err := s.storage.ChangeBalanceBatch(ctx, valid)
+	if err != nil {
+		return nil, err
+	}
+	for k, i := range index {
+		results[i] = applied[k]
+	}
+
+	return results, nil
+}
+
+func (s *service) validateChange(dto *WalletChangeBalanceDTO) error {
+	if dto.OperationType != "DEPOSIT" && dto.OperationType != "WITHDRAW" {
+		return fmt.Errorf("%w: %s, expected DEPOSIT or WITHDRAW", ErrInvalidOperation, dto.OperationType)
+	}
+	if !dto.Amount.IsPositive() {
+		return fmt.Errorf("%w: amount must be positive", ErrInvalidAmount)
+	}
+	return s.checkAmount(dto.Amount)
+}
+
+// AbortBatch помечает успешные операции откатываемого атомарного пакета, отказы
+// остаются как есть.
+func AbortBatch(results []BatchResult) {
+	for i := range results {
+		if results[i].Err == nil {
+			results[i] = BatchResult{Err: ErrBatchAborted}
+		}
+	}
+}
+
+func (s *service) GetBalanceWalletByWalletID(ctx context.Context, walletID string) (*Wallet, error) {
+	if _, err := uuid.Parse(walletID); err != nil {
+		return nil, fmt.Errorf("%w: %q", ErrInvalidWalletID, walletID)
+	}
+
 	return s.storage.GetBalance(ctx, walletID)
 }
 
-func NewService(storage Storage) Service {
-	return &service{storage: storage}
+func (s *service) ListTransactions(ctx context.Context, filter *TransactionFilter) (*TransactionPage, error) {
+	if filter.Limit <= 0 {
+		filter.Limit = DefaultTransactionsLimit
+	}
+	if filter.Limit > MaxTransactionsLimit {
+		filter.Limit = MaxTransactionsLimit
+	}
+
+	return s.storage.ListTransactions(ctx, filter)
+}
+
+func (s *service) Transfer(ctx context.Context, dto *TransferDTO) (*Transfer, error) {
+	if dto.FromID == dto.ToID {
+		return nil, fmt.Errorf("%w: source and destination wallets must differ", ErrInvalidOperation)
+	}
+	if !dto.Amount.IsPositive() {
+		return nil, fmt.Errorf("%w: transfer amount must be positive", ErrInvalidAmount)
+	}
+	if err := s.checkAmount(dto.Amount); err != nil {
+		return nil, err
+	}
+	if dto.ID == uuid.Nil {
+		dto.ID = uuid.New()
+	}
+
+	return s.storage.Transfer(ctx, dto)
+}
+
+func (s *service) QuoteExchange(ctx context.Context, dto *QuoteDTO) (*Quote, error) {
+	if !dto.Amount.IsPositive() {
+		return nil, fmt.Errorf("%w: exchange amount must be positive", ErrInvalidAmount)
+	}
+	if err := s.checkAmount(dto.Amount); err != nil {
+		return nil, err
+	}
+	if err := ValidateCurrency(dto.ToCurrency); err != nil {
+		return nil, err
+	}
+	if dto.Amount.Currency == dto.ToCurrency {
+		return nil, fmt.Errorf("%w: exchange currencies must differ", ErrInvalidOperation)
+	}
+	if dto.ToWalletID == uuid.Nil {
+		dto.ToWalletID = dto.WalletID
+	}
+	if s.exchange.Rates == nil {
+		return nil, fmt.Errorf("%w: no rate provider configured", ErrRateUnavailable)
+	}
+
+	rate, err := s.exchange.Rates.Rate(ctx, dto.Amount.Currency, dto.ToCurrency)
+	if err != nil {
+		return nil, err
+	}
+
+	spread := s.exchange.Spread
+	if spread == nil {
+		spread = new(big.Rat)
+	}
+
+	credit, err := Convert(dto.Amount, dto.ToCurrency, rate.Rate, spread)
+	if err != nil {
+		return nil, err
+	}
+	if !credit.IsPositive() {
+		return nil, fmt.Errorf("%w: %s %s is too small to exchange", ErrInvalidAmount, dto.Amount, dto.Amount.Currency)
+	}
+
+	ttl := s.exchange.QuoteTTL
+	if ttl <= 0 {
+		ttl = DefaultQuoteTTL
+	}
+
+	quote := &Quote{
+		ID:         uuid.New(),
+		WalletID:   dto.WalletID,
+		ToWalletID: dto.ToWalletID,
+		Debit:      dto.Amount,
+		Credit:     credit,
+		Rate:       FormatRate(rate.Rate),
+		Spread:     FormatRate(spread),
+		Source:     rate.Source,
+		ExpiresAt:  time.Now().Add(ttl).UTC(),
+	}
+
+	if err := s.storage.SaveQuote(ctx, quote); err != nil {
+		return nil, err
+	}
+
+	return quote, nil
+}
+
+func (s *service) Exchange(ctx context.Context, dto *ExchangeDTO) (*Exchange, error) {
+	if dto.QuoteID == uuid.Nil {
+		if dto.Quote == nil {
+			return nil, fmt.Errorf("%w: quote id or exchange details are required", ErrInvalidOperation)
+		}
+		quote, err := s.QuoteExchange(ctx, dto.Quote)
+		if err != nil {
+			return nil, err
+		}
+		dto.QuoteID = quote.ID
+	}
+	if dto.ID == uuid.Nil {
+		dto.ID = uuid.New()
+	}
+
+	return s.storage.Exchange(ctx, dto)
+}
+
+func (s *service) AuthorizeHold(ctx context.Context, dto *HoldDTO) (*Hold, error) {
+	if !dto.Amount.IsPositive() {
+		return nil, fmt.Errorf("%w: hold amount must be positive", ErrInvalidAmount)
+	}
+	if err := s.checkAmount(dto.Amount); err != nil {
+		return nil, err
+	}
+	if dto.TTL == 0 {
+		dto.TTL = DefaultHoldTTL
+	}
+	if dto.TTL < 0 || dto.TTL > MaxHoldTTL {
+		return nil, fmt.Errorf("%w: hold must expire within %v", ErrInvalidOperation, MaxHoldTTL)
+	}
+	if dto.ID == uuid.Nil {
+		dto.ID = uuid.New()
+	}
+
+	return s.storage.AuthorizeHold(ctx, dto)
+}
+
+func (s *service) CaptureHold(ctx context.Context, dto *CaptureDTO) (*Hold, error) {
+	if dto.Amount != nil && !dto.Amount.IsPositive() {
+		return nil, fmt.Errorf("%w: capture amount must be positive, void the hold instead", ErrInvalidAmount)
+	}
+
+	return s.storage.CaptureHold(ctx, dto)
+}
+
+func (s *service) VoidHold(ctx context.Context, holdID uuid.UUID) (*Hold, error) {
+	return s.storage.VoidHold(ctx, holdID)
+}
+
+func (s *service) ExpireHolds(ctx context.Context) (int64, error) {
+	return s.storage.ExpireHolds(ctx)
+}
+
+func (s *service) ReverseTransaction(ctx context.Context, dto *ReversalDTO) (*Transaction, error) {
+	if dto.Amount != nil && !dto.Amount.IsPositive() {
+		return nil, fmt.Errorf("%w: reversal amount must be positive", ErrInvalidAmount)
+	}
+
+	return s.storage.ReverseTransaction(ctx, dto)
+}
+
+func NewService(storage Storage, exchange ExchangeConfig) Service {
+	s := &service{storage: storage, exchange: exchange}
+	s.SetLimits(Limits{})
+	return s
 }
@@ -0,0 +1,285 @@
+package wallet
+
+import (
+	"context"
+	"errors"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// stubStorage отвечает успехом на все вызовы и запоминает, дошел ли запрос до хранилища.
+type stubStorage struct {
+	Storage
+	called bool
+	quote  *Quote
+	batch  *BatchDTO
+}
+
+// stubRates отдает один и тот же курс для любой пары.
+type stubRates struct {
+	rate string
+}
+
+func (r stubRates) Rate(ctx context.Context, from, to string) (*ExchangeRate, error) {
+	rate, err := ParseRate(r.rate)
+	if err != nil {
+		return nil, err
+	}
+	return &ExchangeRate{From: from, To: to, Rate: rate, Source: "stub"}, nil
+}
+
+func (s *stubStorage) GetBalance(ctx context.Context, walletID string) (*Wallet, error) {
+	s.called = true
+	return &Wallet{}, nil
+}
+
+func (s *stubStorage) ChangeBalanceBatch(ctx context.Context, dto *BatchDTO) ([]BatchResult, error) {
+	s.called = true
+	s.batch = dto
+	results := make([]BatchResult, len(dto.Operations))
+	for i, op := range dto.Operations {
+		results[i] = BatchResult{Wallet: &Wallet{ID: op.ID}}
+	}
+	return results, nil
+}
+
+func (s *stubStorage) OpenBalance(ctx context.Context, dto *OpenBalanceDTO) (*Wallet, error) {
+	s.called = true
+	return &Wallet{ID: dto.WalletID}, nil
+}
+
+func (s *stubStorage) SaveQuote(ctx context.Context, quote *Quote) error {
+	s.called = true
+	s.quote = quote
+	return nil
+}
+
+func (s *stubStorage) Transfer(ctx context.Context, dto *TransferDTO) (*Transfer, error) {
+	s.called = true
+	return &Transfer{ID: dto.ID}, nil
+}
+
+func TestService_GetBalance_InvalidWalletID(t *testing.T) {
+	storage := &stubStorage{}
+	svc := NewService(storage, ExchangeConfig{})
+
+	_, err := svc.GetBalanceWalletByWalletID(context.Background(), "not-a-uuid")
+	if !errors.Is(err, ErrInvalidWalletID) {
+		t.Fatalf("expected invalid wallet id error, got %v", err)
+	}
+	if storage.called {
+		t.Errorf("storage must not be called with a malformed id")
+	}
+}
+
+func TestService_OpenBalance_UnsupportedCurrency(t *testing.T) {
+	storage := &stubStorage{}
+	svc := NewService(storage, ExchangeConfig{})
+
+	_, err := svc.OpenBalance(context.Background(), &OpenBalanceDTO{WalletID: uuid.New(), Currency: "XXX"})
+	if !errors.Is(err, ErrUnsupportedCurrency) {
+		t.Fatalf("expected unsupported currency error, got %v", err)
+	}
+	if storage.called {
+		t.Errorf("storage must not be called with an unsupported currency")
+	}
+}
+
+func TestService_Transfer_Validation(t *testing.T) {
+	walletID := uuid.New()
+
+	cases := []struct {
+		dto *TransferDTO
+		err error
+	}{
+		{&TransferDTO{FromID: walletID, ToID: walletID, Amount: NewMoney(10, DefaultCurrency)}, ErrInvalidOperation},
+		{&TransferDTO{FromID: walletID, ToID: uuid.New(), Amount: NewMoney(0, DefaultCurrency)}, ErrInvalidAmount},
+	}
+
+	for _, tc := range cases {
+		dto := tc.dto
+		storage := &stubStorage{}
+		svc := NewService(storage, ExchangeConfig{})
+
+		_, err := svc.Transfer(context.Background(), dto)
+		if !errors.Is(err, tc.err) {
+			t.Errorf("expected %v for %+v, got %v", tc.err, dto, err)
+		}
+		if storage.called {
+			t.Errorf("storage must not be called for %+v", dto)
+		}
+	}
+}
+
+func TestService_Transfer_AssignsID(t *testing.T) {
+	svc := NewService(&stubStorage{}, ExchangeConfig{})
+
+	result, err := svc.Transfer(context.Background(), &TransferDTO{FromID: uuid.New(), ToID: uuid.New(), Amount: NewMoney(10, DefaultCurrency)})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if result.ID == uuid.Nil {
+		t.Errorf("expected transfer id to be generated")
+	}
+}
+
+func TestService_QuoteExchange(t *testing.T) {
+	storage := &stubStorage{}
+	svc := NewService(storage, ExchangeConfig{Rates: stubRates{"0.0125"}, Spread: big.NewRat(1, 100), QuoteTTL: time.Minute})
+
+	walletID := uuid.New()
+	quote, err := svc.QuoteExchange(context.Background(), &QuoteDTO{WalletID: walletID, Amount: NewMoney(1000000, "RUB"), ToCurrency: "USD"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// 10000 RUB * 0.0125 * 0.99 = 123.75 USD
+	if quote.Credit != NewMoney(12375, "USD") {
+		t.Errorf("expected 123.75 USD, got %s %s", quote.Credit, quote.Credit.Currency)
+	}
+	if quote.Rate != "0.0125" || quote.Spread != "0.01" || quote.Source != "stub" {
+		t.Errorf("unexpected rate details: %+v", quote)
+	}
+	if quote.ToWalletID != walletID {
+		t.Errorf("expected exchange within wallet %v, got %v", walletID, quote.ToWalletID)
+	}
+	if storage.quote != quote {
+		t.Errorf("expected quote to be saved")
+	}
+	if until := time.Until(quote.ExpiresAt); until <= 0 || until > time.Minute {
+		t.Errorf("unexpected quote expiry %v", quote.ExpiresAt)
+	}
+}
+
+func TestService_QuoteExchange_Validation(t *testing.T) {
+	cases := []struct {
+		config ExchangeConfig
+		dto    *QuoteDTO
+		err    error
+	}{
+		{ExchangeConfig{Rates: stubRates{"1"}}, &QuoteDTO{Amount: NewMoney(0, "RUB"), ToCurrency: "USD"}, ErrInvalidAmount},
+		{ExchangeConfig{Rates: stubRates{"1"}}, &QuoteDTO{Amount: NewMoney(100, "RUB"), ToCurrency: "RUB"}, ErrInvalidOperation},
+		{ExchangeConfig{Rates: stubRates{"1"}}, &QuoteDTO{Amount: NewMoney(100, "RUB"), ToCurrency: "XXX"}, ErrUnsupportedCurrency},
+		{ExchangeConfig{Rates: stubRates{"0.0001"}}, &QuoteDTO{Amount: NewMoney(1, "RUB"), ToCurrency: "USD"}, ErrInvalidAmount},
+		{ExchangeConfig{}, &QuoteDTO{Amount: NewMoney(100, "RUB"), ToCurrency: "USD"}, ErrRateUnavailable},
+	}
+
+	for _, tc := range cases {
+		storage := &stubStorage{}
+		svc := NewService(storage, tc.config)
+
+		_, err := svc.QuoteExchange(context.Background(), tc.dto)
+		if !errors.Is(err, tc.err) {
+			t.Errorf("expected %v for %+v, got %v", tc.err, tc.dto, err)
+		}
+		if storage.called {
+			t.Errorf("quote must not be saved for %+v", tc.dto)
+		}
+	}
+}
+
+func TestService_AuthorizeHold_Validation(t *testing.T) {
+	cases := []struct {
+		dto *HoldDTO
+		err error
+	}{
+		{&HoldDTO{WalletID: uuid.New(), Amount: NewMoney(0, DefaultCurrency)}, ErrInvalidAmount},
+		{&HoldDTO{WalletID: uuid.New(), Amount: NewMoney(10, DefaultCurrency), TTL: MaxHoldTTL + time.Second}, ErrInvalidOperation},
+	}
+
+	for _, tc := range cases {
+		storage := &stubStorage{}
+		svc := NewService(storage, ExchangeConfig{})
+
+		_, err := svc.AuthorizeHold(context.Background(), tc.dto)
+		if !errors.Is(err, tc.err) {
+			t.Errorf("expected %v for %+v, got %v", tc.err, tc.dto, err)
+		}
+		if storage.called {
+			t.Errorf("storage must not be called for %+v", tc.dto)
+		}
+	}
+}
+
+func TestService_ReverseTransaction_InvalidAmount(t *testing.T) {
+	storage := &stubStorage{}
+	svc := NewService(storage, ExchangeConfig{})
+
+	amount := NewMoney(0, DefaultCurrency)
+	_, err := svc.ReverseTransaction(context.Background(), &ReversalDTO{TransactionID: uuid.New(), Amount: &amount})
+	if !errors.Is(err, ErrInvalidAmount) {
+		t.Fatalf("expected invalid amount error, got %v", err)
+	}
+	if storage.called {
+		t.Errorf("storage must not be called with a non-positive amount")
+	}
+}
+
+func TestService_ChangeBalanceBatch(t *testing.T) {
+	valid := &WalletChangeBalanceDTO{ID: uuid.New(), OperationType: "DEPOSIT", Amount: NewMoney(10, DefaultCurrency)}
+	invalid := &WalletChangeBalanceDTO{ID: uuid.New(), OperationType: "DEPOSIT", Amount: NewMoney(0, DefaultCurrency)}
+
+	storage := &stubStorage{}
+	svc := NewService(storage, ExchangeConfig{})
+
+	results, err := svc.ChangeBalanceBatch(context.Background(), &BatchDTO{Operations: []*WalletChangeBalanceDTO{invalid, valid}})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !errors.Is(results[0].Err, ErrInvalidAmount) || results[1].Wallet.ID != valid.ID {
+		t.Errorf("unexpected results: %+v", results)
+	}
+	if len(storage.batch.Operations) != 1 {
+		t.Errorf("expected only the valid operation to reach storage, got %d", len(storage.batch.Operations))
+	}
+
+	storage = &stubStorage{}
+	svc = NewService(storage, ExchangeConfig{})
+
+	results, err = svc.ChangeBalanceBatch(context.Background(), &BatchDTO{Atomic: true, Operations: []*WalletChangeBalanceDTO{valid, invalid}})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !errors.Is(results[0].Err, ErrBatchAborted) || !errors.Is(results[1].Err, ErrInvalidAmount) {
+		t.Errorf("unexpected atomic results: %+v", results)
+	}
+	if storage.called {
+		t.Errorf("atomic batch with an invalid operation must not reach storage")
+	}
+
+	if _, err := svc.ChangeBalanceBatch(context.Background(), &BatchDTO{}); !errors.Is(err, ErrInvalidOperation) {
+		t.Errorf("expected empty batch to be rejected, got %v", err)
+	}
+}
+
+func TestService_SetLimits(t *testing.T) {
+	storage := &stubStorage{}
+	svc := NewService(storage, ExchangeConfig{})
+	svc.(LimitSetter).SetLimits(Limits{MaxBatchSize: 1, MaxAmount: map[string]int64{"RUB": 10000}})
+
+	op := &WalletChangeBalanceDTO{ID: uuid.New(), OperationType: "DEPOSIT", Amount: NewMoney(10, DefaultCurrency)}
+	if _, err := svc.ChangeBalanceBatch(context.Background(), &BatchDTO{Operations: []*WalletChangeBalanceDTO{op, op}}); !errors.Is(err, ErrInvalidOperation) {
+		t.Errorf("expected batch above the limit to be rejected, got %v", err)
+	}
+
+	_, err := svc.Transfer(context.Background(), &TransferDTO{FromID: uuid.New(), ToID: uuid.New(), Amount: NewMoney(10001, "RUB")})
+	if !errors.Is(err, ErrLimitExceeded) {
+		t.Errorf("expected amount above the limit to be rejected, got %v", err)
+	}
+	if storage.called {
+		t.Errorf("operation above the limit must not reach storage")
+	}
+
+	//Валюты без предела не ограничены
+	if _, err := svc.Transfer(context.Background(), &TransferDTO{FromID: uuid.New(), ToID: uuid.New(), Amount: NewMoney(10001, "USD")}); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+
+	svc.(LimitSetter).SetLimits(Limits{})
+	if _, err := svc.Transfer(context.Background(), &TransferDTO{FromID: uuid.New(), ToID: uuid.New(), Amount: NewMoney(10001, "RUB")}); err != nil {
+		t.Errorf("expected new limits to apply, got %v", err)
+	}
+}
@@ -1,8 +1,58 @@
 package wallet
 
-import "context"
+import (
+	"context"
+
+	"github.com/google/uuid"
+)
 
 type Storage interface {
+	CreateWallet(ctx context.Context, dto *WalletCreateDTO) (*Wallet, error)
+	OpenBalance(ctx context.Context, dto *OpenBalanceDTO) (*Wallet, error)
 	ChangeBalance(ctx context.Context, dto *WalletChangeBalanceDTO) (*Wallet, error)
-	GetBalance(ctx context.Context, walletID string) (int, error)
-}
\ No newline at end of file
+	// ChangeBalanceBatch возвращает итог каждой операции пакета, ошибка - только
+	// отказ самого хранилища
+	ChangeBalanceBatch(ctx context.Context, dto *BatchDTO) ([]BatchResult, error)
+	GetBalance(ctx context.Context, walletID string) (*Wallet, error)
+	ListTransactions(ctx context.Context, filter *TransactionFilter) (*TransactionPage, error)
+	Transfer(ctx context.Context, dto *TransferDTO) (*Transfer, error)
+	SaveQuote(ctx context.Context, quote *Quote) error
+	// Exchange исполняет котировку dto.QuoteID, котировку можно исполнить один раз
+	Exchange(ctx context.Context, dto *ExchangeDTO) (*Exchange, error)
+	AuthorizeHold(ctx context.Context, dto *HoldDTO) (*Hold, error)
+	CaptureHold(ctx context.Context, dto *CaptureDTO) (*Hold, error)
+	VoidHold(ctx context.Context, holdID uuid.UUID) (*Hold, error)
+	// ExpireHolds снимает просроченные холды и возвращает их количество
+	ExpireHolds(ctx context.Context) (int64, error)
+	ReverseTransaction(ctx context.Context, dto *ReversalDTO) (*Transaction, error)
+}
+
+// LedgerChecker проверяет, что хранилище не теряет и не создает деньги: проводки
+// в каждой валюте сходятся в ноль, а балансы кошельков совпадают с их проводками.
+type LedgerChecker interface {
+	CheckLedger(ctx context.Context) ([]LedgerViolation, error)
+}
+
+// SlotConsolidator переносит слоты горячих кошельков в основные балансы, чтобы
+// списания чаще находили деньги в одном месте. Возвращает число кошельков.
+type SlotConsolidator interface {
+	ConsolidateSlots(ctx context.Context) (int64, error)
+}
+
+// SlotSetter задает число слотов баланса кошелька, 1 - без слотов.
+type SlotSetter interface {
+	SetSlots(ctx context.Context, walletID uuid.UUID, slots int) error
+}
+
+type strongConsistencyKey struct{}
+
+// WithStrongConsistency требует, чтобы чтения с этим ctx видели все уже
+// подтвержденные изменения. Хранилище с репликой читает тогда с основной базы.
+func WithStrongConsistency(ctx context.Context) context.Context {
+	return context.WithValue(ctx, strongConsistencyKey{}, true)
+}
+
+func StrongConsistency(ctx context.Context) bool {
+	strong, _ := ctx.Value(strongConsistencyKey{}).(bool)
+	return strong
+}
@@ -0,0 +1,442 @@
+// Package storagetest проверяет, что реализация wallet.Storage ведет себя так же,
+// как остальные: одинаково считает балансы, возвращает те же ошибки и не уводит
+// баланс в минус при одновременных списаниях.
+package storagetest
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+
+	"walet_rest_api/internal/domain/wallet"
+
+	"github.com/google/uuid"
+)
+
+// Factory возвращает хранилище для одного теста. Хранилище может быть общим для
+// всех тестов: каждый тест работает только со своими новыми кошельками.
+type Factory func(t *testing.T) wallet.Storage
+
+// Run прогоняет все проверки против хранилищ из newStorage.
+func Run(t *testing.T, newStorage Factory) {
+	tests := []struct {
+		name string
+		run  func(t *testing.T, storage wallet.Storage)
+	}{
+		{"CreateWallet", testCreateWallet},
+		{"DepositWithdraw", testDepositWithdraw},
+		{"InsufficientFunds", testInsufficientFunds},
+		{"UnknownWallet", testUnknownWallet},
+		{"CurrencyMismatch", testCurrencyMismatch},
+		{"ExpectedVersion", testExpectedVersion},
+		{"Transfer", testTransfer},
+		{"ConcurrentWithdrawals", testConcurrentWithdrawals},
+		{"HistoryOrder", testHistoryOrder},
+		{"HistoryPagingDuringWrites", testHistoryPagingDuringWrites},
+		{"BatchOrder", testBatchOrder},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			tc.run(t, newStorage(t))
+		})
+	}
+}
+
+func rub(amount int64) wallet.Money {
+	return wallet.NewMoney(amount, wallet.DefaultCurrency)
+}
+
+func change(walletID uuid.UUID, operationType string, amount int64) *wallet.WalletChangeBalanceDTO {
+	return &wallet.WalletChangeBalanceDTO{ID: walletID, OperationType: operationType, Amount: rub(amount)}
+}
+
+func createWallet(t *testing.T, storage wallet.Storage, balance int64) uuid.UUID {
+	t.Helper()
+	created, err := storage.CreateWallet(context.Background(), &wallet.WalletCreateDTO{ID: uuid.New(), Balance: rub(balance)})
+	if err != nil {
+		t.Fatalf("failed to create wallet: %v", err)
+	}
+	return created.ID
+}
+
+// requireBalance проверяет баланс и версию кошелька так, как их видит GetBalance.
+func requireBalance(t *testing.T, storage wallet.Storage, walletID uuid.UUID, balance, version int64) {
+	t.Helper()
+	found, err := storage.GetBalance(context.Background(), walletID.String())
+	if err != nil {
+		t.Fatalf("failed to get balance: %v", err)
+	}
+	if found.Balance.Amount != balance || found.Version != version {
+		t.Fatalf("expected balance %d at version %d, got %d at version %d", balance, version, found.Balance.Amount, found.Version)
+	}
+	if found.Available == nil || found.Available.Amount != balance {
+		t.Fatalf("expected available balance %d, got %v", balance, found.Available)
+	}
+}
+
+// requireWalletError проверяет доменную ошибку и кошелек, к которому она относится.
+func requireWalletError(t *testing.T, err, target error, walletID uuid.UUID) {
+	t.Helper()
+	if !errors.Is(err, target) {
+		t.Fatalf("expected %v, got %v", target, err)
+	}
+	var walletErr *wallet.WalletError
+	if !errors.As(err, &walletErr) || walletErr.WalletID != walletID {
+		t.Fatalf("expected error for wallet %v, got %v", walletID, err)
+	}
+}
+
+func testCreateWallet(t *testing.T, storage wallet.Storage) {
+	ctx := context.Background()
+	dto := &wallet.WalletCreateDTO{ID: uuid.New(), Balance: rub(100)}
+
+	created, err := storage.CreateWallet(ctx, dto)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if created.ID != dto.ID || created.Balance != rub(100) || created.Currency != wallet.DefaultCurrency || created.Version != 1 {
+		t.Errorf("unexpected wallet %+v", created)
+	}
+	requireBalance(t, storage, dto.ID, 100, 1)
+
+	_, err = storage.CreateWallet(ctx, dto)
+	requireWalletError(t, err, wallet.ErrWalletAlreadyExists, dto.ID)
+}
+
+func testDepositWithdraw(t *testing.T, storage wallet.Storage) {
+	ctx := context.Background()
+	walletID := createWallet(t, storage, 100)
+
+	deposited, err := storage.ChangeBalance(ctx, change(walletID, "DEPOSIT", 50))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if deposited.ID != walletID || deposited.Balance != rub(150) || deposited.Version != 2 {
+		t.Errorf("expected 150 at version 2 after deposit, got %+v", deposited)
+	}
+
+	withdrawn, err := storage.ChangeBalance(ctx, change(walletID, "WITHDRAW", 150))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if withdrawn.Balance != rub(0) || withdrawn.Version != 3 {
+		t.Errorf("expected 0 at version 3 after withdrawal, got %+v", withdrawn)
+	}
+
+	requireBalance(t, storage, walletID, 0, 3)
+}
+
+func testInsufficientFunds(t *testing.T, storage wallet.Storage) {
+	ctx := context.Background()
+	walletID := createWallet(t, storage, 100)
+
+	_, err := storage.ChangeBalance(ctx, change(walletID, "WITHDRAW", 101))
+	requireWalletError(t, err, wallet.ErrInsufficientFunds, walletID)
+
+	//Отказ не меняет ни баланс, ни версию, ни историю
+	requireBalance(t, storage, walletID, 100, 1)
+	page, err := storage.ListTransactions(ctx, &wallet.TransactionFilter{WalletID: walletID, Limit: 10})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(page.Transactions) != 1 {
+		t.Errorf("expected only the opening deposit in history, got %d records", len(page.Transactions))
+	}
+}
+
+func testUnknownWallet(t *testing.T, storage wallet.Storage) {
+	ctx := context.Background()
+	unknown := uuid.New()
+
+	_, err := storage.ChangeBalance(ctx, change(unknown, "DEPOSIT", 10))
+	requireWalletError(t, err, wallet.ErrWalletNotFound, unknown)
+
+	if _, err := storage.GetBalance(ctx, unknown.String()); !errors.Is(err, wallet.ErrWalletNotFound) {
+		t.Errorf("expected wallet not found from GetBalance, got %v", err)
+	}
+
+	_, err = storage.ListTransactions(ctx, &wallet.TransactionFilter{WalletID: unknown, Limit: 10})
+	requireWalletError(t, err, wallet.ErrWalletNotFound, unknown)
+
+	_, err = storage.OpenBalance(ctx, &wallet.OpenBalanceDTO{WalletID: unknown, Currency: "USD"})
+	requireWalletError(t, err, wallet.ErrWalletNotFound, unknown)
+
+	from := createWallet(t, storage, 100)
+	_, err = storage.Transfer(ctx, &wallet.TransferDTO{ID: uuid.New(), FromID: from, ToID: unknown, Amount: rub(10)})
+	requireWalletError(t, err, wallet.ErrWalletNotFound, unknown)
+	requireBalance(t, storage, from, 100, 1)
+}
+
+func testCurrencyMismatch(t *testing.T, storage wallet.Storage) {
+	ctx := context.Background()
+	walletID := createWallet(t, storage, 100)
+
+	usd := wallet.NewMoney(10, "USD")
+	for _, operationType := range []string{"DEPOSIT", "WITHDRAW"} {
+		_, err := storage.ChangeBalance(ctx, &wallet.WalletChangeBalanceDTO{ID: walletID, OperationType: operationType, Amount: usd})
+		if !errors.Is(err, wallet.ErrCurrencyMismatch) {
+			t.Errorf("expected currency mismatch for %s, got %v", operationType, err)
+		}
+	}
+
+	opened, err := storage.OpenBalance(ctx, &wallet.OpenBalanceDTO{WalletID: walletID, Currency: "USD"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(opened.Balances) != 2 || opened.Version != 2 {
+		t.Errorf("expected two balances at version 2, got %+v", opened)
+	}
+	if _, err := storage.OpenBalance(ctx, &wallet.OpenBalanceDTO{WalletID: walletID, Currency: "USD"}); !errors.Is(err, wallet.ErrBalanceAlreadyExists) {
+		t.Errorf("expected balance already exists, got %v", err)
+	}
+
+	updated, err := storage.ChangeBalance(ctx, &wallet.WalletChangeBalanceDTO{ID: walletID, OperationType: "DEPOSIT", Amount: usd})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if updated.Balance != usd {
+		t.Errorf("expected USD balance of %v, got %v", usd, updated.Balance)
+	}
+	//Основной баланс не меняется от операций в другой валюте
+	requireBalance(t, storage, walletID, 100, 3)
+}
+
+func testExpectedVersion(t *testing.T, storage wallet.Storage) {
+	ctx := context.Background()
+	walletID := createWallet(t, storage, 100)
+
+	stale := int64(0)
+	dto := change(walletID, "DEPOSIT", 10)
+	dto.ExpectedVersion = &stale
+	if _, err := storage.ChangeBalance(ctx, dto); !errors.Is(err, wallet.ErrVersionMismatch) {
+		t.Fatalf("expected version mismatch, got %v", err)
+	}
+
+	current := int64(1)
+	dto.ExpectedVersion = &current
+	updated, err := storage.ChangeBalance(ctx, dto)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if updated.Version != 2 {
+		t.Errorf("expected version 2, got %d", updated.Version)
+	}
+}
+
+func testTransfer(t *testing.T, storage wallet.Storage) {
+	ctx := context.Background()
+	from := createWallet(t, storage, 100)
+	to := createWallet(t, storage, 0)
+
+	transfer, err := storage.Transfer(ctx, &wallet.TransferDTO{ID: uuid.New(), FromID: from, ToID: to, Amount: rub(70)})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if transfer.From.ID != from || transfer.From.Balance != rub(30) || transfer.To.ID != to || transfer.To.Balance != rub(70) {
+		t.Errorf("unexpected transfer %+v", transfer)
+	}
+	//Версии в ответе те же, что вернет GetBalance: по ним можно сразу слать If-Match
+	if transfer.From.Version != 2 || transfer.To.Version != 2 {
+		t.Errorf("expected both wallets at version 2 after the transfer, got %d and %d", transfer.From.Version, transfer.To.Version)
+	}
+
+	_, err = storage.Transfer(ctx, &wallet.TransferDTO{ID: uuid.New(), FromID: from, ToID: to, Amount: rub(31)})
+	requireWalletError(t, err, wallet.ErrInsufficientFunds, from)
+
+	requireBalance(t, storage, from, 30, 2)
+	requireBalance(t, storage, to, 70, 2)
+}
+
+func testConcurrentWithdrawals(t *testing.T, storage wallet.Storage) {
+	const (
+		balance     = 100
+		amount      = 7
+		withdrawals = 40
+	)
+	ctx := context.Background()
+	walletID := createWallet(t, storage, balance)
+
+	var wg sync.WaitGroup
+	errs := make([]error, withdrawals)
+	for i := range withdrawals {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, errs[i] = storage.ChangeBalance(ctx, change(walletID, "WITHDRAW", amount))
+		}()
+	}
+	wg.Wait()
+
+	succeeded := int64(0)
+	for _, err := range errs {
+		switch {
+		case err == nil:
+			succeeded++
+		case !errors.Is(err, wallet.ErrInsufficientFunds):
+			t.Errorf("unexpected error: %v", err)
+		}
+	}
+
+	//Проходит ровно столько списаний, сколько помещается в баланс
+	if succeeded != balance/amount {
+		t.Errorf("expected %d withdrawals to succeed, got %d", balance/amount, succeeded)
+	}
+	requireBalance(t, storage, walletID, balance-succeeded*amount, 1+succeeded)
+}
+
+func testHistoryOrder(t *testing.T, storage wallet.Storage) {
+	ctx := context.Background()
+	walletID := createWallet(t, storage, 0)
+
+	operations := []*wallet.WalletChangeBalanceDTO{
+		change(walletID, "DEPOSIT", 30),
+		change(walletID, "WITHDRAW", 10),
+		change(walletID, "DEPOSIT", 5),
+		change(walletID, "WITHDRAW", 25),
+	}
+	balances := []int64{30, 20, 25, 0}
+
+	for i, op := range operations {
+		updated, err := storage.ChangeBalance(ctx, op)
+		if err != nil {
+			t.Fatalf("operation %d failed: %v", i, err)
+		}
+		if updated.Version != int64(i)+2 {
+			t.Errorf("expected version %d after operation %d, got %d", i+2, i, updated.Version)
+		}
+	}
+
+	page, err := storage.ListTransactions(ctx, &wallet.TransactionFilter{WalletID: walletID, Limit: 10})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(page.Transactions) != len(operations) {
+		t.Fatalf("expected %d records, got %d", len(operations), len(page.Transactions))
+	}
+
+	//По умолчанию история идет от новых записей к старым
+	for i, tx := range page.Transactions {
+		j := len(operations) - 1 - i
+		if tx.OperationType != operations[j].OperationType || tx.Amount != operations[j].Amount || tx.BalanceAfter != rub(balances[j]) {
+			t.Errorf("record %d: expected %s %v leaving %d, got %+v", i, operations[j].OperationType, operations[j].Amount, balances[j], tx)
+		}
+	}
+
+	ascending, err := storage.ListTransactions(ctx, &wallet.TransactionFilter{WalletID: walletID, Limit: 2, Ascending: true})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(ascending.Transactions) != 2 || ascending.Transactions[0].BalanceAfter != rub(30) || ascending.NextCursor == nil {
+		t.Fatalf("expected first two records and a cursor, got %+v", ascending)
+	}
+
+	rest, err := storage.ListTransactions(ctx, &wallet.TransactionFilter{WalletID: walletID, Limit: 2, Ascending: true, After: ascending.NextCursor})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(rest.Transactions) != 2 || rest.Transactions[0].BalanceAfter != rub(25) || rest.Transactions[1].BalanceAfter != rub(0) || rest.NextCursor != nil {
+		t.Errorf("expected last two records without a cursor, got %+v", rest)
+	}
+}
+
+func testHistoryPagingDuringWrites(t *testing.T, storage wallet.Storage) {
+	const deposits = 40
+	ctx := context.Background()
+	walletID := createWallet(t, storage, 0)
+
+	var wg sync.WaitGroup
+	for range deposits {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := storage.ChangeBalance(ctx, change(walletID, "DEPOSIT", 1)); err != nil {
+				t.Errorf("deposit failed: %v", err)
+			}
+		}()
+	}
+	writing := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(writing)
+	}()
+
+	//Читаем историю по возрастанию, пока идут записи, и дочитываем после них.
+	//Курсор не должен пропустить ни одной строки
+	seen := map[uuid.UUID]bool{}
+	var after *uuid.UUID
+	var last int64
+	done := false
+	for !done {
+		select {
+		case <-writing:
+			done = true
+		default:
+		}
+		for {
+			page, err := storage.ListTransactions(ctx, &wallet.TransactionFilter{WalletID: walletID, Limit: 3, Ascending: true, After: after})
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			for _, tx := range page.Transactions {
+				if seen[tx.ID] {
+					t.Fatalf("record %v returned twice", tx.ID)
+				}
+				seen[tx.ID] = true
+				if tx.BalanceAfter.Amount != last+1 {
+					t.Fatalf("expected balance %d after %v, got %d", last+1, tx.ID, tx.BalanceAfter.Amount)
+				}
+				last = tx.BalanceAfter.Amount
+				id := tx.ID
+				after = &id
+			}
+			if page.NextCursor == nil {
+				break
+			}
+		}
+	}
+
+	if len(seen) != deposits {
+		t.Errorf("expected %d records, got %d", deposits, len(seen))
+	}
+}
+
+func testBatchOrder(t *testing.T, storage wallet.Storage) {
+	ctx := context.Background()
+	walletID := createWallet(t, storage, 0)
+
+	//Списание проходит только потому, что пополнение перед ним уже применено
+	results, err := storage.ChangeBalanceBatch(ctx, &wallet.BatchDTO{Operations: []*wallet.WalletChangeBalanceDTO{
+		change(walletID, "DEPOSIT", 20),
+		change(walletID, "WITHDRAW", 15),
+		change(walletID, "WITHDRAW", 15),
+		change(walletID, "DEPOSIT", 1),
+	}})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	for i, expected := range []int64{20, 5, -1, 6} {
+		if expected < 0 {
+			requireWalletError(t, results[i].Err, wallet.ErrInsufficientFunds, walletID)
+			continue
+		}
+		if results[i].Err != nil || results[i].Wallet.Balance != rub(expected) {
+			t.Errorf("operation %d: expected balance %d, got %+v", i, expected, results[i])
+		}
+	}
+	requireBalance(t, storage, walletID, 6, 4)
+
+	results, err = storage.ChangeBalanceBatch(ctx, &wallet.BatchDTO{Atomic: true, Operations: []*wallet.WalletChangeBalanceDTO{
+		change(walletID, "WITHDRAW", 6),
+		change(walletID, "WITHDRAW", 1),
+	}})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !errors.Is(results[0].Err, wallet.ErrBatchAborted) || !errors.Is(results[1].Err, wallet.ErrInsufficientFunds) {
+		t.Errorf("expected atomic batch to abort, got %+v", results)
+	}
+	requireBalance(t, storage, walletID, 6, 4)
+}
@@ -0,0 +1,60 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	"walet_rest_api/internal/domain/wallet"
+)
+
+// decimalAmount принимает сумму строкой "12.34" или JSON-числом. Число берется
+// как есть, без перевода во float, поэтому точность не теряется.
+type decimalAmount string
+
+var errAmountFormat = errors.New("amount must be a decimal string or number")
+
+func (d *decimalAmount) UnmarshalJSON(data []byte) error {
+	if len(data) > 0 && data[0] == '"' {
+		var s string
+		if err := json.Unmarshal(data, &s); err != nil {
+			return err
+		}
+		*d = decimalAmount(s)
+		return nil
+	}
+
+	var n json.Number
+	if err := json.Unmarshal(data, &n); err != nil {
+		return errAmountFormat
+	}
+	*d = decimalAmount(n)
+	return nil
+}
+
+// requestCurrency приводит код валюты из запроса к ISO 4217. Без валюты
+// операция идет в DefaultCurrency.
+func requestCurrency(currency string) string {
+	if currency == "" {
+		return wallet.DefaultCurrency
+	}
+	return strings.ToUpper(currency)
+}
+
+// toMoney переводит сумму из запроса в минимальные единицы валюты. Отрицательные суммы запрещены.
+func (d decimalAmount) toMoney(currency string) (wallet.Money, error) {
+	if d == "" {
+		return wallet.NewMoney(0, currency), nil
+	}
+
+	amount, err := wallet.ParseMoney(string(d), currency)
+	if err != nil {
+		return wallet.Money{}, err
+	}
+	if amount.Amount < 0 {
+		return wallet.Money{}, fmt.Errorf("%w: %q must not be negative", wallet.ErrInvalidAmount, string(d))
+	}
+
+	return amount, nil
+}
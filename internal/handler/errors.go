@@ -0,0 +1,131 @@
+package handler
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"walet_rest_api/internal/domain/wallet"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Коды ошибок - стабильная часть API, клиенты ветвятся по ним, а не по тексту.
+// Каталог описан в README.
+const (
+	codeInvalidRequest       = "invalid_request"
+	codeInvalidWalletID      = "invalid_wallet_id"
+	codeInvalidOperation     = "invalid_operation"
+	codeInvalidCursor        = "invalid_cursor"
+	codeInvalidAmount        = "invalid_amount"
+	codeUnsupportedCurrency  = "unsupported_currency"
+	codeCurrencyMismatch     = "currency_mismatch"
+	codeRateUnavailable      = "rate_unavailable"
+	codeInsufficientFunds    = "insufficient_funds"
+	codeWalletNotFound       = "wallet_not_found"
+	codeQuoteNotFound        = "quote_not_found"
+	codeQuoteExpired         = "quote_expired"
+	codeQuoteAlreadyUsed     = "quote_already_used"
+	codeHoldNotFound         = "hold_not_found"
+	codeHoldNotActive        = "hold_not_active"
+	codeTransactionNotFound  = "transaction_not_found"
+	codeAlreadyReversed      = "transaction_already_reversed"
+	codeWalletAlreadyExists  = "wallet_already_exists"
+	codeBalanceAlreadyExists = "balance_already_exists"
+	codeIdempotencyKeyReused = "idempotency_key_reused"
+	codeVersionMismatch      = "wallet_version_mismatch"
+	codeBatchAborted         = "batch_aborted"
+	codeLimitExceeded        = "limit_exceeded"
+	codeRateLimited          = "rate_limited"
+	codeMaintenance          = "maintenance"
+	codeRouteNotFound        = "route_not_found"
+	codeInternal             = "internal_error"
+)
+
+type errorDefinition struct {
+	status int
+	title  string
+}
+
+var errorCatalogue = map[string]errorDefinition{
+	codeInvalidRequest:       {http.StatusBadRequest, "Invalid request"},
+	codeInvalidWalletID:      {http.StatusBadRequest, "Invalid wallet id"},
+	codeInvalidOperation:     {http.StatusBadRequest, "Invalid operation"},
+	codeInvalidCursor:        {http.StatusBadRequest, "Invalid cursor"},
+	codeInvalidAmount:        {http.StatusBadRequest, "Invalid amount"},
+	codeUnsupportedCurrency:  {http.StatusBadRequest, "Unsupported currency"},
+	codeCurrencyMismatch:     {http.StatusBadRequest, "Currency mismatch"},
+	codeRateUnavailable:      {http.StatusBadRequest, "Exchange rate unavailable"},
+	codeInsufficientFunds:    {http.StatusBadRequest, "Insufficient funds"},
+	codeWalletNotFound:       {http.StatusNotFound, "Wallet not found"},
+	codeQuoteNotFound:        {http.StatusNotFound, "Quote not found"},
+	codeQuoteExpired:         {http.StatusConflict, "Quote expired"},
+	codeQuoteAlreadyUsed:     {http.StatusConflict, "Quote already used"},
+	codeHoldNotFound:         {http.StatusNotFound, "Hold not found"},
+	codeHoldNotActive:        {http.StatusConflict, "Hold is not active"},
+	codeTransactionNotFound:  {http.StatusNotFound, "Transaction not found"},
+	codeAlreadyReversed:      {http.StatusConflict, "Transaction already reversed"},
+	codeWalletAlreadyExists:  {http.StatusConflict, "Wallet already exists"},
+	codeBalanceAlreadyExists: {http.StatusConflict, "Balance already exists"},
+	codeIdempotencyKeyReused: {http.StatusConflict, "Idempotency key reused"},
+	codeVersionMismatch:      {http.StatusPreconditionFailed, "Wallet was modified"},
+	codeBatchAborted:         {http.StatusFailedDependency, "Batch aborted"},
+	codeLimitExceeded:        {http.StatusBadRequest, "Operation limit exceeded"},
+	codeRateLimited:          {http.StatusTooManyRequests, "Too many requests"},
+	codeMaintenance:          {http.StatusServiceUnavailable, "Service under maintenance"},
+	codeRouteNotFound:        {http.StatusNotFound, "Route not found"},
+	codeInternal:             {http.StatusInternalServerError, "Internal server error"},
+}
+
+var domainErrorCodes = []struct {
+	err  error
+	code string
+}{
+	{wallet.ErrWalletNotFound, codeWalletNotFound},
+	{wallet.ErrWalletAlreadyExists, codeWalletAlreadyExists},
+	{wallet.ErrBalanceAlreadyExists, codeBalanceAlreadyExists},
+	{wallet.ErrCurrencyMismatch, codeCurrencyMismatch},
+	{wallet.ErrRateUnavailable, codeRateUnavailable},
+	{wallet.ErrQuoteNotFound, codeQuoteNotFound},
+	{wallet.ErrQuoteExpired, codeQuoteExpired},
+	{wallet.ErrQuoteAlreadyUsed, codeQuoteAlreadyUsed},
+	{wallet.ErrHoldNotFound, codeHoldNotFound},
+	{wallet.ErrHoldNotActive, codeHoldNotActive},
+	{wallet.ErrTransactionNotFound, codeTransactionNotFound},
+	{wallet.ErrAlreadyReversed, codeAlreadyReversed},
+	{wallet.ErrIdempotencyKeyReused, codeIdempotencyKeyReused},
+	{wallet.ErrVersionMismatch, codeVersionMismatch},
+	{wallet.ErrBatchAborted, codeBatchAborted},
+	{wallet.ErrLimitExceeded, codeLimitExceeded},
+	{wallet.ErrInsufficientFunds, codeInsufficientFunds},
+	{wallet.ErrInvalidOperation, codeInvalidOperation},
+	{wallet.ErrInvalidWalletID, codeInvalidWalletID},
+	{wallet.ErrInvalidCursor, codeInvalidCursor},
+	{wallet.ErrInvalidAmount, codeInvalidAmount},
+	{wallet.ErrUnsupportedCurrency, codeUnsupportedCurrency},
+}
+
+// errorCode сопоставляет доменную ошибку коду из каталога. Неизвестные ошибки
+// считаются внутренними, их текст клиенту не отдается.
+func errorCode(err error) (string, string) {
+	for _, mapping := range domainErrorCodes {
+		if errors.Is(err, mapping.err) {
+			return mapping.code, err.Error()
+		}
+	}
+
+	return codeInternal, ""
+}
+
+func (h *handlers) respondError(c *gin.Context, message string, err error) {
+	code, detail := errorCode(err)
+
+	logger := h.logger.WithField("request_id", requestID(c))
+	if errorCatalogue[code].status >= http.StatusInternalServerError {
+		logger.Error(fmt.Sprintf("%s: %v", message, err))
+	} else {
+		logger.Warn(fmt.Sprintf("%s: %v", message, err))
+	}
+
+	respondProblem(c, code, detail)
+}
@@ -0,0 +1,59 @@
+package handler
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"walet_rest_api/internal/domain/wallet"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestErrorCode(t *testing.T) {
+	cases := []struct {
+		err  error
+		code string
+	}{
+		{&wallet.WalletError{WalletID: uuid.New(), Err: wallet.ErrWalletNotFound}, codeWalletNotFound},
+		{fmt.Errorf("wrapped: %w", &wallet.WalletError{WalletID: uuid.New(), Err: wallet.ErrInsufficientFunds}), codeInsufficientFunds},
+		{&wallet.WalletError{WalletID: uuid.New(), Err: wallet.ErrWalletAlreadyExists}, codeWalletAlreadyExists},
+		{fmt.Errorf("%w: key", wallet.ErrIdempotencyKeyReused), codeIdempotencyKeyReused},
+		{fmt.Errorf("%w: UNKNOWN", wallet.ErrInvalidOperation), codeInvalidOperation},
+		{fmt.Errorf("%w: abc", wallet.ErrInvalidWalletID), codeInvalidWalletID},
+		{fmt.Errorf("%w: tx", wallet.ErrInvalidCursor), codeInvalidCursor},
+		{errors.New(`ERROR: relation "wallets" does not exist (SQLSTATE 42P01)`), codeInternal},
+	}
+
+	for _, tc := range cases {
+		code, detail := errorCode(tc.err)
+		assert.Equal(t, tc.code, code, tc.err.Error())
+		if code == codeInternal {
+			assert.Empty(t, detail)
+		} else {
+			assert.Equal(t, tc.err.Error(), detail)
+		}
+	}
+}
+
+func TestErrorCatalogue_CoversDomainErrors(t *testing.T) {
+	for _, mapping := range domainErrorCodes {
+		definition, ok := errorCatalogue[mapping.code]
+		assert.True(t, ok, mapping.code)
+		assert.NotEmpty(t, definition.title, mapping.code)
+		assert.Less(t, definition.status, http.StatusInternalServerError, mapping.code)
+	}
+}
+
+func TestWalletError_As(t *testing.T) {
+	walletID := uuid.New()
+	err := fmt.Errorf("failed: %w", &wallet.WalletError{WalletID: walletID, Err: wallet.ErrInsufficientFunds})
+
+	var walletErr *wallet.WalletError
+	assert.True(t, errors.As(err, &walletErr))
+	assert.Equal(t, walletID, walletErr.WalletID)
+	assert.True(t, errors.Is(err, wallet.ErrInsufficientFunds))
+	assert.False(t, errors.Is(err, wallet.ErrWalletNotFound))
+}
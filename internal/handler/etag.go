@@ -0,0 +1,39 @@
+package handler
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+const (
+	etagHeader    = "ETag"
+	ifMatchHeader = "If-Match"
+)
+
+// walletETag - сильный ETag из версии кошелька.
+func walletETag(version int64) string {
+	return `"` + strconv.FormatInt(version, 10) + `"`
+}
+
+// parseIfMatch достает из If-Match версию, от которой клиент считал операцию.
+// Без заголовка и для "*" версия не проверяется. Принимается один сильный ETag
+// из ответа GetWalletByUUID.
+func parseIfMatch(value string) (*int64, error) {
+	value = strings.TrimSpace(value)
+	if value == "" || value == "*" {
+		return nil, nil
+	}
+
+	unquoted, ok := strings.CutPrefix(value, `"`)
+	if ok {
+		unquoted, ok = strings.CutSuffix(unquoted, `"`)
+	}
+
+	version, err := strconv.ParseInt(unquoted, 10, 64)
+	if !ok || err != nil || version < 1 {
+		return nil, fmt.Errorf("%s must be a single ETag returned by GET %s, got %q", ifMatchHeader, walletByUUIDUrl, value)
+	}
+
+	return &version, nil
+}
@@ -1,9 +1,14 @@
 package handler
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
 	"fmt"
 	"net/http"
+	"strconv"
 	"strings"
+	"sync/atomic"
+	"time"
 	"walet_rest_api/internal/domain/wallet"
 
 	"github.com/gin-gonic/gin"
@@ -12,23 +17,96 @@ import (
 )
 
 const (
+	idempotencyKeyHeader     = "Idempotency-Key"
+	idempotentReplayedHeader = "Idempotent-Replayed"
+	maxIdempotencyKeyLength  = 255
+)
+
+const (
+	walletCreateUrl     = "/api/v1/wallets"
 	walletByUUIDUrl     = "/api/v1/wallets/:wallet_uuid"
 	walletChangeBalance = "/api/v1/wallet"
+	walletBatchUrl      = "/api/v1/wallet/batch"
+
+	walletTransactionsUrl = "/api/v1/wallets/:wallet_uuid/transactions"
+	walletBalancesUrl     = "/api/v1/wallets/:wallet_uuid/balances"
+	transfersUrl          = "/api/v1/transfers"
+	exchangeQuotesUrl     = "/api/v1/exchange/quotes"
+	exchangeUrl           = "/api/v1/exchange"
+	walletHoldsUrl        = "/api/v1/wallets/:wallet_uuid/holds"
+	holdCaptureUrl        = "/api/v1/holds/:hold_id/capture"
+	holdVoidUrl           = "/api/v1/holds/:hold_id/void"
+	transactionReverseUrl = "/api/v1/transactions/:transaction_id/reverse"
 )
 
 type handlers struct {
 	service wallet.Service
 	logger  *logrus.Logger
+	runtime atomic.Pointer[Runtime]
+	limiter *rateLimiter
 }
 
 func NewHandlers(service wallet.Service, logger *logrus.Logger) *handlers {
-	return &handlers{service: service, logger: logger}
+	h := &handlers{service: service, logger: logger, limiter: newRateLimiter()}
+	h.SetRuntime(Runtime{})
+	return h
+}
+
+type createWalletRequest struct {
+	WalletID *uuid.UUID    `json:"walletId"`
+	Currency string        `json:"currency"`
+	Balance  decimalAmount `json:"balance"`
+}
+
+func (h *handlers) CreateWallet(c *gin.Context) {
+	var req createWalletRequest
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		h.logger.Warn(fmt.Sprintf("Invalid request body: %v", err))
+		respondProblem(c, codeInvalidRequest, bindingDetail(err))
+		return
+	}
+
+	balance, err := req.Balance.toMoney(requestCurrency(req.Currency))
+	if err != nil {
+		h.respondError(c, "Invalid opening balance", err)
+		return
+	}
+
+	dto := &wallet.WalletCreateDTO{
+		Balance: balance,
+	}
+	if req.WalletID != nil {
+		dto.ID = *req.WalletID
+	}
+
+	created, err := h.service.CreateWallet(c.Request.Context(), dto)
+	if err != nil {
+		h.respondError(c, "Failed to create wallet", err)
+		return
+	}
+
+	h.logger.Info(fmt.Sprintf("Successfully created wallet %v", created.ID))
+	c.JSON(http.StatusCreated, created)
 }
 
 type changeBalanceRequest struct {
-	WalletID      uuid.UUID `json:"walletId" binding:"required"`
-	OperationType string    `json:"operationType" binding:"required"`
-	Amount        int       `json:"amount" binding:"required,gt=0"`
+	WalletID      uuid.UUID     `json:"walletId" binding:"required"`
+	OperationType string        `json:"operationType" binding:"required"`
+	Amount        decimalAmount `json:"amount" binding:"required"`
+	Currency      string        `json:"currency"`
+}
+
+// fingerprint идентифицирует тело запроса и If-Match для проверки Idempotency-Key
+func fingerprint(dto *wallet.WalletChangeBalanceDTO) string {
+	payload := fmt.Sprintf("%s|%s|%d|%s", dto.ID, dto.OperationType, dto.Amount.Amount, dto.Amount.Currency)
+	//Без If-Match отпечаток прежний, чтобы ключи, выданные до обновления, совпадали
+	if dto.ExpectedVersion != nil {
+		payload += fmt.Sprintf("|%d", *dto.ExpectedVersion)
+	}
+
+	sum := sha256.Sum256([]byte(payload))
+	return hex.EncodeToString(sum[:])
 }
 
 func (h *handlers) ChangeBalanceWallet(c *gin.Context) {
@@ -36,47 +114,64 @@ func (h *handlers) ChangeBalanceWallet(c *gin.Context) {
 
 	if err := c.ShouldBindJSON(&req); err != nil {
 		h.logger.Warn(fmt.Sprintf("Invalid request body: %v", err))
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body", "details": err.Error()})
+		respondProblem(c, codeInvalidRequest, bindingDetail(err))
 		return
 	}
 
 	req.OperationType = strings.ToUpper(req.OperationType)
 	if req.OperationType != "DEPOSIT" && req.OperationType != "WITHDRAW" {
 		h.logger.Warn(fmt.Sprintf("Invalid operation type: %s", req.OperationType))
-		c.JSON(http.StatusBadRequest, gin.H{"error": "operationType must be DEPOSIT or WITHDRAW"})
+		respondProblem(c, codeInvalidOperation, "operationType must be DEPOSIT or WITHDRAW")
 		return
 	}
 
-	dto := &wallet.WalletChangeBalanceDTO{
-		ID:            req.WalletID,
-		OperationType: req.OperationType,
-		Balance:       req.Amount,
+	amount, err := req.Amount.toMoney(requestCurrency(req.Currency))
+	if err != nil {
+		h.respondError(c, "Invalid amount", err)
+		return
 	}
 
-	updatedWallet, err := h.service.ChangeBalanceWallet(c.Request.Context(), dto)
+	expectedVersion, err := parseIfMatch(c.GetHeader(ifMatchHeader))
 	if err != nil {
-		h.logger.Error(fmt.Sprintf("Failed to change wallet balance: %v", err))
-
-		statusCode := http.StatusInternalServerError
-		errorMessage := "internal server error"
-
-		if strings.Contains(err.Error(), "not found") {
-			statusCode = http.StatusNotFound
-			errorMessage = "wallet not found"
-		} else if strings.Contains(err.Error(), "insufficient balance") {
-			statusCode = http.StatusBadRequest
-			errorMessage = err.Error()
-		} else if strings.Contains(err.Error(), "invalid operation type") {
-			statusCode = http.StatusBadRequest
-			errorMessage = err.Error()
-		} else {
-			errorMessage = err.Error()
+		h.logger.Warn(fmt.Sprintf("Invalid %s header: %v", ifMatchHeader, err))
+		respondProblem(c, codeInvalidRequest, err.Error())
+		return
+	}
+
+	dto := &wallet.WalletChangeBalanceDTO{
+		ID:              req.WalletID,
+		OperationType:   req.OperationType,
+		Amount:          amount,
+		ExpectedVersion: expectedVersion,
+	}
+
+	if key := c.GetHeader(idempotencyKeyHeader); key != "" {
+		if len(key) > maxIdempotencyKeyLength {
+			h.logger.Warn(fmt.Sprintf("Idempotency key is too long: %d", len(key)))
+			respondProblem(c, codeInvalidRequest, fmt.Sprintf("%s must be at most %d characters", idempotencyKeyHeader, maxIdempotencyKeyLength))
+			return
 		}
+		dto.Idempotency = &wallet.IdempotencyKey{
+			Key:         key,
+			Fingerprint: fingerprint(dto),
+		}
+	}
 
-		c.JSON(statusCode, gin.H{"error": errorMessage})
+	updatedWallet, err := h.service.ChangeBalanceWallet(c.Request.Context(), dto)
+	if err != nil {
+		h.respondError(c, "Failed to change wallet balance", err)
 		return
 	}
 
+	if dto.Idempotency != nil && dto.Idempotency.Replayed {
+		h.logger.Info(fmt.Sprintf("Replayed idempotent response for key %s", dto.Idempotency.Key))
+		c.Header(idempotentReplayedHeader, "true")
+	}
+
+	if updatedWallet.Version > 0 {
+		c.Header(etagHeader, walletETag(updatedWallet.Version))
+	}
+
 	h.logger.Info(fmt.Sprintf("Successfully changed wallet balance for wallet %v", updatedWallet.ID))
 	c.JSON(http.StatusOK, gin.H{
 		"wallet_id": updatedWallet.ID,
@@ -84,28 +179,535 @@ func (h *handlers) ChangeBalanceWallet(c *gin.Context) {
 	})
 }
 
+type batchRequest struct {
+	Atomic     bool                   `json:"atomic"`
+	Operations []changeBalanceRequest `json:"operations" binding:"required,min=1,dive"`
+}
+
+// batchItemResult - итог операции пакета. Status - статус, который получил бы
+// такой же одиночный запрос, Code и Detail при отказе - как в ответе об ошибке.
+type batchItemResult struct {
+	Index    int           `json:"index"`
+	Status   int           `json:"status"`
+	WalletID *uuid.UUID    `json:"wallet_id,omitempty"`
+	Balance  *wallet.Money `json:"balance,omitempty"`
+	Version  int64         `json:"version,omitempty"`
+	Code     string        `json:"code,omitempty"`
+	Detail   string        `json:"detail,omitempty"`
+}
+
+func (h *handlers) ChangeBalanceBatch(c *gin.Context) {
+	var req batchRequest
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		h.logger.Warn(fmt.Sprintf("Invalid request body: %v", err))
+		respondProblem(c, codeInvalidRequest, bindingDetail(err))
+		return
+	}
+
+	//Сумма, которую не удалось разобрать, - ошибка тела запроса, как и пропущенный
+	//walletId. Остальные проверки операций делает сервис
+	dto := &wallet.BatchDTO{Atomic: req.Atomic, Operations: make([]*wallet.WalletChangeBalanceDTO, 0, len(req.Operations))}
+	for i, op := range req.Operations {
+		amount, err := op.Amount.toMoney(requestCurrency(op.Currency))
+		if err != nil {
+			h.respondError(c, "Invalid batch amount", fmt.Errorf("operations[%d]: %w", i, err))
+			return
+		}
+		dto.Operations = append(dto.Operations, &wallet.WalletChangeBalanceDTO{
+			ID:            op.WalletID,
+			OperationType: strings.ToUpper(op.OperationType),
+			Amount:        amount,
+		})
+	}
+
+	results, err := h.service.ChangeBalanceBatch(c.Request.Context(), dto)
+	if err != nil {
+		h.respondError(c, "Failed to apply batch", err)
+		return
+	}
+
+	items := make([]batchItemResult, len(results))
+	appliedCount := 0
+	for i, result := range results {
+		items[i] = batchItemResult{Index: i, Status: http.StatusOK}
+		if result.Err != nil {
+			items[i].Code, items[i].Detail = errorCode(result.Err)
+			items[i].Status = errorCatalogue[items[i].Code].status
+			continue
+		}
+		appliedCount++
+		items[i].WalletID = &result.Wallet.ID
+		items[i].Balance = &result.Wallet.Balance
+		items[i].Version = result.Wallet.Version
+	}
+
+	h.logger.Info(fmt.Sprintf("Applied %d of %d batch operations, atomic: %t", appliedCount, len(results), req.Atomic))
+	c.JSON(http.StatusOK, gin.H{
+		"atomic":  req.Atomic,
+		"applied": appliedCount,
+		"results": items,
+	})
+}
+
+type transferRequest struct {
+	FromWalletID uuid.UUID     `json:"fromWalletId" binding:"required"`
+	ToWalletID   uuid.UUID     `json:"toWalletId" binding:"required"`
+	Amount       decimalAmount `json:"amount" binding:"required"`
+	Currency     string        `json:"currency"`
+}
+
+func (h *handlers) Transfer(c *gin.Context) {
+	var req transferRequest
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		h.logger.Warn(fmt.Sprintf("Invalid request body: %v", err))
+		respondProblem(c, codeInvalidRequest, bindingDetail(err))
+		return
+	}
+
+	amount, err := req.Amount.toMoney(requestCurrency(req.Currency))
+	if err != nil {
+		h.respondError(c, "Invalid amount", err)
+		return
+	}
+
+	dto := &wallet.TransferDTO{
+		FromID: req.FromWalletID,
+		ToID:   req.ToWalletID,
+		Amount: amount,
+	}
+
+	transfer, err := h.service.Transfer(c.Request.Context(), dto)
+	if err != nil {
+		h.respondError(c, "Failed to transfer", err)
+		return
+	}
+
+	h.logger.Info(fmt.Sprintf("Successfully transferred %s from %v to %v", transfer.Amount, transfer.From.ID, transfer.To.ID))
+	c.JSON(http.StatusCreated, transfer)
+}
+
+type quoteRequest struct {
+	WalletID     uuid.UUID     `json:"walletId" binding:"required"`
+	ToWalletID   *uuid.UUID    `json:"toWalletId"`
+	FromCurrency string        `json:"fromCurrency" binding:"required"`
+	ToCurrency   string        `json:"toCurrency" binding:"required"`
+	Amount       decimalAmount `json:"amount" binding:"required"`
+}
+
+func (r *quoteRequest) toDTO() (*wallet.QuoteDTO, error) {
+	amount, err := r.Amount.toMoney(requestCurrency(r.FromCurrency))
+	if err != nil {
+		return nil, err
+	}
+
+	dto := &wallet.QuoteDTO{
+		WalletID:   r.WalletID,
+		Amount:     amount,
+		ToCurrency: requestCurrency(r.ToCurrency),
+	}
+	if r.ToWalletID != nil {
+		dto.ToWalletID = *r.ToWalletID
+	}
+
+	return dto, nil
+}
+
+func (h *handlers) QuoteExchange(c *gin.Context) {
+	var req quoteRequest
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		h.logger.Warn(fmt.Sprintf("Invalid request body: %v", err))
+		respondProblem(c, codeInvalidRequest, bindingDetail(err))
+		return
+	}
+
+	dto, err := req.toDTO()
+	if err != nil {
+		h.respondError(c, "Invalid amount", err)
+		return
+	}
+
+	quote, err := h.service.QuoteExchange(c.Request.Context(), dto)
+	if err != nil {
+		h.respondError(c, "Failed to quote exchange", err)
+		return
+	}
+
+	h.logger.Info(fmt.Sprintf("Quoted exchange %v: %s %s -> %s %s at %s", quote.ID, quote.Debit, quote.Debit.Currency, quote.Credit, quote.Credit.Currency, quote.Rate))
+	c.JSON(http.StatusCreated, quote)
+}
+
+// exchangeRequest исполняет котировку quoteId либо, без нее, обменивает по
+// текущему курсу с теми же полями, что и запрос котировки.
+type exchangeRequest struct {
+	QuoteID      *uuid.UUID    `json:"quoteId"`
+	WalletID     uuid.UUID     `json:"walletId"`
+	ToWalletID   *uuid.UUID    `json:"toWalletId"`
+	FromCurrency string        `json:"fromCurrency"`
+	ToCurrency   string        `json:"toCurrency"`
+	Amount       decimalAmount `json:"amount"`
+}
+
+func (h *handlers) Exchange(c *gin.Context) {
+	var req exchangeRequest
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		h.logger.Warn(fmt.Sprintf("Invalid request body: %v", err))
+		respondProblem(c, codeInvalidRequest, bindingDetail(err))
+		return
+	}
+
+	dto := &wallet.ExchangeDTO{}
+	if req.QuoteID != nil {
+		dto.QuoteID = *req.QuoteID
+	} else {
+		if req.WalletID == uuid.Nil || req.FromCurrency == "" || req.ToCurrency == "" || req.Amount == "" {
+			h.logger.Warn("Exchange request without quote or exchange details")
+			respondProblem(c, codeInvalidRequest, "quoteId or walletId, fromCurrency, toCurrency and amount are required")
+			return
+		}
+
+		quote := quoteRequest{
+			WalletID:     req.WalletID,
+			ToWalletID:   req.ToWalletID,
+			FromCurrency: req.FromCurrency,
+			ToCurrency:   req.ToCurrency,
+			Amount:       req.Amount,
+		}
+		quoteDTO, err := quote.toDTO()
+		if err != nil {
+			h.respondError(c, "Invalid amount", err)
+			return
+		}
+		dto.Quote = quoteDTO
+	}
+
+	exchange, err := h.service.Exchange(c.Request.Context(), dto)
+	if err != nil {
+		h.respondError(c, "Failed to exchange", err)
+		return
+	}
+
+	h.logger.Info(fmt.Sprintf("Successfully exchanged %s %s to %s %s by quote %v", exchange.Quote.Debit, exchange.Quote.Debit.Currency, exchange.Quote.Credit, exchange.Quote.Credit.Currency, exchange.Quote.ID))
+	c.JSON(http.StatusCreated, exchange)
+}
+
+type holdRequest struct {
+	Amount           decimalAmount `json:"amount" binding:"required"`
+	Currency         string        `json:"currency"`
+	ExpiresInSeconds int64         `json:"expiresInSeconds"`
+}
+
+func (h *handlers) AuthorizeHold(c *gin.Context) {
+	walletID, err := uuid.Parse(c.Param("wallet_uuid"))
+	if err != nil {
+		h.logger.Warn(fmt.Sprintf("Invalid wallet_uuid: %v", err))
+		respondProblem(c, codeInvalidWalletID, "wallet_uuid must be a valid UUID")
+		return
+	}
+
+	var req holdRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		h.logger.Warn(fmt.Sprintf("Invalid request body: %v", err))
+		respondProblem(c, codeInvalidRequest, bindingDetail(err))
+		return
+	}
+	if req.ExpiresInSeconds < 0 {
+		respondProblem(c, codeInvalidRequest, "expiresInSeconds must not be negative")
+		return
+	}
+
+	amount, err := req.Amount.toMoney(requestCurrency(req.Currency))
+	if err != nil {
+		h.respondError(c, "Invalid amount", err)
+		return
+	}
+
+	dto := &wallet.HoldDTO{
+		WalletID: walletID,
+		Amount:   amount,
+		TTL:      time.Duration(req.ExpiresInSeconds) * time.Second,
+	}
+
+	hold, err := h.service.AuthorizeHold(c.Request.Context(), dto)
+	if err != nil {
+		h.respondError(c, "Failed to authorize hold", err)
+		return
+	}
+
+	h.logger.Info(fmt.Sprintf("Successfully authorized hold %v for wallet %v", hold.ID, walletID))
+	c.JSON(http.StatusCreated, hold)
+}
+
+// amountRequest - необязательная сумма для частичного подтверждения или отмены.
+type amountRequest struct {
+	Amount   decimalAmount `json:"amount"`
+	Currency string        `json:"currency"`
+}
+
+func (h *handlers) CaptureHold(c *gin.Context) {
+	holdID, err := uuid.Parse(c.Param("hold_id"))
+	if err != nil {
+		h.logger.Warn(fmt.Sprintf("Invalid hold_id: %v", err))
+		respondProblem(c, codeInvalidRequest, "hold_id must be a valid UUID")
+		return
+	}
+
+	//Пустое тело - подтверждение всей суммы холда
+	amount, ok := h.bindOptionalAmount(c)
+	if !ok {
+		return
+	}
+
+	dto := &wallet.CaptureDTO{HoldID: holdID, Amount: amount}
+
+	hold, err := h.service.CaptureHold(c.Request.Context(), dto)
+	if err != nil {
+		h.respondError(c, "Failed to capture hold", err)
+		return
+	}
+
+	h.logger.Info(fmt.Sprintf("Successfully captured hold %v", hold.ID))
+	c.JSON(http.StatusOK, hold)
+}
+
+// bindOptionalAmount разбирает amountRequest. Пустое тело или тело без суммы дают nil.
+func (h *handlers) bindOptionalAmount(c *gin.Context) (*wallet.Money, bool) {
+	var req amountRequest
+	if c.Request.ContentLength != 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			h.logger.Warn(fmt.Sprintf("Invalid request body: %v", err))
+			respondProblem(c, codeInvalidRequest, bindingDetail(err))
+			return nil, false
+		}
+	}
+	if req.Amount == "" {
+		return nil, true
+	}
+
+	amount, err := req.Amount.toMoney(requestCurrency(req.Currency))
+	if err != nil {
+		h.respondError(c, "Invalid amount", err)
+		return nil, false
+	}
+
+	return &amount, true
+}
+
+func (h *handlers) VoidHold(c *gin.Context) {
+	holdID, err := uuid.Parse(c.Param("hold_id"))
+	if err != nil {
+		h.logger.Warn(fmt.Sprintf("Invalid hold_id: %v", err))
+		respondProblem(c, codeInvalidRequest, "hold_id must be a valid UUID")
+		return
+	}
+
+	hold, err := h.service.VoidHold(c.Request.Context(), holdID)
+	if err != nil {
+		h.respondError(c, "Failed to void hold", err)
+		return
+	}
+
+	h.logger.Info(fmt.Sprintf("Successfully voided hold %v", hold.ID))
+	c.JSON(http.StatusOK, hold)
+}
+
+func (h *handlers) ReverseTransaction(c *gin.Context) {
+	transactionID, err := uuid.Parse(c.Param("transaction_id"))
+	if err != nil {
+		h.logger.Warn(fmt.Sprintf("Invalid transaction_id: %v", err))
+		respondProblem(c, codeInvalidRequest, "transaction_id must be a valid UUID")
+		return
+	}
+
+	//Пустое тело - отмена всей оставшейся суммы
+	amount, ok := h.bindOptionalAmount(c)
+	if !ok {
+		return
+	}
+
+	reversal, err := h.service.ReverseTransaction(c.Request.Context(), &wallet.ReversalDTO{TransactionID: transactionID, Amount: amount})
+	if err != nil {
+		h.respondError(c, "Failed to reverse transaction", err)
+		return
+	}
+
+	h.logger.Info(fmt.Sprintf("Successfully reversed %s %s of transaction %v", reversal.Amount, reversal.Amount.Currency, transactionID))
+	c.JSON(http.StatusCreated, reversal)
+}
+
 func (h *handlers) GetWalletByUUID(c *gin.Context) {
 	walletUUID := c.Param("wallet_uuid")
 
 	if walletUUID == "" {
 		h.logger.Warn("wallet_uuid parameter is empty")
-		c.JSON(400, gin.H{"error": "wallet_uuid is required"})
+		respondProblem(c, codeInvalidWalletID, "wallet_uuid is required")
 		return
 	}
 
-	balance, err := h.service.GetBalanceWalletByWalletID(c.Request.Context(), walletUUID)
+	//consistency=strong читает с основной базы, мимо реплики
+	ctx := c.Request.Context()
+	switch c.DefaultQuery("consistency", "eventual") {
+	case "eventual":
+	case "strong":
+		ctx = wallet.WithStrongConsistency(ctx)
+	default:
+		respondProblem(c, codeInvalidRequest, "consistency must be strong or eventual")
+		return
+	}
+
+	found, err := h.service.GetBalanceWalletByWalletID(ctx, walletUUID)
 	if err != nil {
-		h.logger.Error("Failed to get wallet balance")
-		c.JSON(500, gin.H{"error": err.Error()})
+		h.respondError(c, "Failed to get wallet balance", err)
 		return
 	}
 
 	h.logger.Info("Successfully retrieved wallet balance")
 
-	c.JSON(200, gin.H{"balance": balance})
+	c.Header(etagHeader, walletETag(found.Version))
+	c.JSON(200, found)
+}
+
+type openBalanceRequest struct {
+	Currency string `json:"currency" binding:"required"`
+}
+
+func (h *handlers) OpenBalance(c *gin.Context) {
+	walletID, err := uuid.Parse(c.Param("wallet_uuid"))
+	if err != nil {
+		h.logger.Warn(fmt.Sprintf("Invalid wallet_uuid: %v", err))
+		respondProblem(c, codeInvalidWalletID, "wallet_uuid must be a valid UUID")
+		return
+	}
+
+	var req openBalanceRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		h.logger.Warn(fmt.Sprintf("Invalid request body: %v", err))
+		respondProblem(c, codeInvalidRequest, bindingDetail(err))
+		return
+	}
+
+	dto := &wallet.OpenBalanceDTO{
+		WalletID: walletID,
+		Currency: requestCurrency(req.Currency),
+	}
+
+	updated, err := h.service.OpenBalance(c.Request.Context(), dto)
+	if err != nil {
+		h.respondError(c, "Failed to open balance", err)
+		return
+	}
+
+	h.logger.Info(fmt.Sprintf("Successfully opened %s balance for wallet %v", dto.Currency, walletID))
+	c.JSON(http.StatusCreated, updated)
+}
+
+func (h *handlers) ListTransactions(c *gin.Context) {
+	walletID, err := uuid.Parse(c.Param("wallet_uuid"))
+	if err != nil {
+		h.logger.Warn(fmt.Sprintf("Invalid wallet_uuid: %v", err))
+		respondProblem(c, codeInvalidWalletID, "wallet_uuid must be a valid UUID")
+		return
+	}
+
+	filter, err := parseTransactionFilter(c)
+	if err != nil {
+		h.logger.Warn(fmt.Sprintf("Invalid transactions query: %v", err))
+		respondProblem(c, codeInvalidRequest, err.Error())
+		return
+	}
+	filter.WalletID = walletID
+
+	page, err := h.service.ListTransactions(c.Request.Context(), filter)
+	if err != nil {
+		h.respondError(c, "Failed to list transactions", err)
+		return
+	}
+
+	h.logger.Info(fmt.Sprintf("Successfully listed transactions for wallet %v", walletID))
+	c.JSON(http.StatusOK, page)
+}
+
+func parseTransactionFilter(c *gin.Context) (*wallet.TransactionFilter, error) {
+	filter := &wallet.TransactionFilter{}
+
+	if after := c.Query("after"); after != "" {
+		cursor, err := uuid.Parse(after)
+		if err != nil {
+			return nil, fmt.Errorf("after must be a transaction id")
+		}
+		filter.After = &cursor
+	}
+
+	if limit := c.Query("limit"); limit != "" {
+		n, err := strconv.Atoi(limit)
+		if err != nil || n <= 0 || n > wallet.MaxTransactionsLimit {
+			return nil, fmt.Errorf("limit must be between 1 and %d", wallet.MaxTransactionsLimit)
+		}
+		filter.Limit = n
+	}
+
+	if operationType := c.Query("operation_type"); operationType != "" {
+		operationType = strings.ToUpper(operationType)
+		switch operationType {
+		case "DEPOSIT", "WITHDRAW", "TRANSFER_IN", "TRANSFER_OUT", "EXCHANGE_IN", "EXCHANGE_OUT", "CAPTURE", "REVERSAL_IN", "REVERSAL_OUT":
+		default:
+			return nil, fmt.Errorf("operation_type must be one of DEPOSIT, WITHDRAW, TRANSFER_IN, TRANSFER_OUT, EXCHANGE_IN, EXCHANGE_OUT, CAPTURE, REVERSAL_IN, REVERSAL_OUT")
+		}
+		filter.OperationType = operationType
+	}
+
+	if currency := c.Query("currency"); currency != "" {
+		currency = strings.ToUpper(currency)
+		if err := wallet.ValidateCurrency(currency); err != nil {
+			return nil, fmt.Errorf("currency must be a supported ISO 4217 code")
+		}
+		filter.Currency = currency
+	}
+
+	for param, dest := range map[string]**time.Time{"from": &filter.From, "to": &filter.To} {
+		if value := c.Query(param); value != "" {
+			t, err := time.Parse(time.RFC3339, value)
+			if err != nil {
+				return nil, fmt.Errorf("%s must be an RFC 3339 timestamp", param)
+			}
+			*dest = &t
+		}
+	}
+	if filter.From != nil && filter.To != nil && !filter.From.Before(*filter.To) {
+		return nil, fmt.Errorf("from must be before to")
+	}
+
+	switch strings.ToLower(c.DefaultQuery("order", "desc")) {
+	case "desc":
+	case "asc":
+		filter.Ascending = true
+	default:
+		return nil, fmt.Errorf("order must be asc or desc")
+	}
+
+	return filter, nil
 }
 
 func (h *handlers) RegisterRoutes(router *gin.Engine) {
+	router.Use(requestIDMiddleware, h.rateLimitMiddleware, h.maintenanceMiddleware)
+	router.NoRoute(func(c *gin.Context) {
+		respondProblem(c, codeRouteNotFound, "")
+	})
+
+	router.POST(walletCreateUrl, h.CreateWallet)
 	router.GET(walletByUUIDUrl, h.GetWalletByUUID)
 	router.POST(walletChangeBalance, h.ChangeBalanceWallet)
+	router.POST(walletBatchUrl, h.ChangeBalanceBatch)
+	router.GET(walletTransactionsUrl, h.ListTransactions)
+	router.POST(walletBalancesUrl, h.OpenBalance)
+	router.POST(transfersUrl, h.Transfer)
+	router.POST(exchangeQuotesUrl, h.QuoteExchange)
+	router.POST(exchangeUrl, h.Exchange)
+	router.POST(walletHoldsUrl, h.AuthorizeHold)
+	router.POST(holdCaptureUrl, h.CaptureHold)
+	router.POST(holdVoidUrl, h.VoidHold)
+	router.POST(transactionReverseUrl, h.ReverseTransaction)
 }
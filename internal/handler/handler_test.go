@@ -5,11 +5,15 @@ import (
 	"context"
 	"encoding/json"
 	"errors"
+	"fmt"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
+	"time"
 
 	"walet_rest_api/internal/domain/wallet"
+	"walet_rest_api/internal/domain/wallet/memory"
 
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
@@ -18,10 +22,39 @@ import (
 )
 
 type mockWalletService struct {
+	CreateWalletFunc                func(ctx context.Context, dto *wallet.WalletCreateDTO) (*wallet.Wallet, error)
 	ChangeBalanceWalletFunc         func(ctx context.Context, dto *wallet.WalletChangeBalanceDTO) (*wallet.Wallet, error)
-	GetBalanceWalletByWalletIDFunc  func(ctx context.Context, walletID string) (int, error)
+	ChangeBalanceBatchFunc          func(ctx context.Context, dto *wallet.BatchDTO) ([]wallet.BatchResult, error)
+	OpenBalanceFunc                 func(ctx context.Context, dto *wallet.OpenBalanceDTO) (*wallet.Wallet, error)
+	GetBalanceWalletByWalletIDFunc  func(ctx context.Context, walletID string) (*wallet.Wallet, error)
+	ListTransactionsFunc            func(ctx context.Context, filter *wallet.TransactionFilter) (*wallet.TransactionPage, error)
+	TransferFunc                    func(ctx context.Context, dto *wallet.TransferDTO) (*wallet.Transfer, error)
+	QuoteExchangeFunc               func(ctx context.Context, dto *wallet.QuoteDTO) (*wallet.Quote, error)
+	ExchangeFunc                    func(ctx context.Context, dto *wallet.ExchangeDTO) (*wallet.Exchange, error)
+	AuthorizeHoldFunc               func(ctx context.Context, dto *wallet.HoldDTO) (*wallet.Hold, error)
+	CaptureHoldFunc                 func(ctx context.Context, dto *wallet.CaptureDTO) (*wallet.Hold, error)
+	VoidHoldFunc                    func(ctx context.Context, holdID uuid.UUID) (*wallet.Hold, error)
+	ReverseTransactionFunc          func(ctx context.Context, dto *wallet.ReversalDTO) (*wallet.Transaction, error)
+	LastCreateWalletDTO             *wallet.WalletCreateDTO
 	LastChangeBalanceWalletDTO      *wallet.WalletChangeBalanceDTO
+	LastBatchDTO                    *wallet.BatchDTO
+	LastOpenBalanceDTO              *wallet.OpenBalanceDTO
 	LastGetBalanceWalletByWalletID  string
+	LastTransactionFilter           *wallet.TransactionFilter
+	LastTransferDTO                 *wallet.TransferDTO
+	LastQuoteDTO                    *wallet.QuoteDTO
+	LastExchangeDTO                 *wallet.ExchangeDTO
+	LastHoldDTO                     *wallet.HoldDTO
+	LastCaptureDTO                  *wallet.CaptureDTO
+	LastReversalDTO                 *wallet.ReversalDTO
+}
+
+func (m *mockWalletService) CreateWallet(ctx context.Context, dto *wallet.WalletCreateDTO) (*wallet.Wallet, error) {
+	m.LastCreateWalletDTO = dto
+	if m.CreateWalletFunc != nil {
+		return m.CreateWalletFunc(ctx, dto)
+	}
+	return nil, nil
 }
 
 func (m *mockWalletService) ChangeBalanceWallet(ctx context.Context, dto *wallet.WalletChangeBalanceDTO) (*wallet.Wallet, error) {
@@ -32,14 +65,101 @@ func (m *mockWalletService) ChangeBalanceWallet(ctx context.Context, dto *wallet
 	return nil, nil
 }
 
-func (m *mockWalletService) GetBalanceWalletByWalletID(ctx context.Context, walletID string) (int, error) {
+func (m *mockWalletService) ChangeBalanceBatch(ctx context.Context, dto *wallet.BatchDTO) ([]wallet.BatchResult, error) {
+	m.LastBatchDTO = dto
+	if m.ChangeBalanceBatchFunc != nil {
+		return m.ChangeBalanceBatchFunc(ctx, dto)
+	}
+	return nil, nil
+}
+
+func (m *mockWalletService) OpenBalance(ctx context.Context, dto *wallet.OpenBalanceDTO) (*wallet.Wallet, error) {
+	m.LastOpenBalanceDTO = dto
+	if m.OpenBalanceFunc != nil {
+		return m.OpenBalanceFunc(ctx, dto)
+	}
+	return &wallet.Wallet{ID: dto.WalletID}, nil
+}
+
+func (m *mockWalletService) GetBalanceWalletByWalletID(ctx context.Context, walletID string) (*wallet.Wallet, error) {
 	m.LastGetBalanceWalletByWalletID = walletID
 	if m.GetBalanceWalletByWalletIDFunc != nil {
 		return m.GetBalanceWalletByWalletIDFunc(ctx, walletID)
 	}
+	return &wallet.Wallet{}, nil
+}
+
+func (m *mockWalletService) ListTransactions(ctx context.Context, filter *wallet.TransactionFilter) (*wallet.TransactionPage, error) {
+	m.LastTransactionFilter = filter
+	if m.ListTransactionsFunc != nil {
+		return m.ListTransactionsFunc(ctx, filter)
+	}
+	return &wallet.TransactionPage{}, nil
+}
+
+func (m *mockWalletService) Transfer(ctx context.Context, dto *wallet.TransferDTO) (*wallet.Transfer, error) {
+	m.LastTransferDTO = dto
+	if m.TransferFunc != nil {
+		return m.TransferFunc(ctx, dto)
+	}
+	return &wallet.Transfer{}, nil
+}
+
+func (m *mockWalletService) QuoteExchange(ctx context.Context, dto *wallet.QuoteDTO) (*wallet.Quote, error) {
+	m.LastQuoteDTO = dto
+	if m.QuoteExchangeFunc != nil {
+		return m.QuoteExchangeFunc(ctx, dto)
+	}
+	return &wallet.Quote{}, nil
+}
+
+func (m *mockWalletService) Exchange(ctx context.Context, dto *wallet.ExchangeDTO) (*wallet.Exchange, error) {
+	m.LastExchangeDTO = dto
+	if m.ExchangeFunc != nil {
+		return m.ExchangeFunc(ctx, dto)
+	}
+	return &wallet.Exchange{}, nil
+}
+
+func (m *mockWalletService) AuthorizeHold(ctx context.Context, dto *wallet.HoldDTO) (*wallet.Hold, error) {
+	m.LastHoldDTO = dto
+	if m.AuthorizeHoldFunc != nil {
+		return m.AuthorizeHoldFunc(ctx, dto)
+	}
+	return &wallet.Hold{WalletID: dto.WalletID, Amount: dto.Amount, Status: wallet.HoldActive}, nil
+}
+
+func (m *mockWalletService) CaptureHold(ctx context.Context, dto *wallet.CaptureDTO) (*wallet.Hold, error) {
+	m.LastCaptureDTO = dto
+	if m.CaptureHoldFunc != nil {
+		return m.CaptureHoldFunc(ctx, dto)
+	}
+	return &wallet.Hold{ID: dto.HoldID, Status: wallet.HoldCaptured}, nil
+}
+
+func (m *mockWalletService) VoidHold(ctx context.Context, holdID uuid.UUID) (*wallet.Hold, error) {
+	if m.VoidHoldFunc != nil {
+		return m.VoidHoldFunc(ctx, holdID)
+	}
+	return &wallet.Hold{ID: holdID, Status: wallet.HoldVoided}, nil
+}
+
+func (m *mockWalletService) ExpireHolds(ctx context.Context) (int64, error) {
 	return 0, nil
 }
 
+func (m *mockWalletService) ReverseTransaction(ctx context.Context, dto *wallet.ReversalDTO) (*wallet.Transaction, error) {
+	m.LastReversalDTO = dto
+	if m.ReverseTransactionFunc != nil {
+		return m.ReverseTransactionFunc(ctx, dto)
+	}
+	return &wallet.Transaction{ID: uuid.New(), ReversalOf: &dto.TransactionID}, nil
+}
+
+func rub(amount int64) wallet.Money {
+	return wallet.NewMoney(amount, wallet.DefaultCurrency)
+}
+
 func setupTestRouter(t *testing.T, service wallet.Service) *gin.Engine {
 	t.Helper()
 	gin.SetMode(gin.TestMode)
@@ -52,6 +172,87 @@ func setupTestRouter(t *testing.T, service wallet.Service) *gin.Engine {
 	return router
 }
 
+func TestCreateWallet_Success(t *testing.T) {
+	mockService := &mockWalletService{}
+	router := setupTestRouter(t, mockService)
+
+	walletID := uuid.New()
+	body := `{"walletId":"` + walletID.String() + `","balance":100}`
+
+	mockService.CreateWalletFunc = func(ctx context.Context, dto *wallet.WalletCreateDTO) (*wallet.Wallet, error) {
+		assert.Equal(t, walletID, dto.ID)
+		assert.Equal(t, rub(10000), dto.Balance)
+		return &wallet.Wallet{ID: dto.ID, Balance: dto.Balance}, nil
+	}
+
+	req := httptest.NewRequest(http.MethodPost, walletCreateUrl, bytes.NewReader([]byte(body)))
+	req.Header.Set("Content-Type", "application/json")
+	rec := httptest.NewRecorder()
+
+	router.ServeHTTP(rec, req)
+
+	assert.Equal(t, http.StatusCreated, rec.Code)
+
+	var respBody map[string]interface{}
+	err := json.Unmarshal(rec.Body.Bytes(), &respBody)
+	assert.NoError(t, err)
+	assert.Equal(t, walletID.String(), respBody["wallet_id"])
+	assert.Equal(t, map[string]interface{}{"amount": "100.00", "currency": "RUB"}, respBody["balance"])
+}
+
+func TestCreateWallet_EmptyBody(t *testing.T) {
+	mockService := &mockWalletService{}
+	router := setupTestRouter(t, mockService)
+
+	mockService.CreateWalletFunc = func(ctx context.Context, dto *wallet.WalletCreateDTO) (*wallet.Wallet, error) {
+		return &wallet.Wallet{ID: uuid.New()}, nil
+	}
+
+	req := httptest.NewRequest(http.MethodPost, walletCreateUrl, bytes.NewReader([]byte(`{}`)))
+	req.Header.Set("Content-Type", "application/json")
+	rec := httptest.NewRecorder()
+
+	router.ServeHTTP(rec, req)
+
+	assert.Equal(t, http.StatusCreated, rec.Code)
+	assert.Equal(t, uuid.Nil, mockService.LastCreateWalletDTO.ID)
+	assert.Equal(t, rub(0), mockService.LastCreateWalletDTO.Balance)
+}
+
+func TestCreateWallet_NegativeBalance(t *testing.T) {
+	mockService := &mockWalletService{}
+	router := setupTestRouter(t, mockService)
+
+	req := httptest.NewRequest(http.MethodPost, walletCreateUrl, bytes.NewReader([]byte(`{"balance":-1}`)))
+	req.Header.Set("Content-Type", "application/json")
+	rec := httptest.NewRecorder()
+
+	router.ServeHTTP(rec, req)
+
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+	assert.Nil(t, mockService.LastCreateWalletDTO)
+}
+
+func TestCreateWallet_AlreadyExists(t *testing.T) {
+	mockService := &mockWalletService{}
+	router := setupTestRouter(t, mockService)
+
+	walletID := uuid.New()
+	body := `{"walletId":"` + walletID.String() + `"}`
+
+	mockService.CreateWalletFunc = func(ctx context.Context, dto *wallet.WalletCreateDTO) (*wallet.Wallet, error) {
+		return nil, &wallet.WalletError{WalletID: walletID, Err: wallet.ErrWalletAlreadyExists}
+	}
+
+	req := httptest.NewRequest(http.MethodPost, walletCreateUrl, bytes.NewReader([]byte(body)))
+	req.Header.Set("Content-Type", "application/json")
+	rec := httptest.NewRecorder()
+
+	router.ServeHTTP(rec, req)
+
+	assert.Equal(t, http.StatusConflict, rec.Code)
+}
+
 func TestChangeBalanceWallet_Success(t *testing.T) {
 	mockService := &mockWalletService{}
 	router := setupTestRouter(t, mockService)
@@ -60,7 +261,7 @@ func TestChangeBalanceWallet_Success(t *testing.T) {
 	reqBody := changeBalanceRequest{
 		WalletID:      walletID,
 		OperationType: "deposit",
-		Amount:        100,
+		Amount:        "100",
 	}
 
 	bodyBytes, err := json.Marshal(reqBody)
@@ -68,13 +269,13 @@ func TestChangeBalanceWallet_Success(t *testing.T) {
 
 	expectedWallet := &wallet.Wallet{
 		ID:      walletID,
-		Balance: 200,
+		Balance: rub(20000),
 	}
 
 	mockService.ChangeBalanceWalletFunc = func(ctx context.Context, dto *wallet.WalletChangeBalanceDTO) (*wallet.Wallet, error) {
 		assert.Equal(t, walletID, dto.ID)
 		assert.Equal(t, "DEPOSIT", dto.OperationType)
-		assert.Equal(t, 100, dto.Balance)
+		assert.Equal(t, rub(10000), dto.Amount)
 		return expectedWallet, nil
 	}
 
@@ -90,7 +291,130 @@ func TestChangeBalanceWallet_Success(t *testing.T) {
 	err = json.Unmarshal(rec.Body.Bytes(), &respBody)
 	assert.NoError(t, err)
 	assert.Equal(t, expectedWallet.ID.String(), respBody["wallet_id"])
-	assert.EqualValues(t, expectedWallet.Balance, respBody["balance"])
+	assert.Equal(t, map[string]interface{}{"amount": "200.00", "currency": "RUB"}, respBody["balance"])
+}
+
+func TestChangeBalanceWallet_IdempotencyKey(t *testing.T) {
+	mockService := &mockWalletService{}
+	router := setupTestRouter(t, mockService)
+
+	walletID := uuid.New()
+	body := `{"walletId":"` + walletID.String() + `","operationType":"DEPOSIT","amount":100}`
+
+	var fingerprints []string
+	mockService.ChangeBalanceWalletFunc = func(ctx context.Context, dto *wallet.WalletChangeBalanceDTO) (*wallet.Wallet, error) {
+		assert.Equal(t, "retry-1", dto.Idempotency.Key)
+		fingerprints = append(fingerprints, dto.Idempotency.Fingerprint)
+		dto.Idempotency.Replayed = len(fingerprints) > 1
+		return &wallet.Wallet{ID: walletID, Balance: rub(10000)}, nil
+	}
+
+	for i := 0; i < 2; i++ {
+		req := httptest.NewRequest(http.MethodPost, walletChangeBalance, bytes.NewReader([]byte(body)))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set(idempotencyKeyHeader, "retry-1")
+		rec := httptest.NewRecorder()
+
+		router.ServeHTTP(rec, req)
+
+		assert.Equal(t, http.StatusOK, rec.Code)
+		if i == 0 {
+			assert.Empty(t, rec.Header().Get(idempotentReplayedHeader))
+		} else {
+			assert.Equal(t, "true", rec.Header().Get(idempotentReplayedHeader))
+		}
+	}
+
+	assert.Len(t, fingerprints, 2)
+	assert.Equal(t, fingerprints[0], fingerprints[1])
+}
+
+func TestChangeBalanceWallet_IdempotencyFingerprintDependsOnPayload(t *testing.T) {
+	a := wallet.WalletChangeBalanceDTO{ID: uuid.New(), OperationType: "DEPOSIT", Amount: rub(100)}
+	b := a
+	b.Amount = rub(101)
+	c := a
+	c.Amount = wallet.NewMoney(100, "USD")
+	version := int64(5)
+	d := a
+	d.ExpectedVersion = &version
+	otherVersion := int64(6)
+	e := a
+	e.ExpectedVersion = &otherVersion
+
+	assert.Equal(t, fingerprint(&a), fingerprint(&a))
+	assert.NotEqual(t, fingerprint(&a), fingerprint(&b))
+	assert.NotEqual(t, fingerprint(&a), fingerprint(&c))
+	assert.NotEqual(t, fingerprint(&a), fingerprint(&d))
+	assert.NotEqual(t, fingerprint(&d), fingerprint(&e))
+}
+
+func TestChangeBalanceWallet_IdempotencyConflict(t *testing.T) {
+	mockService := &mockWalletService{}
+	router := setupTestRouter(t, mockService)
+
+	body := `{"walletId":"` + uuid.New().String() + `","operationType":"DEPOSIT","amount":100}`
+
+	mockService.ChangeBalanceWalletFunc = func(ctx context.Context, dto *wallet.WalletChangeBalanceDTO) (*wallet.Wallet, error) {
+		return nil, fmt.Errorf("%w: %q", wallet.ErrIdempotencyKeyReused, "retry-1")
+	}
+
+	req := httptest.NewRequest(http.MethodPost, walletChangeBalance, bytes.NewReader([]byte(body)))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(idempotencyKeyHeader, "retry-1")
+	rec := httptest.NewRecorder()
+
+	router.ServeHTTP(rec, req)
+
+	assert.Equal(t, http.StatusConflict, rec.Code)
+}
+
+func TestChangeBalanceWallet_DecimalAmount(t *testing.T) {
+	cases := []struct {
+		amount string
+		minor  int64
+	}{
+		{`"10.05"`, 1005},
+		{`10.05`, 1005},
+		{`"7"`, 700},
+		{`0.1`, 10},
+	}
+
+	for _, tc := range cases {
+		mockService := &mockWalletService{}
+		router := setupTestRouter(t, mockService)
+
+		mockService.ChangeBalanceWalletFunc = func(ctx context.Context, dto *wallet.WalletChangeBalanceDTO) (*wallet.Wallet, error) {
+			return &wallet.Wallet{ID: dto.ID, Balance: dto.Amount}, nil
+		}
+
+		body := `{"walletId":"` + uuid.New().String() + `","operationType":"DEPOSIT","amount":` + tc.amount + `}`
+		req := httptest.NewRequest(http.MethodPost, walletChangeBalance, bytes.NewReader([]byte(body)))
+		req.Header.Set("Content-Type", "application/json")
+		rec := httptest.NewRecorder()
+
+		router.ServeHTTP(rec, req)
+
+		assert.Equal(t, http.StatusOK, rec.Code, tc.amount)
+		assert.Equal(t, rub(tc.minor), mockService.LastChangeBalanceWalletDTO.Amount, tc.amount)
+	}
+}
+
+func TestChangeBalanceWallet_InvalidAmount(t *testing.T) {
+	for _, amount := range []string{`"10.001"`, `"-5"`, `"ten"`, `1e3`, `true`} {
+		mockService := &mockWalletService{}
+		router := setupTestRouter(t, mockService)
+
+		body := `{"walletId":"` + uuid.New().String() + `","operationType":"DEPOSIT","amount":` + amount + `}`
+		req := httptest.NewRequest(http.MethodPost, walletChangeBalance, bytes.NewReader([]byte(body)))
+		req.Header.Set("Content-Type", "application/json")
+		rec := httptest.NewRecorder()
+
+		router.ServeHTTP(rec, req)
+
+		assert.Equal(t, http.StatusBadRequest, rec.Code, amount)
+		assert.Nil(t, mockService.LastChangeBalanceWalletDTO, amount)
+	}
 }
 
 func TestChangeBalanceWallet_InvalidBody(t *testing.T) {
@@ -110,7 +434,43 @@ func TestChangeBalanceWallet_InvalidBody(t *testing.T) {
 	var respBody map[string]interface{}
 	err := json.Unmarshal(rec.Body.Bytes(), &respBody)
 	assert.NoError(t, err)
-	assert.Equal(t, "Invalid request body", respBody["error"])
+	assert.Equal(t, codeInvalidRequest, respBody["code"])
+	assert.Equal(t, problemContentType, rec.Header().Get("Content-Type"))
+}
+
+func TestChangeBalanceWallet_InvalidBodyDetail(t *testing.T) {
+	mockService := &mockWalletService{}
+	router := setupTestRouter(t, mockService)
+
+	tests := []struct {
+		url    string
+		body   string
+		detail string
+	}{
+		{walletChangeBalance, `{"walletId":"` + uuid.New().String() + `","amount":"1.00"}`, "invalid request body: operationType is required"},
+		{walletChangeBalance, `{"walletId":"` + uuid.New().String() + `","operationType":5,"amount":"1.00"}`, "invalid request body: operationType must not be a JSON number"},
+		{walletChangeBalance, `{"walletId":`, "invalid request body: malformed JSON"},
+		{walletChangeBalance, ``, "invalid request body: the body is empty"},
+		{walletBatchUrl, `{"operations":[{"walletId":"` + uuid.New().String() + `","amount":"1"}]}`, "invalid request body: operations[0].operationType is required"},
+		{walletBatchUrl, `{"operations":[]}`, "invalid request body: operations must not have fewer than 1 items"},
+	}
+
+	for _, tc := range tests {
+		req := httptest.NewRequest(http.MethodPost, tc.url, bytes.NewBufferString(tc.body))
+		req.Header.Set("Content-Type", "application/json")
+		rec := httptest.NewRecorder()
+
+		router.ServeHTTP(rec, req)
+
+		assert.Equal(t, http.StatusBadRequest, rec.Code, tc.body)
+
+		var respBody map[string]interface{}
+		assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &respBody), tc.body)
+		assert.Equal(t, tc.detail, respBody["detail"], tc.body)
+		//Имена Go-структур и полей не попадают в ответ
+		assert.NotContains(t, rec.Body.String(), "Request", tc.body)
+		assert.NotContains(t, rec.Body.String(), "OperationType", tc.body)
+	}
 }
 
 func TestChangeBalanceWallet_InvalidOperationType(t *testing.T) {
@@ -121,7 +481,7 @@ func TestChangeBalanceWallet_InvalidOperationType(t *testing.T) {
 	reqBody := changeBalanceRequest{
 		WalletID:      walletID,
 		OperationType: "unknown",
-		Amount:        100,
+		Amount:        "100",
 	}
 
 	bodyBytes, err := json.Marshal(reqBody)
@@ -138,7 +498,8 @@ func TestChangeBalanceWallet_InvalidOperationType(t *testing.T) {
 	var respBody map[string]interface{}
 	err = json.Unmarshal(rec.Body.Bytes(), &respBody)
 	assert.NoError(t, err)
-	assert.Equal(t, "operationType must be DEPOSIT or WITHDRAW", respBody["error"])
+	assert.Equal(t, codeInvalidOperation, respBody["code"])
+	assert.Equal(t, "operationType must be DEPOSIT or WITHDRAW", respBody["detail"])
 }
 
 func TestChangeBalanceWallet_NotFound(t *testing.T) {
@@ -149,14 +510,14 @@ func TestChangeBalanceWallet_NotFound(t *testing.T) {
 	reqBody := changeBalanceRequest{
 		WalletID:      walletID,
 		OperationType: "WITHDRAW",
-		Amount:        50,
+		Amount:        "50",
 	}
 
 	bodyBytes, err := json.Marshal(reqBody)
 	assert.NoError(t, err)
 
 	mockService.ChangeBalanceWalletFunc = func(ctx context.Context, dto *wallet.WalletChangeBalanceDTO) (*wallet.Wallet, error) {
-		return nil, errors.New("wallet not found")
+		return nil, &wallet.WalletError{WalletID: walletID, Err: wallet.ErrWalletNotFound}
 	}
 
 	req := httptest.NewRequest(http.MethodPost, walletChangeBalance, bytes.NewReader(bodyBytes))
@@ -170,7 +531,8 @@ func TestChangeBalanceWallet_NotFound(t *testing.T) {
 	var respBody map[string]interface{}
 	err = json.Unmarshal(rec.Body.Bytes(), &respBody)
 	assert.NoError(t, err)
-	assert.Equal(t, "wallet not found", respBody["error"])
+	assert.Equal(t, codeWalletNotFound, respBody["code"])
+	assert.Equal(t, "wallet not found: "+walletID.String(), respBody["detail"])
 }
 
 func TestChangeBalanceWallet_InsufficientBalance(t *testing.T) {
@@ -181,14 +543,14 @@ func TestChangeBalanceWallet_InsufficientBalance(t *testing.T) {
 	reqBody := changeBalanceRequest{
 		WalletID:      walletID,
 		OperationType: "WITHDRAW",
-		Amount:        150,
+		Amount:        "150",
 	}
 
 	bodyBytes, err := json.Marshal(reqBody)
 	assert.NoError(t, err)
 
 	mockService.ChangeBalanceWalletFunc = func(ctx context.Context, dto *wallet.WalletChangeBalanceDTO) (*wallet.Wallet, error) {
-		return nil, errors.New("insufficient balance")
+		return nil, &wallet.WalletError{WalletID: walletID, Err: wallet.ErrInsufficientFunds}
 	}
 
 	req := httptest.NewRequest(http.MethodPost, walletChangeBalance, bytes.NewReader(bodyBytes))
@@ -202,7 +564,8 @@ func TestChangeBalanceWallet_InsufficientBalance(t *testing.T) {
 	var respBody map[string]interface{}
 	err = json.Unmarshal(rec.Body.Bytes(), &respBody)
 	assert.NoError(t, err)
-	assert.Equal(t, "insufficient balance", respBody["error"])
+	assert.Equal(t, codeInsufficientFunds, respBody["code"])
+	assert.True(t, strings.HasPrefix(respBody["detail"].(string), "insufficient funds"))
 }
 
 func TestChangeBalanceWallet_InvalidOperationTypeFromService(t *testing.T) {
@@ -213,14 +576,14 @@ func TestChangeBalanceWallet_InvalidOperationTypeFromService(t *testing.T) {
 	reqBody := changeBalanceRequest{
 		WalletID:      walletID,
 		OperationType: "DEPOSIT",
-		Amount:        100,
+		Amount:        "100",
 	}
 
 	bodyBytes, err := json.Marshal(reqBody)
 	assert.NoError(t, err)
 
 	mockService.ChangeBalanceWalletFunc = func(ctx context.Context, dto *wallet.WalletChangeBalanceDTO) (*wallet.Wallet, error) {
-		return nil, errors.New("invalid operation type")
+		return nil, fmt.Errorf("%w: %s", wallet.ErrInvalidOperation, dto.OperationType)
 	}
 
 	req := httptest.NewRequest(http.MethodPost, walletChangeBalance, bytes.NewReader(bodyBytes))
@@ -234,7 +597,8 @@ func TestChangeBalanceWallet_InvalidOperationTypeFromService(t *testing.T) {
 	var respBody map[string]interface{}
 	err = json.Unmarshal(rec.Body.Bytes(), &respBody)
 	assert.NoError(t, err)
-	assert.Equal(t, "invalid operation type", respBody["error"])
+	assert.Equal(t, codeInvalidOperation, respBody["code"])
+	assert.Equal(t, "invalid operation: DEPOSIT", respBody["detail"])
 }
 
 func TestChangeBalanceWallet_InternalError(t *testing.T) {
@@ -245,7 +609,7 @@ func TestChangeBalanceWallet_InternalError(t *testing.T) {
 	reqBody := changeBalanceRequest{
 		WalletID:      walletID,
 		OperationType: "DEPOSIT",
-		Amount:        100,
+		Amount:        "100",
 	}
 
 	bodyBytes, err := json.Marshal(reqBody)
@@ -266,7 +630,8 @@ func TestChangeBalanceWallet_InternalError(t *testing.T) {
 	var respBody map[string]interface{}
 	err = json.Unmarshal(rec.Body.Bytes(), &respBody)
 	assert.NoError(t, err)
-	assert.Equal(t, "some internal error", respBody["error"])
+	assert.Equal(t, codeInternal, respBody["code"])
+	assert.Nil(t, respBody["detail"])
 }
 
 func TestGetWalletByUUID_Success(t *testing.T) {
@@ -275,9 +640,19 @@ func TestGetWalletByUUID_Success(t *testing.T) {
 
 	walletUUID := uuid.New().String()
 
-	mockService.GetBalanceWalletByWalletIDFunc = func(ctx context.Context, walletID string) (int, error) {
+	mockService.GetBalanceWalletByWalletIDFunc = func(ctx context.Context, walletID string) (*wallet.Wallet, error) {
 		assert.Equal(t, walletUUID, walletID)
-		return 500, nil
+		return &wallet.Wallet{
+			ID:       uuid.MustParse(walletID),
+			Version:  7,
+			Currency: "RUB",
+			Balance:  rub(50000),
+			Available: &wallet.Money{Amount: 40000, Currency: "RUB"},
+			Balances: []wallet.SubBalance{
+				{Balance: rub(50000), Available: rub(40000)},
+				{Balance: wallet.NewMoney(1250, "USD"), Available: wallet.NewMoney(1250, "USD")},
+			},
+		}, nil
 	}
 
 	url := "/api/v1/wallets/" + walletUUID
@@ -291,7 +666,82 @@ func TestGetWalletByUUID_Success(t *testing.T) {
 	var respBody map[string]interface{}
 	err := json.Unmarshal(rec.Body.Bytes(), &respBody)
 	assert.NoError(t, err)
-	assert.EqualValues(t, 500, respBody["balance"])
+	assert.Equal(t, map[string]interface{}{"amount": "500.00", "currency": "RUB"}, respBody["balance"])
+	assert.Equal(t, map[string]interface{}{"amount": "400.00", "currency": "RUB"}, respBody["available"])
+	assert.Equal(t, "RUB", respBody["currency"])
+	assert.Len(t, respBody["balances"], 2)
+	assert.Equal(t, `"7"`, rec.Header().Get(etagHeader))
+}
+
+func TestGetWalletByUUID_Consistency(t *testing.T) {
+	mockService := &mockWalletService{}
+	router := setupTestRouter(t, mockService)
+
+	walletUUID := uuid.New().String()
+
+	var strong bool
+	mockService.GetBalanceWalletByWalletIDFunc = func(ctx context.Context, walletID string) (*wallet.Wallet, error) {
+		strong = wallet.StrongConsistency(ctx)
+		return &wallet.Wallet{ID: uuid.MustParse(walletID), Currency: "RUB", Balance: rub(100)}, nil
+	}
+
+	tests := []struct {
+		query      string
+		wantStatus int
+		wantStrong bool
+	}{
+		{"", http.StatusOK, false},
+		{"?consistency=eventual", http.StatusOK, false},
+		{"?consistency=strong", http.StatusOK, true},
+		{"?consistency=linearizable", http.StatusBadRequest, false},
+	}
+
+	for _, tt := range tests {
+		strong = false
+
+		req := httptest.NewRequest(http.MethodGet, "/api/v1/wallets/"+walletUUID+tt.query, nil)
+		rec := httptest.NewRecorder()
+
+		router.ServeHTTP(rec, req)
+
+		assert.Equal(t, tt.wantStatus, rec.Code, tt.query)
+		assert.Equal(t, tt.wantStrong, strong, tt.query)
+	}
+}
+
+func TestGetWalletByUUID_NotFound(t *testing.T) {
+	mockService := &mockWalletService{}
+	router := setupTestRouter(t, mockService)
+
+	walletUUID := uuid.New().String()
+
+	mockService.GetBalanceWalletByWalletIDFunc = func(ctx context.Context, walletID string) (*wallet.Wallet, error) {
+		return nil, fmt.Errorf("%w: %s", wallet.ErrWalletNotFound, walletID)
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/wallets/"+walletUUID, nil)
+	rec := httptest.NewRecorder()
+
+	router.ServeHTTP(rec, req)
+
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+}
+
+func TestGetWalletByUUID_MalformedUUID(t *testing.T) {
+	mockService := &mockWalletService{}
+	router := setupTestRouter(t, mockService)
+
+	mockService.GetBalanceWalletByWalletIDFunc = func(ctx context.Context, walletID string) (*wallet.Wallet, error) {
+		return nil, fmt.Errorf("%w: %q", wallet.ErrInvalidWalletID, walletID)
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/wallets/not-a-uuid", nil)
+	rec := httptest.NewRecorder()
+
+	router.ServeHTTP(rec, req)
+
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+	assert.NotContains(t, rec.Body.String(), "pgx")
 }
 
 func TestGetWalletByUUID_EmptyParam(t *testing.T) {
@@ -313,8 +763,8 @@ func TestGetWalletByUUID_ServiceError(t *testing.T) {
 
 	walletUUID := uuid.New().String()
 
-	mockService.GetBalanceWalletByWalletIDFunc = func(ctx context.Context, walletID string) (int, error) {
-		return 0, errors.New("db error")
+	mockService.GetBalanceWalletByWalletIDFunc = func(ctx context.Context, walletID string) (*wallet.Wallet, error) {
+		return nil, errors.New("db error")
 	}
 
 	url := "/api/v1/wallets/" + walletUUID
@@ -328,44 +778,734 @@ func TestGetWalletByUUID_ServiceError(t *testing.T) {
 	var respBody map[string]interface{}
 	err := json.Unmarshal(rec.Body.Bytes(), &respBody)
 	assert.NoError(t, err)
-	assert.Equal(t, "db error", respBody["error"])
+	assert.Equal(t, codeInternal, respBody["code"])
+	assert.Nil(t, respBody["detail"])
 }
 
-func TestRegisterRoutes(t *testing.T) {
+func TestListTransactions_Success(t *testing.T) {
 	mockService := &mockWalletService{}
-	gin.SetMode(gin.TestMode)
-	router := gin.New()
-	logger := logrus.New()
+	router := setupTestRouter(t, mockService)
 
-	mockService.GetBalanceWalletByWalletIDFunc = func(ctx context.Context, walletID string) (int, error) {
-		return 0, nil
-	}
-	mockService.ChangeBalanceWalletFunc = func(ctx context.Context, dto *wallet.WalletChangeBalanceDTO) (*wallet.Wallet, error) {
-		return &wallet.Wallet{
-			ID:      uuid.New(),
-			Balance: 10,
+	walletID := uuid.New()
+	after := uuid.New()
+	txID := uuid.New()
+	nextCursor := txID
+
+	mockService.ListTransactionsFunc = func(ctx context.Context, filter *wallet.TransactionFilter) (*wallet.TransactionPage, error) {
+		return &wallet.TransactionPage{
+			Transactions: []wallet.Transaction{{
+				ID:            txID,
+				WalletID:      walletID,
+				OperationType: "WITHDRAW",
+				Amount:        rub(3000),
+				BalanceAfter:  rub(7000),
+			}},
+			NextCursor: &nextCursor,
 		}, nil
 	}
 
-	h := NewHandlers(mockService, logger)
-	h.RegisterRoutes(router)
+	url := "/api/v1/wallets/" + walletID.String() + "/transactions?after=" + after.String() +
+		"&limit=1&operation_type=withdraw&from=2024-01-01T00:00:00Z&to=2024-02-01T00:00:00Z&order=asc"
+	req := httptest.NewRequest(http.MethodGet, url, nil)
+	rec := httptest.NewRecorder()
 
-	// Check that routes are registered and respond with some status (not 404)
-	walletUUID := uuid.New().String()
+	router.ServeHTTP(rec, req)
 
-	// GET wallet by UUID
-	getReq := httptest.NewRequest(http.MethodGet, "/api/v1/wallets/"+walletUUID, nil)
-	getRec := httptest.NewRecorder()
-	router.ServeHTTP(getRec, getReq)
-	assert.NotEqual(t, http.StatusNotFound, getRec.Code)
+	assert.Equal(t, http.StatusOK, rec.Code)
 
-	// POST change balance
-	body := `{"walletId":"` + uuid.New().String() + `","operationType":"DEPOSIT","amount":10}`
-	postReq := httptest.NewRequest(http.MethodPost, "/api/v1/wallet", bytes.NewReader([]byte(body)))
-	postReq.Header.Set("Content-Type", "application/json")
-	postRec := httptest.NewRecorder()
-	router.ServeHTTP(postRec, postReq)
-	assert.NotEqual(t, http.StatusNotFound, postRec.Code)
+	filter := mockService.LastTransactionFilter
+	assert.Equal(t, walletID, filter.WalletID)
+	assert.Equal(t, after, *filter.After)
+	assert.Equal(t, 1, filter.Limit)
+	assert.Equal(t, "WITHDRAW", filter.OperationType)
+	assert.Equal(t, "2024-01-01T00:00:00Z", filter.From.Format(time.RFC3339))
+	assert.Equal(t, "2024-02-01T00:00:00Z", filter.To.Format(time.RFC3339))
+	assert.True(t, filter.Ascending)
+
+	var respBody map[string]interface{}
+	err := json.Unmarshal(rec.Body.Bytes(), &respBody)
+	assert.NoError(t, err)
+	assert.Equal(t, txID.String(), respBody["next_cursor"])
+	assert.Len(t, respBody["transactions"], 1)
+}
+
+func TestListTransactions_InvalidQuery(t *testing.T) {
+	walletID := uuid.New().String()
+
+	cases := []string{
+		"/api/v1/wallets/not-a-uuid/transactions",
+		"/api/v1/wallets/" + walletID + "/transactions?limit=0",
+		"/api/v1/wallets/" + walletID + "/transactions?limit=1000",
+		"/api/v1/wallets/" + walletID + "/transactions?after=42",
+		"/api/v1/wallets/" + walletID + "/transactions?operation_type=refund",
+		"/api/v1/wallets/" + walletID + "/transactions?from=yesterday",
+		"/api/v1/wallets/" + walletID + "/transactions?from=2024-02-01T00:00:00Z&to=2024-01-01T00:00:00Z",
+		"/api/v1/wallets/" + walletID + "/transactions?order=random",
+	}
+
+	for _, url := range cases {
+		mockService := &mockWalletService{}
+		router := setupTestRouter(t, mockService)
+
+		req := httptest.NewRequest(http.MethodGet, url, nil)
+		rec := httptest.NewRecorder()
+
+		router.ServeHTTP(rec, req)
+
+		assert.Equal(t, http.StatusBadRequest, rec.Code, url)
+		assert.Nil(t, mockService.LastTransactionFilter, url)
+	}
+}
+
+func TestListTransactions_WalletNotFound(t *testing.T) {
+	mockService := &mockWalletService{}
+	router := setupTestRouter(t, mockService)
+
+	mockService.ListTransactionsFunc = func(ctx context.Context, filter *wallet.TransactionFilter) (*wallet.TransactionPage, error) {
+		return nil, &wallet.WalletError{WalletID: filter.WalletID, Err: wallet.ErrWalletNotFound}
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/wallets/"+uuid.New().String()+"/transactions", nil)
+	rec := httptest.NewRecorder()
+
+	router.ServeHTTP(rec, req)
+
+	assert.Equal(t, http.StatusNotFound, rec.Code)
 }
 
+func TestTransfer_Success(t *testing.T) {
+	mockService := &mockWalletService{}
+	router := setupTestRouter(t, mockService)
+
+	fromID, toID := uuid.New(), uuid.New()
+	body := `{"fromWalletId":"` + fromID.String() + `","toWalletId":"` + toID.String() + `","amount":40}`
+
+	mockService.TransferFunc = func(ctx context.Context, dto *wallet.TransferDTO) (*wallet.Transfer, error) {
+		assert.Equal(t, fromID, dto.FromID)
+		assert.Equal(t, toID, dto.ToID)
+		assert.Equal(t, rub(4000), dto.Amount)
+		return &wallet.Transfer{
+			ID:     uuid.New(),
+			Amount: dto.Amount,
+			From:   wallet.Wallet{ID: fromID, Balance: rub(6000)},
+			To:     wallet.Wallet{ID: toID, Balance: rub(4000)},
+		}, nil
+	}
 
+	req := httptest.NewRequest(http.MethodPost, transfersUrl, bytes.NewReader([]byte(body)))
+	req.Header.Set("Content-Type", "application/json")
+	rec := httptest.NewRecorder()
+
+	router.ServeHTTP(rec, req)
+
+	assert.Equal(t, http.StatusCreated, rec.Code)
+
+	var respBody map[string]interface{}
+	err := json.Unmarshal(rec.Body.Bytes(), &respBody)
+	assert.NoError(t, err)
+	assert.Equal(t, "60.00", respBody["from"].(map[string]interface{})["balance"].(map[string]interface{})["amount"])
+	assert.Equal(t, "40.00", respBody["to"].(map[string]interface{})["balance"].(map[string]interface{})["amount"])
+}
+
+func TestTransfer_Errors(t *testing.T) {
+	cases := []struct {
+		err    error
+		status int
+	}{
+		{&wallet.WalletError{WalletID: uuid.New(), Err: wallet.ErrWalletNotFound}, http.StatusNotFound},
+		{&wallet.WalletError{WalletID: uuid.New(), Err: wallet.ErrInsufficientFunds}, http.StatusBadRequest},
+		{fmt.Errorf("%w: source and destination wallets must differ", wallet.ErrInvalidOperation), http.StatusBadRequest},
+		{errors.New("failed to commit transaction"), http.StatusInternalServerError},
+	}
+
+	for _, tc := range cases {
+		mockService := &mockWalletService{}
+		router := setupTestRouter(t, mockService)
+
+		mockService.TransferFunc = func(ctx context.Context, dto *wallet.TransferDTO) (*wallet.Transfer, error) {
+			return nil, tc.err
+		}
+
+		body := `{"fromWalletId":"` + uuid.New().String() + `","toWalletId":"` + uuid.New().String() + `","amount":40}`
+		req := httptest.NewRequest(http.MethodPost, transfersUrl, bytes.NewReader([]byte(body)))
+		req.Header.Set("Content-Type", "application/json")
+		rec := httptest.NewRecorder()
+
+		router.ServeHTTP(rec, req)
+
+		assert.Equal(t, tc.status, rec.Code, tc.err.Error())
+	}
+}
+
+func TestProblemResponse_Fields(t *testing.T) {
+	mockService := &mockWalletService{}
+	router := setupTestRouter(t, mockService)
+
+	walletID := uuid.New()
+	mockService.GetBalanceWalletByWalletIDFunc = func(ctx context.Context, id string) (*wallet.Wallet, error) {
+		return nil, &wallet.WalletError{WalletID: walletID, Err: wallet.ErrWalletNotFound}
+	}
+
+	url := "/api/v1/wallets/" + walletID.String()
+	req := httptest.NewRequest(http.MethodGet, url, nil)
+	req.Header.Set(requestIDHeader, "req-123")
+	rec := httptest.NewRecorder()
+
+	router.ServeHTTP(rec, req)
+
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+	assert.Equal(t, problemContentType, rec.Header().Get("Content-Type"))
+	assert.Equal(t, "req-123", rec.Header().Get(requestIDHeader))
+
+	var body problem
+	err := json.Unmarshal(rec.Body.Bytes(), &body)
+	assert.NoError(t, err)
+	assert.Equal(t, problem{
+		Type:      problemTypePrefix + codeWalletNotFound,
+		Title:     "Wallet not found",
+		Status:    http.StatusNotFound,
+		Detail:    "wallet not found: " + walletID.String(),
+		Instance:  url,
+		Code:      codeWalletNotFound,
+		RequestID: "req-123",
+	}, body)
+}
+
+func TestProblemResponse_GeneratesRequestID(t *testing.T) {
+	mockService := &mockWalletService{}
+	router := setupTestRouter(t, mockService)
+
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/unknown", nil)
+	rec := httptest.NewRecorder()
+
+	router.ServeHTTP(rec, req)
+
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+
+	var body problem
+	err := json.Unmarshal(rec.Body.Bytes(), &body)
+	assert.NoError(t, err)
+	assert.Equal(t, codeRouteNotFound, body.Code)
+	assert.NotEmpty(t, body.RequestID)
+	assert.Equal(t, body.RequestID, rec.Header().Get(requestIDHeader))
+}
+
+func TestRegisterRoutes(t *testing.T) {
+	mockService := &mockWalletService{}
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	logger := logrus.New()
+
+	mockService.GetBalanceWalletByWalletIDFunc = func(ctx context.Context, walletID string) (*wallet.Wallet, error) {
+		return &wallet.Wallet{}, nil
+	}
+	mockService.ChangeBalanceWalletFunc = func(ctx context.Context, dto *wallet.WalletChangeBalanceDTO) (*wallet.Wallet, error) {
+		return &wallet.Wallet{
+			ID:      uuid.New(),
+			Balance: rub(1000),
+		}, nil
+	}
+
+	h := NewHandlers(mockService, logger)
+	h.RegisterRoutes(router)
+
+	// Check that routes are registered and respond with some status (not 404)
+	walletUUID := uuid.New().String()
+
+	// GET wallet by UUID
+	getReq := httptest.NewRequest(http.MethodGet, "/api/v1/wallets/"+walletUUID, nil)
+	getRec := httptest.NewRecorder()
+	router.ServeHTTP(getRec, getReq)
+	assert.NotEqual(t, http.StatusNotFound, getRec.Code)
+
+	// POST change balance
+	body := `{"walletId":"` + uuid.New().String() + `","operationType":"DEPOSIT","amount":10}`
+	postReq := httptest.NewRequest(http.MethodPost, "/api/v1/wallet", bytes.NewReader([]byte(body)))
+	postReq.Header.Set("Content-Type", "application/json")
+	postRec := httptest.NewRecorder()
+	router.ServeHTTP(postRec, postReq)
+	assert.NotEqual(t, http.StatusNotFound, postRec.Code)
+}
+
+func TestChangeBalanceWallet_Currency(t *testing.T) {
+	mockService := &mockWalletService{}
+	router := setupTestRouter(t, mockService)
+
+	walletID := uuid.New()
+	mockService.ChangeBalanceWalletFunc = func(ctx context.Context, dto *wallet.WalletChangeBalanceDTO) (*wallet.Wallet, error) {
+		return &wallet.Wallet{ID: dto.ID, Balance: dto.Amount}, nil
+	}
+
+	body := `{"walletId":"` + walletID.String() + `","operationType":"DEPOSIT","amount":"12.50","currency":"usd"}`
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/wallet", bytes.NewBufferString(body))
+	req.Header.Set("Content-Type", "application/json")
+	rec := httptest.NewRecorder()
+
+	router.ServeHTTP(rec, req)
+
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, wallet.NewMoney(1250, "USD"), mockService.LastChangeBalanceWalletDTO.Amount)
+}
+
+func TestChangeBalanceWallet_CurrencyMismatch(t *testing.T) {
+	mockService := &mockWalletService{}
+	router := setupTestRouter(t, mockService)
+
+	walletID := uuid.New()
+	mockService.ChangeBalanceWalletFunc = func(ctx context.Context, dto *wallet.WalletChangeBalanceDTO) (*wallet.Wallet, error) {
+		return nil, fmt.Errorf("%w: wallet %v holds no %s balance", wallet.ErrCurrencyMismatch, dto.ID, dto.Amount.Currency)
+	}
+
+	body := `{"walletId":"` + walletID.String() + `","operationType":"WITHDRAW","amount":"1","currency":"EUR"}`
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/wallet", bytes.NewBufferString(body))
+	req.Header.Set("Content-Type", "application/json")
+	rec := httptest.NewRecorder()
+
+	router.ServeHTTP(rec, req)
+
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+
+	var respBody map[string]interface{}
+	err := json.Unmarshal(rec.Body.Bytes(), &respBody)
+	assert.NoError(t, err)
+	assert.Equal(t, codeCurrencyMismatch, respBody["code"])
+	assert.Contains(t, respBody["detail"], "EUR")
+}
+
+func TestOpenBalance_Success(t *testing.T) {
+	mockService := &mockWalletService{}
+	router := setupTestRouter(t, mockService)
+
+	walletID := uuid.New()
+	mockService.OpenBalanceFunc = func(ctx context.Context, dto *wallet.OpenBalanceDTO) (*wallet.Wallet, error) {
+		return &wallet.Wallet{
+			ID:       dto.WalletID,
+			Currency: "RUB",
+			Balance:  rub(0),
+			Balances: []wallet.SubBalance{{Balance: rub(0)}, {Balance: wallet.NewMoney(0, dto.Currency)}},
+		}, nil
+	}
+
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/wallets/"+walletID.String()+"/balances", bytes.NewBufferString(`{"currency":"usd"}`))
+	req.Header.Set("Content-Type", "application/json")
+	rec := httptest.NewRecorder()
+
+	router.ServeHTTP(rec, req)
+
+	assert.Equal(t, http.StatusCreated, rec.Code)
+	assert.Equal(t, &wallet.OpenBalanceDTO{WalletID: walletID, Currency: "USD"}, mockService.LastOpenBalanceDTO)
+}
+
+func TestOpenBalance_AlreadyExists(t *testing.T) {
+	mockService := &mockWalletService{}
+	router := setupTestRouter(t, mockService)
+
+	mockService.OpenBalanceFunc = func(ctx context.Context, dto *wallet.OpenBalanceDTO) (*wallet.Wallet, error) {
+		return nil, fmt.Errorf("%w: %s", wallet.ErrBalanceAlreadyExists, dto.Currency)
+	}
+
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/wallets/"+uuid.New().String()+"/balances", bytes.NewBufferString(`{"currency":"RUB"}`))
+	req.Header.Set("Content-Type", "application/json")
+	rec := httptest.NewRecorder()
+
+	router.ServeHTTP(rec, req)
+
+	assert.Equal(t, http.StatusConflict, rec.Code)
+}
+
+func TestQuoteExchange_Success(t *testing.T) {
+	mockService := &mockWalletService{}
+	router := setupTestRouter(t, mockService)
+
+	walletID := uuid.New()
+	mockService.QuoteExchangeFunc = func(ctx context.Context, dto *wallet.QuoteDTO) (*wallet.Quote, error) {
+		return &wallet.Quote{
+			ID:       uuid.New(),
+			WalletID: dto.WalletID,
+			Debit:    dto.Amount,
+			Credit:   wallet.NewMoney(125, dto.ToCurrency),
+			Rate:     "0.0125",
+			Spread:   "0",
+			Source:   "static",
+		}, nil
+	}
+
+	body := `{"walletId":"` + walletID.String() + `","fromCurrency":"rub","toCurrency":"usd","amount":"100"}`
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/exchange/quotes", bytes.NewBufferString(body))
+	req.Header.Set("Content-Type", "application/json")
+	rec := httptest.NewRecorder()
+
+	router.ServeHTTP(rec, req)
+
+	assert.Equal(t, http.StatusCreated, rec.Code)
+	assert.Equal(t, &wallet.QuoteDTO{WalletID: walletID, Amount: rub(10000), ToCurrency: "USD"}, mockService.LastQuoteDTO)
+
+	var respBody map[string]interface{}
+	err := json.Unmarshal(rec.Body.Bytes(), &respBody)
+	assert.NoError(t, err)
+	assert.Equal(t, "0.0125", respBody["rate"])
+	assert.Equal(t, map[string]interface{}{"amount": "1.25", "currency": "USD"}, respBody["credit"])
+}
+
+func TestExchange_ByQuote(t *testing.T) {
+	mockService := &mockWalletService{}
+	router := setupTestRouter(t, mockService)
+
+	quoteID := uuid.New()
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/exchange", bytes.NewBufferString(`{"quoteId":"`+quoteID.String()+`"}`))
+	req.Header.Set("Content-Type", "application/json")
+	rec := httptest.NewRecorder()
+
+	router.ServeHTTP(rec, req)
+
+	assert.Equal(t, http.StatusCreated, rec.Code)
+	assert.Equal(t, quoteID, mockService.LastExchangeDTO.QuoteID)
+	assert.Nil(t, mockService.LastExchangeDTO.Quote)
+}
+
+func TestExchange_MissingDetails(t *testing.T) {
+	mockService := &mockWalletService{}
+	router := setupTestRouter(t, mockService)
+
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/exchange", bytes.NewBufferString(`{"fromCurrency":"RUB"}`))
+	req.Header.Set("Content-Type", "application/json")
+	rec := httptest.NewRecorder()
+
+	router.ServeHTTP(rec, req)
+
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+	assert.Nil(t, mockService.LastExchangeDTO)
+}
+
+func TestExchange_QuoteErrors(t *testing.T) {
+	cases := []struct {
+		err    error
+		status int
+		code   string
+	}{
+		{wallet.ErrQuoteNotFound, http.StatusNotFound, codeQuoteNotFound},
+		{wallet.ErrQuoteExpired, http.StatusConflict, codeQuoteExpired},
+		{wallet.ErrQuoteAlreadyUsed, http.StatusConflict, codeQuoteAlreadyUsed},
+		{wallet.ErrRateUnavailable, http.StatusBadRequest, codeRateUnavailable},
+	}
+
+	for _, tc := range cases {
+		mockService := &mockWalletService{}
+		router := setupTestRouter(t, mockService)
+
+		mockService.ExchangeFunc = func(ctx context.Context, dto *wallet.ExchangeDTO) (*wallet.Exchange, error) {
+			return nil, fmt.Errorf("%w: %v", tc.err, dto.QuoteID)
+		}
+
+		req := httptest.NewRequest(http.MethodPost, "/api/v1/exchange", bytes.NewBufferString(`{"quoteId":"`+uuid.New().String()+`"}`))
+		req.Header.Set("Content-Type", "application/json")
+		rec := httptest.NewRecorder()
+
+		router.ServeHTTP(rec, req)
+
+		assert.Equal(t, tc.status, rec.Code, tc.code)
+		assert.Contains(t, rec.Body.String(), `"code":"`+tc.code+`"`)
+	}
+}
+
+func TestAuthorizeHold_Success(t *testing.T) {
+	mockService := &mockWalletService{}
+	router := setupTestRouter(t, mockService)
+
+	walletID := uuid.New()
+	body := `{"amount":"25.50","expiresInSeconds":600}`
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/wallets/"+walletID.String()+"/holds", bytes.NewBufferString(body))
+	req.Header.Set("Content-Type", "application/json")
+	rec := httptest.NewRecorder()
+
+	router.ServeHTTP(rec, req)
+
+	assert.Equal(t, http.StatusCreated, rec.Code)
+	assert.Equal(t, &wallet.HoldDTO{WalletID: walletID, Amount: rub(2550), TTL: 10 * time.Minute}, mockService.LastHoldDTO)
+}
+
+func TestCaptureHold_FullAndPartial(t *testing.T) {
+	mockService := &mockWalletService{}
+	router := setupTestRouter(t, mockService)
+
+	holdID := uuid.New()
+
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/holds/"+holdID.String()+"/capture", nil)
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, &wallet.CaptureDTO{HoldID: holdID}, mockService.LastCaptureDTO)
+
+	req = httptest.NewRequest(http.MethodPost, "/api/v1/holds/"+holdID.String()+"/capture", bytes.NewBufferString(`{"amount":"10"}`))
+	req.Header.Set("Content-Type", "application/json")
+	rec = httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+
+	amount := rub(1000)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, &wallet.CaptureDTO{HoldID: holdID, Amount: &amount}, mockService.LastCaptureDTO)
+}
+
+func TestVoidHold_NotActive(t *testing.T) {
+	mockService := &mockWalletService{}
+	router := setupTestRouter(t, mockService)
+
+	mockService.VoidHoldFunc = func(ctx context.Context, holdID uuid.UUID) (*wallet.Hold, error) {
+		return nil, fmt.Errorf("%w: hold %v is CAPTURED", wallet.ErrHoldNotActive, holdID)
+	}
+
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/holds/"+uuid.New().String()+"/void", nil)
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+
+	assert.Equal(t, http.StatusConflict, rec.Code)
+	assert.Contains(t, rec.Body.String(), `"code":"hold_not_active"`)
+}
+
+func TestReverseTransaction_Success(t *testing.T) {
+	mockService := &mockWalletService{}
+	router := setupTestRouter(t, mockService)
+
+	transactionID := uuid.New()
+	mockService.ReverseTransactionFunc = func(ctx context.Context, dto *wallet.ReversalDTO) (*wallet.Transaction, error) {
+		return &wallet.Transaction{
+			ID:            uuid.New(),
+			OperationType: "REVERSAL_OUT",
+			Amount:        *dto.Amount,
+			BalanceAfter:  rub(500),
+			ReversalOf:    &dto.TransactionID,
+		}, nil
+	}
+
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/transactions/"+transactionID.String()+"/reverse", bytes.NewBufferString(`{"amount":"2.50"}`))
+	req.Header.Set("Content-Type", "application/json")
+	rec := httptest.NewRecorder()
+
+	router.ServeHTTP(rec, req)
+
+	assert.Equal(t, http.StatusCreated, rec.Code)
+	amount := rub(250)
+	assert.Equal(t, &wallet.ReversalDTO{TransactionID: transactionID, Amount: &amount}, mockService.LastReversalDTO)
+
+	var respBody map[string]interface{}
+	err := json.Unmarshal(rec.Body.Bytes(), &respBody)
+	assert.NoError(t, err)
+	assert.Equal(t, transactionID.String(), respBody["reversal_of"])
+}
+
+func TestReverseTransaction_Full(t *testing.T) {
+	mockService := &mockWalletService{}
+	router := setupTestRouter(t, mockService)
+
+	transactionID := uuid.New()
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/transactions/"+transactionID.String()+"/reverse", nil)
+	rec := httptest.NewRecorder()
+
+	router.ServeHTTP(rec, req)
+
+	assert.Equal(t, http.StatusCreated, rec.Code)
+	assert.Equal(t, &wallet.ReversalDTO{TransactionID: transactionID}, mockService.LastReversalDTO)
+}
+
+func TestReverseTransaction_AlreadyReversed(t *testing.T) {
+	mockService := &mockWalletService{}
+	router := setupTestRouter(t, mockService)
+
+	mockService.ReverseTransactionFunc = func(ctx context.Context, dto *wallet.ReversalDTO) (*wallet.Transaction, error) {
+		return nil, fmt.Errorf("%w: %v", wallet.ErrAlreadyReversed, dto.TransactionID)
+	}
+
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/transactions/"+uuid.New().String()+"/reverse", nil)
+	rec := httptest.NewRecorder()
+
+	router.ServeHTTP(rec, req)
+
+	assert.Equal(t, http.StatusConflict, rec.Code)
+	assert.Contains(t, rec.Body.String(), `"code":"transaction_already_reversed"`)
+}
+
+func TestChangeBalanceWallet_IfMatch(t *testing.T) {
+	mockService := &mockWalletService{}
+	router := setupTestRouter(t, mockService)
+
+	walletID := uuid.New()
+	mockService.ChangeBalanceWalletFunc = func(ctx context.Context, dto *wallet.WalletChangeBalanceDTO) (*wallet.Wallet, error) {
+		if assert.NotNil(t, dto.ExpectedVersion) {
+			assert.Equal(t, int64(7), *dto.ExpectedVersion)
+		}
+		return &wallet.Wallet{ID: walletID, Version: 8, Balance: rub(100)}, nil
+	}
+
+	body := `{"walletId":"` + walletID.String() + `","operationType":"WITHDRAW","amount":"1"}`
+	req := httptest.NewRequest(http.MethodPost, walletChangeBalance, bytes.NewBufferString(body))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(ifMatchHeader, `"7"`)
+	rec := httptest.NewRecorder()
+
+	router.ServeHTTP(rec, req)
+
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, `"8"`, rec.Header().Get(etagHeader))
+}
+
+func TestChangeBalanceWallet_IfMatchStale(t *testing.T) {
+	mockService := &mockWalletService{}
+	router := setupTestRouter(t, mockService)
+
+	mockService.ChangeBalanceWalletFunc = func(ctx context.Context, dto *wallet.WalletChangeBalanceDTO) (*wallet.Wallet, error) {
+		return nil, fmt.Errorf("%w: wallet %v is at version 9, expected %d", wallet.ErrVersionMismatch, dto.ID, *dto.ExpectedVersion)
+	}
+
+	body := `{"walletId":"` + uuid.New().String() + `","operationType":"WITHDRAW","amount":"1"}`
+	req := httptest.NewRequest(http.MethodPost, walletChangeBalance, bytes.NewBufferString(body))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(ifMatchHeader, `"7"`)
+	rec := httptest.NewRecorder()
+
+	router.ServeHTTP(rec, req)
+
+	assert.Equal(t, http.StatusPreconditionFailed, rec.Code)
+	assert.Contains(t, rec.Body.String(), `"code":"wallet_version_mismatch"`)
+}
+
+func TestChangeBalanceWallet_IfMatchMalformed(t *testing.T) {
+	for _, header := range []string{`7`, `W/"7"`, `"7", "8"`, `"0"`} {
+		mockService := &mockWalletService{}
+		router := setupTestRouter(t, mockService)
+
+		mockService.ChangeBalanceWalletFunc = func(ctx context.Context, dto *wallet.WalletChangeBalanceDTO) (*wallet.Wallet, error) {
+			t.Fatalf("service must not be called with If-Match %s", header)
+			return nil, nil
+		}
+
+		body := `{"walletId":"` + uuid.New().String() + `","operationType":"DEPOSIT","amount":"1"}`
+		req := httptest.NewRequest(http.MethodPost, walletChangeBalance, bytes.NewBufferString(body))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set(ifMatchHeader, header)
+		rec := httptest.NewRecorder()
+
+		router.ServeHTTP(rec, req)
+
+		assert.Equal(t, http.StatusBadRequest, rec.Code, header)
+	}
+}
+
+func TestParseIfMatch_Wildcard(t *testing.T) {
+	for _, header := range []string{"", "*"} {
+		version, err := parseIfMatch(header)
+		assert.NoError(t, err)
+		assert.Nil(t, version)
+	}
+}
+
+func TestChangeBalanceBatch_BestEffort(t *testing.T) {
+	mockService := &mockWalletService{}
+	router := setupTestRouter(t, mockService)
+
+	walletID := uuid.New()
+	mockService.ChangeBalanceBatchFunc = func(ctx context.Context, dto *wallet.BatchDTO) ([]wallet.BatchResult, error) {
+		return []wallet.BatchResult{
+			{Wallet: &wallet.Wallet{ID: walletID, Version: 4, Balance: rub(1500)}},
+			{Err: fmt.Errorf("%w: amount must be positive", wallet.ErrInvalidAmount)},
+			{Err: &wallet.WalletError{WalletID: walletID, Err: wallet.ErrInsufficientFunds}},
+		}, nil
+	}
+
+	body := `{"operations":[` +
+		`{"walletId":"` + walletID.String() + `","operationType":"deposit","amount":"5.00"},` +
+		`{"walletId":"` + walletID.String() + `","operationType":"WITHDRAW","amount":"0"},` +
+		`{"walletId":"` + walletID.String() + `","operationType":"WITHDRAW","amount":"100"}]}`
+	req := httptest.NewRequest(http.MethodPost, walletBatchUrl, bytes.NewBufferString(body))
+	req.Header.Set("Content-Type", "application/json")
+	rec := httptest.NewRecorder()
+
+	router.ServeHTTP(rec, req)
+
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Len(t, mockService.LastBatchDTO.Operations, 3)
+	assert.Equal(t, "DEPOSIT", mockService.LastBatchDTO.Operations[0].OperationType)
+	assert.Equal(t, rub(10000), mockService.LastBatchDTO.Operations[2].Amount)
+
+	var respBody struct {
+		Applied int               `json:"applied"`
+		Results []batchItemResult `json:"results"`
+	}
+	assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &respBody))
+	assert.Equal(t, 1, respBody.Applied)
+	assert.Len(t, respBody.Results, 3)
+	assert.Equal(t, batchItemResult{Index: 0, Status: http.StatusOK, WalletID: &walletID, Balance: &wallet.Money{Amount: 1500, Currency: "RUB"}, Version: 4}, respBody.Results[0])
+	assert.Equal(t, codeInvalidAmount, respBody.Results[1].Code)
+	assert.Equal(t, http.StatusBadRequest, respBody.Results[1].Status)
+	assert.Equal(t, codeInsufficientFunds, respBody.Results[2].Code)
+	assert.Equal(t, 2, respBody.Results[2].Index)
+}
+
+func TestChangeBalanceBatch_MalformedAmount(t *testing.T) {
+	mockService := &mockWalletService{}
+	router := setupTestRouter(t, mockService)
+
+	walletID := uuid.New().String()
+	body := `{"atomic":true,"operations":[` +
+		`{"walletId":"` + walletID + `","operationType":"DEPOSIT","amount":"5.00"},` +
+		`{"walletId":"` + walletID + `","operationType":"DEPOSIT","amount":"1.5.0"}]}`
+	req := httptest.NewRequest(http.MethodPost, walletBatchUrl, bytes.NewBufferString(body))
+	req.Header.Set("Content-Type", "application/json")
+	rec := httptest.NewRecorder()
+
+	router.ServeHTTP(rec, req)
+
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+	assert.Nil(t, mockService.LastBatchDTO, "batch with a malformed amount must not reach the service")
+	assert.Contains(t, rec.Body.String(), `"code":"invalid_amount"`)
+	assert.Contains(t, rec.Body.String(), `operations[1]`)
+}
+
+func TestChangeBalanceBatch_InvalidBody(t *testing.T) {
+	mockService := &mockWalletService{}
+	router := setupTestRouter(t, mockService)
+
+	for _, body := range []string{`{}`, `{"operations":[]}`, `{"operations":[{"operationType":"DEPOSIT","amount":"1"}]}`} {
+		req := httptest.NewRequest(http.MethodPost, walletBatchUrl, bytes.NewBufferString(body))
+		req.Header.Set("Content-Type", "application/json")
+		rec := httptest.NewRecorder()
+
+		router.ServeHTTP(rec, req)
+
+		assert.Equal(t, http.StatusBadRequest, rec.Code, body)
+		assert.Contains(t, rec.Body.String(), `"code":"invalid_request"`, body)
+	}
+	assert.Nil(t, mockService.LastBatchDTO)
+}
+
+func TestHandlers_MemoryStorage(t *testing.T) {
+	router := setupTestRouter(t, wallet.NewService(memory.New(), wallet.ExchangeConfig{}))
+
+	send := func(method, url, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, url, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+		return rec
+	}
+
+	walletID := uuid.New().String()
+
+	rec := send(http.MethodPost, walletCreateUrl, `{"walletId":"`+walletID+`","balance":100}`)
+	assert.Equal(t, http.StatusCreated, rec.Code, rec.Body.String())
+
+	rec = send(http.MethodPost, walletChangeBalance, `{"walletId":"`+walletID+`","operationType":"WITHDRAW","amount":"30"}`)
+	assert.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+
+	rec = send(http.MethodPost, walletChangeBalance, `{"walletId":"`+walletID+`","operationType":"WITHDRAW","amount":"100"}`)
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+	assert.Contains(t, rec.Body.String(), `"code":"`+codeInsufficientFunds+`"`)
+
+	rec = send(http.MethodGet, "/api/v1/wallets/"+walletID, "")
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Contains(t, rec.Body.String(), `"balance":{"amount":"70.00","currency":"RUB"}`)
+
+	rec = send(http.MethodGet, "/api/v1/wallets/"+uuid.New().String(), "")
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+	assert.Contains(t, rec.Body.String(), `"code":"`+codeWalletNotFound+`"`)
+}
@@ -0,0 +1,128 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"reflect"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+	"github.com/go-playground/validator/v10"
+	"github.com/google/uuid"
+)
+
+const (
+	problemContentType = "application/problem+json"
+	problemTypePrefix  = "urn:wallet-api:error:"
+
+	requestIDHeader = "X-Request-ID"
+	requestIDKey    = "request_id"
+)
+
+// problem - тело ошибки по RFC 7807.
+type problem struct {
+	Type      string `json:"type"`
+	Title     string `json:"title"`
+	Status    int    `json:"status"`
+	Detail    string `json:"detail,omitempty"`
+	Instance  string `json:"instance"`
+	Code      string `json:"code"`
+	RequestID string `json:"request_id,omitempty"`
+}
+
+func respondProblem(c *gin.Context, code string, detail string) {
+	definition, ok := errorCatalogue[code]
+	if !ok {
+		code = codeInternal
+		definition = errorCatalogue[code]
+	}
+
+	body := problem{
+		Type:      problemTypePrefix + code,
+		Title:     definition.title,
+		Status:    definition.status,
+		Detail:    detail,
+		Instance:  c.Request.URL.Path,
+		Code:      code,
+		RequestID: requestID(c),
+	}
+
+	c.Header("Content-Type", problemContentType)
+	c.AbortWithStatusJSON(definition.status, body)
+}
+
+func init() {
+	//Ошибки валидации называют поля так же, как они называются в JSON
+	if v, ok := binding.Validator.Engine().(*validator.Validate); ok {
+		v.RegisterTagNameFunc(func(field reflect.StructField) string {
+			name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+			if name == "-" {
+				return ""
+			}
+			return name
+		})
+	}
+}
+
+// bindingDetail описывает ошибку разбора тела запроса для клиента. Текст ошибок
+// validator и encoding/json содержит имена Go-структур и полей, поэтому наружу
+// уходят только имена полей JSON, а исходная ошибка остается в логе.
+func bindingDetail(err error) string {
+	var validationErrs validator.ValidationErrors
+	var typeErr *json.UnmarshalTypeError
+	var syntaxErr *json.SyntaxError
+	var maxBytesErr *http.MaxBytesError
+
+	switch {
+	case errors.As(err, &validationErrs):
+		details := make([]string, 0, len(validationErrs))
+		for _, fieldErr := range validationErrs {
+			//Первый элемент пути - имя структуры запроса
+			_, field, _ := strings.Cut(fieldErr.Namespace(), ".")
+			switch fieldErr.Tag() {
+			case "required":
+				details = append(details, field+" is required")
+			case "min":
+				details = append(details, fmt.Sprintf("%s must not have fewer than %s items", field, fieldErr.Param()))
+			default:
+				details = append(details, field+" is invalid")
+			}
+		}
+		return "invalid request body: " + strings.Join(details, "; ")
+	case errors.As(err, &typeErr):
+		if typeErr.Field == "" {
+			return "invalid request body: expected a JSON object"
+		}
+		return fmt.Sprintf("invalid request body: %s must not be a JSON %s", typeErr.Field, typeErr.Value)
+	case errors.As(err, &syntaxErr), errors.Is(err, io.ErrUnexpectedEOF):
+		return "invalid request body: malformed JSON"
+	case errors.Is(err, io.EOF):
+		return "invalid request body: the body is empty"
+	case errors.As(err, &maxBytesErr):
+		return fmt.Sprintf("invalid request body: the body must be at most %d bytes", maxBytesErr.Limit)
+	case errors.Is(err, errAmountFormat):
+		return "invalid request body: " + err.Error()
+	default:
+		return "invalid request body"
+	}
+}
+
+// requestIDMiddleware берет X-Request-ID клиента или выдает новый и возвращает его в ответе.
+func requestIDMiddleware(c *gin.Context) {
+	id := c.GetHeader(requestIDHeader)
+	if id == "" || len(id) > 128 {
+		id = uuid.NewString()
+	}
+
+	c.Set(requestIDKey, id)
+	c.Header(requestIDHeader, id)
+	c.Next()
+}
+
+func requestID(c *gin.Context) string {
+	return c.GetString(requestIDKey)
+}
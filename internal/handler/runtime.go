@@ -0,0 +1,129 @@
+package handler
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Runtime - настройки обработчиков, которые меняются без перезапуска через SetRuntime.
+type Runtime struct {
+	// Запросы на изменение отклоняются с 503 maintenance, чтение работает
+	Maintenance bool
+	// Запросов в секунду с одного адреса, 0 - без ограничения
+	RateLimit int
+	// Сколько запросов подряд можно сделать сверх RateLimit, 0 - столько же, сколько RateLimit
+	RateBurst int
+}
+
+func (h *handlers) SetRuntime(runtime Runtime) {
+	h.runtime.Store(&runtime)
+}
+
+// maintenanceMiddleware в режиме обслуживания пропускает только чтение.
+func (h *handlers) maintenanceMiddleware(c *gin.Context) {
+	if !h.runtime.Load().Maintenance {
+		c.Next()
+		return
+	}
+
+	switch c.Request.Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions:
+		c.Next()
+	default:
+		respondProblem(c, codeMaintenance, "the service is under maintenance, only reads are served")
+	}
+}
+
+func (h *handlers) rateLimitMiddleware(c *gin.Context) {
+	runtime := h.runtime.Load()
+	if runtime.RateLimit <= 0 {
+		c.Next()
+		return
+	}
+
+	burst := runtime.RateBurst
+	if burst <= 0 {
+		burst = runtime.RateLimit
+	}
+
+	if !h.limiter.allow(c.ClientIP(), runtime.RateLimit, burst, time.Now()) {
+		h.logger.WithField("request_id", requestID(c)).Warnf("Rate limit exceeded by %s", c.ClientIP())
+		c.Header("Retry-After", "1")
+		respondProblem(c, codeRateLimited, "")
+		return
+	}
+
+	c.Next()
+}
+
+// NewEngine создает gin.Engine, который берет адрес клиента из X-Forwarded-For
+// только за прокси trustedProxies. Без них адрес клиента - адрес соединения,
+// иначе любой клиент обходил бы лимит запросов, меняя заголовок.
+func NewEngine(trustedProxies []string) (*gin.Engine, error) {
+	router := gin.Default()
+	if err := router.SetTrustedProxies(trustedProxies); err != nil {
+		return nil, fmt.Errorf("invalid trusted proxies: %w", err)
+	}
+
+	return router, nil
+}
+
+// rateLimiterSweepInterval - как часто забываются клиенты, которые перестали слать запросы.
+const rateLimiterSweepInterval = time.Minute
+
+// rateLimiter - token bucket на каждого клиента. Скорость и запас передаются при
+// каждом вызове, поэтому новые значения начинают действовать сразу.
+type rateLimiter struct {
+	mu        sync.Mutex
+	buckets   map[string]*bucket
+	lastSweep time.Time
+}
+
+type bucket struct {
+	tokens  float64
+	updated time.Time
+}
+
+func newRateLimiter() *rateLimiter {
+	return &rateLimiter{buckets: make(map[string]*bucket)}
+}
+
+func (l *rateLimiter) allow(key string, rate, burst int, now time.Time) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if now.Sub(l.lastSweep) >= rateLimiterSweepInterval {
+		l.sweep(rate, burst, now)
+	}
+
+	b, ok := l.buckets[key]
+	if !ok {
+		b = &bucket{tokens: float64(burst), updated: now}
+		l.buckets[key] = b
+	}
+
+	b.tokens = math.Min(float64(burst), b.tokens+now.Sub(b.updated).Seconds()*float64(rate))
+	b.updated = now
+	if b.tokens < 1 {
+		return false
+	}
+
+	b.tokens--
+	return true
+}
+
+// sweep удаляет корзины, которые успели наполниться: новая корзина будет такой же.
+func (l *rateLimiter) sweep(rate, burst int, now time.Time) {
+	refill := time.Duration(float64(burst) / float64(rate) * float64(time.Second))
+	for key, b := range l.buckets {
+		if now.Sub(b.updated) >= refill {
+			delete(l.buckets, key)
+		}
+	}
+	l.lastSweep = now
+}
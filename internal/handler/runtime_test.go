@@ -0,0 +1,113 @@
+package handler
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+)
+
+func setupRuntimeRouter(t *testing.T, runtime Runtime) (*gin.Engine, *handlers) {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+
+	h := NewHandlers(&mockWalletService{}, logrus.New())
+	h.SetRuntime(runtime)
+	h.RegisterRoutes(router)
+
+	return router, h
+}
+
+func TestMaintenance_RejectsWrites(t *testing.T) {
+	router, h := setupRuntimeRouter(t, Runtime{Maintenance: true})
+
+	body := `{"fromWalletId":"` + uuid.NewString() + `","toWalletId":"` + uuid.NewString() + `","amount":"1.00"}`
+	req := httptest.NewRequest(http.MethodPost, transfersUrl, strings.NewReader(body))
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+
+	assert.Equal(t, http.StatusServiceUnavailable, rec.Code)
+	assert.Contains(t, rec.Body.String(), `"code":"maintenance"`)
+
+	req = httptest.NewRequest(http.MethodGet, "/api/v1/wallets/"+uuid.NewString(), nil)
+	rec = httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+
+	assert.Equal(t, http.StatusOK, rec.Code)
+
+	//Выход из режима обслуживания действует на следующий же запрос
+	h.SetRuntime(Runtime{})
+	req = httptest.NewRequest(http.MethodPost, transfersUrl, strings.NewReader(body))
+	rec = httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+
+	assert.NotEqual(t, http.StatusServiceUnavailable, rec.Code)
+}
+
+func TestRateLimit_RejectsAboveBurst(t *testing.T) {
+	router, _ := setupRuntimeRouter(t, Runtime{RateLimit: 1, RateBurst: 2})
+
+	codes := make([]int, 3)
+	for i := range codes {
+		req := httptest.NewRequest(http.MethodGet, "/api/v1/wallets/"+uuid.NewString(), nil)
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+		codes[i] = rec.Code
+
+		if rec.Code == http.StatusTooManyRequests {
+			assert.Equal(t, "1", rec.Header().Get("Retry-After"))
+			assert.Contains(t, rec.Body.String(), `"code":"rate_limited"`)
+		}
+	}
+
+	assert.Equal(t, []int{http.StatusOK, http.StatusOK, http.StatusTooManyRequests}, codes)
+}
+
+func TestRateLimit_IgnoresSpoofedForwardedFor(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	//Первый адрес - прокси, за которым стоят клиенты, второй - клиент напрямую
+	router, err := NewEngine([]string{"10.0.0.1"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	h := NewHandlers(&mockWalletService{}, logrus.New())
+	h.SetRuntime(Runtime{RateLimit: 1, RateBurst: 1})
+	h.RegisterRoutes(router)
+
+	send := func(remoteAddr, forwardedFor string) int {
+		req := httptest.NewRequest(http.MethodGet, "/api/v1/wallets/"+uuid.NewString(), nil)
+		req.RemoteAddr = remoteAddr
+		req.Header.Set("X-Forwarded-For", forwardedFor)
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+		return rec.Code
+	}
+
+	assert.Equal(t, http.StatusOK, send("203.0.113.7:1234", "198.51.100.1"))
+	assert.Equal(t, http.StatusTooManyRequests, send("203.0.113.7:1234", "198.51.100.2"), "spoofed header must not reset the limit")
+
+	//За доверенным прокси клиенты различаются по заголовку
+	assert.Equal(t, http.StatusOK, send("10.0.0.1:1234", "198.51.100.1"))
+	assert.Equal(t, http.StatusOK, send("10.0.0.1:1234", "198.51.100.2"))
+}
+
+func TestRateLimiter_Refills(t *testing.T) {
+	limiter := newRateLimiter()
+	now := time.Now()
+
+	assert.True(t, limiter.allow("a", 2, 1, now))
+	assert.False(t, limiter.allow("a", 2, 1, now))
+	assert.True(t, limiter.allow("b", 2, 1, now), "clients have separate buckets")
+	assert.True(t, limiter.allow("a", 2, 1, now.Add(500*time.Millisecond)))
+
+	//Наполнившиеся корзины забываются
+	limiter.allow("c", 2, 1, now.Add(rateLimiterSweepInterval+time.Second))
+	assert.Len(t, limiter.buckets, 1)
+}
@@ -0,0 +1,262 @@
+// Package migrate применяет SQL-миграции схемы из встроенных в бинарник файлов.
+// Версия схемы хранится в schema_migrations в том же виде, что и у golang-migrate,
+// поэтому базу, которую раньше мигрировал контейнер migrate/migrate, можно
+// продолжать мигрировать отсюда и наоборот.
+package migrate
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"regexp"
+	"slices"
+	"strconv"
+
+	"walet_rest_api/pkg/client/postgres"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/sirupsen/logrus"
+)
+
+var ErrDirty = errors.New("database schema is dirty")
+
+// Migration - пара файлов NNN_name.up.sql и NNN_name.down.sql.
+type Migration struct {
+	Version int64
+	Name    string
+	Up      string
+	Down    string
+}
+
+// Status - состояние схемы. Version - последняя примененная миграция, 0 - ни
+// одной. Dirty выставляет golang-migrate, если миграция оборвалась на середине.
+type Status struct {
+	Version int64
+	Dirty   bool
+	Applied []Migration
+	Pending []Migration
+}
+
+type Migrator struct {
+	client     postgres.Client
+	logger     *logrus.Logger
+	migrations []Migration
+}
+
+func New(client postgres.Client, logger *logrus.Logger, fsys fs.FS) (*Migrator, error) {
+	migrations, err := Load(fsys)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Migrator{client: client, logger: logger, migrations: migrations}, nil
+}
+
+var fileName = regexp.MustCompile(`^(\d+)_(.+)\.(up|down)\.sql$`)
+
+// Load читает миграции из корня fsys и сортирует их по версии. У каждой версии
+// должны быть оба файла, up и down.
+func Load(fsys fs.FS) ([]Migration, error) {
+	entries, err := fs.ReadDir(fsys, ".")
+	if err != nil {
+		return nil, fmt.Errorf("failed to read migrations: %w", err)
+	}
+
+	byVersion := make(map[int64]*Migration)
+	for _, entry := range entries {
+		match := fileName.FindStringSubmatch(entry.Name())
+		if entry.IsDir() || match == nil {
+			continue
+		}
+
+		version, err := strconv.ParseInt(match[1], 10, 64)
+		if err != nil || version <= 0 {
+			return nil, fmt.Errorf("invalid migration version in %s", entry.Name())
+		}
+
+		body, err := fs.ReadFile(fsys, entry.Name())
+		if err != nil {
+			return nil, fmt.Errorf("failed to read migration %s: %w", entry.Name(), err)
+		}
+
+		migration, ok := byVersion[version]
+		if !ok {
+			migration = &Migration{Version: version, Name: match[2]}
+			byVersion[version] = migration
+		}
+		if migration.Name != match[2] {
+			return nil, fmt.Errorf("migration %d has two names: %s and %s", version, migration.Name, match[2])
+		}
+
+		if match[3] == "up" {
+			migration.Up = string(body)
+		} else {
+			migration.Down = string(body)
+		}
+	}
+
+	migrations := make([]Migration, 0, len(byVersion))
+	for _, migration := range byVersion {
+		if migration.Up == "" || migration.Down == "" {
+			return nil, fmt.Errorf("migration %d_%s must have both up and down files", migration.Version, migration.Name)
+		}
+		migrations = append(migrations, *migration)
+	}
+	slices.SortFunc(migrations, func(a, b Migration) int { return cmp.Compare(a.Version, b.Version) })
+
+	return migrations, nil
+}
+
+// Up применяет все еще не примененные миграции и возвращает их число.
+func (m *Migrator) Up(ctx context.Context) (int, error) {
+	applied := 0
+
+	err := m.locked(ctx, func(tx pgx.Tx, current int64) error {
+		for _, migration := range m.migrations {
+			if migration.Version <= current {
+				continue
+			}
+			if err := m.apply(ctx, tx, migration, migration.Up, migration.Version); err != nil {
+				return err
+			}
+			applied++
+		}
+		return nil
+	})
+
+	return applied, err
+}
+
+// Down откатывает steps последних примененных миграций и возвращает их число.
+func (m *Migrator) Down(ctx context.Context, steps int) (int, error) {
+	reverted := 0
+
+	err := m.locked(ctx, func(tx pgx.Tx, current int64) error {
+		if current == 0 {
+			return nil
+		}
+
+		i := slices.IndexFunc(m.migrations, func(migration Migration) bool { return migration.Version == current })
+		if i < 0 {
+			return fmt.Errorf("database is at version %d, which this binary does not know", current)
+		}
+
+		for ; i >= 0 && reverted < steps; i-- {
+			var previous int64
+			if i > 0 {
+				previous = m.migrations[i-1].Version
+			}
+			if err := m.apply(ctx, tx, m.migrations[i], m.migrations[i].Down, previous); err != nil {
+				return err
+			}
+			reverted++
+		}
+		return nil
+	})
+
+	return reverted, err
+}
+
+func (m *Migrator) Status(ctx context.Context) (*Status, error) {
+	//Статус только читает: на чистой базе таблицы версий еще нет
+	var exists bool
+	if err := m.client.QueryRow(ctx, `SELECT to_regclass('schema_migrations') IS NOT NULL`).Scan(&exists); err != nil {
+		return nil, fmt.Errorf("failed to check schema_migrations: %w", err)
+	}
+
+	status := &Status{}
+	if exists {
+		var err error
+		if status.Version, status.Dirty, err = schemaVersion(ctx, m.client); err != nil {
+			return nil, err
+		}
+	}
+
+	for _, migration := range m.migrations {
+		if migration.Version <= status.Version {
+			status.Applied = append(status.Applied, migration)
+		} else {
+			status.Pending = append(status.Pending, migration)
+		}
+	}
+
+	return status, nil
+}
+
+const createVersionTableQuery = `CREATE TABLE IF NOT EXISTS schema_migrations (version BIGINT NOT NULL PRIMARY KEY, dirty BOOLEAN NOT NULL)`
+
+// locked выполняет fn в одной транзакции под advisory-блокировкой. Реплики,
+// стартующие одновременно, ждут друг друга, и следующая видит уже примененные
+// миграции. Ошибка любой миграции откатывает всю пачку вместе с версией.
+func (m *Migrator) locked(ctx context.Context, fn func(tx pgx.Tx, current int64) error) error {
+	tx, err := m.client.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	if _, err := tx.Exec(ctx, `SELECT pg_advisory_xact_lock(hashtext('schema_migrations'))`); err != nil {
+		return fmt.Errorf("failed to take migration lock: %w", err)
+	}
+	if _, err := tx.Exec(ctx, createVersionTableQuery); err != nil {
+		return fmt.Errorf("failed to create schema_migrations: %w", err)
+	}
+
+	current, dirty, err := schemaVersion(ctx, tx)
+	if err != nil {
+		return err
+	}
+	if dirty {
+		return fmt.Errorf("%w at version %d, repair it by hand and reset schema_migrations.dirty", ErrDirty, current)
+	}
+
+	if err := fn(tx, current); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	return nil
+}
+
+// apply выполняет файл миграции и записывает версию, на которой оказалась схема.
+func (m *Migrator) apply(ctx context.Context, tx pgx.Tx, migration Migration, script string, version int64) error {
+	m.logger.Infof("Applying migration %d_%s, schema version becomes %d", migration.Version, migration.Name, version)
+
+	//Без аргументов pgx выполняет запрос простым протоколом, поэтому в файле
+	//может быть несколько команд
+	if _, err := tx.Exec(ctx, script); err != nil {
+		return fmt.Errorf("migration %d_%s failed: %w", migration.Version, migration.Name, err)
+	}
+
+	//Как и golang-migrate, храним в таблице одну строку, без строки схема пуста
+	if _, err := tx.Exec(ctx, `DELETE FROM schema_migrations`); err != nil {
+		return fmt.Errorf("failed to reset schema version: %w", err)
+	}
+	if version > 0 {
+		if _, err := tx.Exec(ctx, `INSERT INTO schema_migrations (version, dirty) VALUES ($1, false)`, version); err != nil {
+			return fmt.Errorf("failed to set schema version: %w", err)
+		}
+	}
+
+	return nil
+}
+
+func schemaVersion(ctx context.Context, client postgres.Client) (int64, bool, error) {
+	var version int64
+	var dirty bool
+
+	err := client.QueryRow(ctx, `SELECT version, dirty FROM schema_migrations LIMIT 1`).Scan(&version, &dirty)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return 0, false, nil
+		}
+		return 0, false, fmt.Errorf("failed to read schema version: %w", err)
+	}
+
+	return version, dirty, nil
+}
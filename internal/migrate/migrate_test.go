@@ -0,0 +1,160 @@
+package migrate
+
+import (
+	"context"
+	"io"
+	"slices"
+	"strings"
+	"testing"
+	"testing/fstest"
+
+	"walet_rest_api/migrations"
+	"walet_rest_api/pkg/client/postgres"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/sirupsen/logrus"
+)
+
+// fakeDB хранит версию схемы так же, как schema_migrations, и запоминает
+// выполненные в транзакциях запросы.
+type fakeDB struct {
+	postgres.Client
+	version   int64
+	executed  []string
+	committed bool
+}
+
+type fakeTx struct {
+	pgx.Tx
+	db *fakeDB
+}
+
+type versionRow struct {
+	version int64
+}
+
+func (d *fakeDB) Begin(ctx context.Context) (pgx.Tx, error) {
+	return &fakeTx{db: d}, nil
+}
+
+func (t *fakeTx) Exec(ctx context.Context, sql string, args ...any) (pgconn.CommandTag, error) {
+	t.db.executed = append(t.db.executed, sql)
+	switch {
+	case strings.HasPrefix(sql, "DELETE FROM schema_migrations"):
+		t.db.version = 0
+	case strings.HasPrefix(sql, "INSERT INTO schema_migrations"):
+		t.db.version = args[0].(int64)
+	}
+	return pgconn.CommandTag{}, nil
+}
+
+func (t *fakeTx) QueryRow(ctx context.Context, sql string, args ...any) pgx.Row {
+	return versionRow{version: t.db.version}
+}
+
+func (t *fakeTx) Commit(ctx context.Context) error {
+	t.db.committed = true
+	return nil
+}
+
+func (t *fakeTx) Rollback(ctx context.Context) error {
+	return nil
+}
+
+func (r versionRow) Scan(dest ...any) error {
+	if r.version == 0 {
+		return pgx.ErrNoRows
+	}
+	*dest[0].(*int64) = r.version
+	*dest[1].(*bool) = false
+	return nil
+}
+
+func testFS() fstest.MapFS {
+	fsys := fstest.MapFS{}
+	for _, name := range []string{"001_init", "002_orders", "010_items"} {
+		fsys[name+".up.sql"] = &fstest.MapFile{Data: []byte("up " + name)}
+		fsys[name+".down.sql"] = &fstest.MapFile{Data: []byte("down " + name)}
+	}
+	return fsys
+}
+
+func newMigrator(t *testing.T, db *fakeDB) *Migrator {
+	t.Helper()
+	logger := logrus.New()
+	logger.SetOutput(io.Discard)
+
+	migrator, err := New(db, logger, testFS())
+	if err != nil {
+		t.Fatalf("failed to load migrations: %v", err)
+	}
+	return migrator
+}
+
+func TestLoad_EmbeddedMigrations(t *testing.T) {
+	loaded, err := Load(migrations.FS)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(loaded) == 0 {
+		t.Fatal("expected embedded migrations")
+	}
+	for i, migration := range loaded {
+		if migration.Version != int64(i)+1 {
+			t.Errorf("expected migration %d at position %d, got %d_%s", i+1, i, migration.Version, migration.Name)
+		}
+	}
+}
+
+func TestLoad_RequiresBothDirections(t *testing.T) {
+	fsys := testFS()
+	delete(fsys, "002_orders.down.sql")
+
+	if _, err := Load(fsys); err == nil || !strings.Contains(err.Error(), "orders") {
+		t.Errorf("expected missing down file error, got %v", err)
+	}
+}
+
+func TestMigrator_Up_AppliesPendingInOrder(t *testing.T) {
+	db := &fakeDB{version: 1}
+	migrator := newMigrator(t, db)
+
+	applied, err := migrator.Up(context.Background())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if applied != 2 || db.version != 10 || !db.committed {
+		t.Fatalf("expected 2 migrations up to version 10, got %d up to %d", applied, db.version)
+	}
+
+	if !strings.Contains(db.executed[0], "pg_advisory_xact_lock") {
+		t.Errorf("expected migration lock first, got %q", db.executed[0])
+	}
+	up002 := slices.Index(db.executed, "up 002_orders")
+	up010 := slices.Index(db.executed, "up 010_items")
+	if up002 < 0 || up010 < up002 || slices.Contains(db.executed, "up 001_init") {
+		t.Errorf("expected only pending migrations in order, got %q", db.executed)
+	}
+}
+
+func TestMigrator_Down_RevertsSteps(t *testing.T) {
+	db := &fakeDB{version: 10}
+	migrator := newMigrator(t, db)
+
+	reverted, err := migrator.Down(context.Background(), 2)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if reverted != 2 || db.version != 1 {
+		t.Fatalf("expected 2 migrations down to version 1, got %d down to %d", reverted, db.version)
+	}
+	if slices.Index(db.executed, "down 010_items") > slices.Index(db.executed, "down 002_orders") {
+		t.Errorf("expected newest migration reverted first, got %q", db.executed)
+	}
+
+	reverted, err = migrator.Down(context.Background(), 5)
+	if err != nil || reverted != 1 || db.version != 0 {
+		t.Errorf("expected last migration reverted to an empty schema, got %d at version %d, %v", reverted, db.version, err)
+	}
+}
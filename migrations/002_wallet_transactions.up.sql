@@ -0,0 +1,21 @@
+CREATE TABLE IF NOT EXISTS wallet_transactions (
+  id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+  seq BIGSERIAL NOT NULL UNIQUE,
+  wallet_id UUID NOT NULL REFERENCES wallets (id),
+  operation_type TEXT NOT NULL CHECK (operation_type IN ('DEPOSIT', 'WITHDRAW')),
+  amount INTEGER NOT NULL CHECK (amount > 0),
+  balance_after INTEGER NOT NULL,
+  created_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE INDEX IF NOT EXISTS wallet_transactions_wallet_id_seq_idx ON wallet_transactions (wallet_id, seq);
+
+CREATE OR REPLACE FUNCTION wallet_transactions_immutable() RETURNS trigger AS $$
+BEGIN
+  RAISE EXCEPTION 'wallet_transactions rows are immutable';
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER wallet_transactions_immutable
+  BEFORE UPDATE OR DELETE ON wallet_transactions
+  FOR EACH ROW EXECUTE FUNCTION wallet_transactions_immutable();
@@ -0,0 +1,10 @@
+DROP INDEX IF EXISTS wallet_transactions_transfer_id_idx;
+
+ALTER TABLE wallet_transactions DROP CONSTRAINT IF EXISTS wallet_transactions_operation_type_check;
+
+ALTER TABLE wallet_transactions ADD CONSTRAINT wallet_transactions_operation_type_check
+  CHECK (operation_type IN ('DEPOSIT', 'WITHDRAW')) NOT VALID;
+
+ALTER TABLE wallet_transactions
+  DROP COLUMN IF EXISTS counterparty_wallet_id,
+  DROP COLUMN IF EXISTS transfer_id;
@@ -0,0 +1,11 @@
+ALTER TABLE wallet_transactions
+  ADD COLUMN IF NOT EXISTS transfer_id UUID,
+  ADD COLUMN IF NOT EXISTS counterparty_wallet_id UUID REFERENCES wallets (id);
+
+ALTER TABLE wallet_transactions DROP CONSTRAINT IF EXISTS wallet_transactions_operation_type_check;
+
+ALTER TABLE wallet_transactions ADD CONSTRAINT wallet_transactions_operation_type_check
+  CHECK (operation_type IN ('DEPOSIT', 'WITHDRAW', 'TRANSFER_IN', 'TRANSFER_OUT'));
+
+CREATE INDEX IF NOT EXISTS wallet_transactions_transfer_id_idx ON wallet_transactions (transfer_id)
+  WHERE transfer_id IS NOT NULL;
@@ -0,0 +1,9 @@
+ALTER TABLE wallet_transactions
+  ALTER COLUMN amount TYPE INTEGER,
+  ALTER COLUMN balance_after TYPE INTEGER;
+
+ALTER TABLE wallets ALTER COLUMN balance TYPE INTEGER;
+
+-- Responses stored in the Money format cannot be replayed by the old code.
+UPDATE idempotency_keys SET fingerprint = 'pre-money:' || fingerprint
+  WHERE fingerprint NOT LIKE 'pre-money:%';
@@ -0,0 +1,12 @@
+ALTER TABLE wallets ALTER COLUMN balance TYPE BIGINT;
+
+ALTER TABLE wallet_transactions
+  ALTER COLUMN amount TYPE BIGINT,
+  ALTER COLUMN balance_after TYPE BIGINT;
+
+-- Stored responses use the old integer balance format, and the fingerprints
+-- hash the old request format, which cannot be recomputed from the hash. The
+-- keys are kept so that a retry across the upgrade is not applied twice: the
+-- marked fingerprint never matches, and the retry gets 409 instead.
+UPDATE idempotency_keys SET fingerprint = 'pre-money:' || fingerprint
+  WHERE fingerprint NOT LIKE 'pre-money:%';
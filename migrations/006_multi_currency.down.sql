@@ -0,0 +1,11 @@
+ALTER TABLE wallet_transactions DROP COLUMN IF EXISTS currency;
+
+ALTER TABLE wallets ADD COLUMN IF NOT EXISTS balance BIGINT NOT NULL DEFAULT 0;
+
+UPDATE wallets w SET balance = b.balance
+FROM wallet_balances b
+WHERE b.wallet_id = w.id AND b.currency = w.currency;
+
+DROP TABLE IF EXISTS wallet_balances;
+
+ALTER TABLE wallets DROP COLUMN IF EXISTS currency;
@@ -0,0 +1,20 @@
+ALTER TABLE wallets ADD COLUMN IF NOT EXISTS currency CHAR(3) NOT NULL DEFAULT 'RUB';
+
+CREATE TABLE IF NOT EXISTS wallet_balances (
+  wallet_id UUID NOT NULL REFERENCES wallets (id),
+  currency CHAR(3) NOT NULL,
+  balance BIGINT NOT NULL DEFAULT 0,
+  PRIMARY KEY (wallet_id, currency)
+);
+
+INSERT INTO wallet_balances (wallet_id, currency, balance)
+SELECT id, currency, balance FROM wallets
+ON CONFLICT DO NOTHING;
+
+ALTER TABLE wallets DROP COLUMN IF EXISTS balance;
+
+ALTER TABLE wallets ALTER COLUMN currency DROP DEFAULT;
+
+ALTER TABLE wallet_transactions ADD COLUMN IF NOT EXISTS currency CHAR(3) NOT NULL DEFAULT 'RUB';
+
+ALTER TABLE wallet_transactions ALTER COLUMN currency DROP DEFAULT;
@@ -0,0 +1,14 @@
+DROP INDEX IF EXISTS wallet_transactions_exchange_id_idx;
+
+ALTER TABLE wallet_transactions DROP CONSTRAINT IF EXISTS wallet_transactions_operation_type_check;
+
+ALTER TABLE wallet_transactions ADD CONSTRAINT wallet_transactions_operation_type_check
+  CHECK (operation_type IN ('DEPOSIT', 'WITHDRAW', 'TRANSFER_IN', 'TRANSFER_OUT')) NOT VALID;
+
+ALTER TABLE wallet_transactions
+  DROP COLUMN IF EXISTS rate_source,
+  DROP COLUMN IF EXISTS spread,
+  DROP COLUMN IF EXISTS rate,
+  DROP COLUMN IF EXISTS exchange_id;
+
+DROP TABLE IF EXISTS exchange_quotes;
@@ -0,0 +1,29 @@
+CREATE TABLE IF NOT EXISTS exchange_quotes (
+  id UUID PRIMARY KEY,
+  wallet_id UUID NOT NULL REFERENCES wallets (id),
+  to_wallet_id UUID NOT NULL REFERENCES wallets (id),
+  debit_amount BIGINT NOT NULL,
+  debit_currency CHAR(3) NOT NULL,
+  credit_amount BIGINT NOT NULL,
+  credit_currency CHAR(3) NOT NULL,
+  rate NUMERIC NOT NULL,
+  spread NUMERIC NOT NULL,
+  source TEXT NOT NULL,
+  expires_at TIMESTAMPTZ NOT NULL,
+  used_at TIMESTAMPTZ,
+  created_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+ALTER TABLE wallet_transactions
+  ADD COLUMN IF NOT EXISTS exchange_id UUID,
+  ADD COLUMN IF NOT EXISTS rate NUMERIC,
+  ADD COLUMN IF NOT EXISTS spread NUMERIC,
+  ADD COLUMN IF NOT EXISTS rate_source TEXT;
+
+ALTER TABLE wallet_transactions DROP CONSTRAINT IF EXISTS wallet_transactions_operation_type_check;
+
+ALTER TABLE wallet_transactions ADD CONSTRAINT wallet_transactions_operation_type_check
+  CHECK (operation_type IN ('DEPOSIT', 'WITHDRAW', 'TRANSFER_IN', 'TRANSFER_OUT', 'EXCHANGE_IN', 'EXCHANGE_OUT'));
+
+CREATE INDEX IF NOT EXISTS wallet_transactions_exchange_id_idx ON wallet_transactions (exchange_id)
+  WHERE exchange_id IS NOT NULL;
@@ -0,0 +1,12 @@
+ALTER TABLE wallet_transactions DROP CONSTRAINT IF EXISTS wallet_transactions_operation_type_check;
+
+ALTER TABLE wallet_transactions ADD CONSTRAINT wallet_transactions_operation_type_check
+  CHECK (operation_type IN ('DEPOSIT', 'WITHDRAW', 'TRANSFER_IN', 'TRANSFER_OUT', 'EXCHANGE_IN', 'EXCHANGE_OUT')) NOT VALID;
+
+ALTER TABLE wallet_transactions DROP COLUMN IF EXISTS hold_id;
+
+DROP TABLE IF EXISTS holds;
+
+ALTER TABLE wallet_balances DROP CONSTRAINT IF EXISTS wallet_balances_held_check;
+
+ALTER TABLE wallet_balances DROP COLUMN IF EXISTS held;
@@ -0,0 +1,25 @@
+ALTER TABLE wallet_balances ADD COLUMN IF NOT EXISTS held BIGINT NOT NULL DEFAULT 0;
+
+ALTER TABLE wallet_balances ADD CONSTRAINT wallet_balances_held_check CHECK (held >= 0);
+
+CREATE TABLE IF NOT EXISTS holds (
+  id UUID PRIMARY KEY,
+  wallet_id UUID NOT NULL,
+  currency CHAR(3) NOT NULL,
+  amount BIGINT NOT NULL CHECK (amount > 0),
+  captured_amount BIGINT,
+  status TEXT NOT NULL DEFAULT 'ACTIVE' CHECK (status IN ('ACTIVE', 'CAPTURED', 'VOIDED', 'EXPIRED')),
+  expires_at TIMESTAMPTZ NOT NULL,
+  created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+  updated_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+  FOREIGN KEY (wallet_id, currency) REFERENCES wallet_balances (wallet_id, currency)
+);
+
+CREATE INDEX IF NOT EXISTS holds_active_expires_at_idx ON holds (expires_at) WHERE status = 'ACTIVE';
+
+ALTER TABLE wallet_transactions ADD COLUMN IF NOT EXISTS hold_id UUID REFERENCES holds (id);
+
+ALTER TABLE wallet_transactions DROP CONSTRAINT IF EXISTS wallet_transactions_operation_type_check;
+
+ALTER TABLE wallet_transactions ADD CONSTRAINT wallet_transactions_operation_type_check
+  CHECK (operation_type IN ('DEPOSIT', 'WITHDRAW', 'TRANSFER_IN', 'TRANSFER_OUT', 'EXCHANGE_IN', 'EXCHANGE_OUT', 'CAPTURE'));
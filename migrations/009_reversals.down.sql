@@ -0,0 +1,8 @@
+DROP INDEX IF EXISTS wallet_transactions_reversal_of_idx;
+
+ALTER TABLE wallet_transactions DROP CONSTRAINT IF EXISTS wallet_transactions_operation_type_check;
+
+ALTER TABLE wallet_transactions ADD CONSTRAINT wallet_transactions_operation_type_check
+  CHECK (operation_type IN ('DEPOSIT', 'WITHDRAW', 'TRANSFER_IN', 'TRANSFER_OUT', 'EXCHANGE_IN', 'EXCHANGE_OUT', 'CAPTURE')) NOT VALID;
+
+ALTER TABLE wallet_transactions DROP COLUMN IF EXISTS reversal_of;
@@ -0,0 +1,10 @@
+ALTER TABLE wallet_transactions ADD COLUMN IF NOT EXISTS reversal_of UUID REFERENCES wallet_transactions (id);
+
+ALTER TABLE wallet_transactions DROP CONSTRAINT IF EXISTS wallet_transactions_operation_type_check;
+
+ALTER TABLE wallet_transactions ADD CONSTRAINT wallet_transactions_operation_type_check
+  CHECK (operation_type IN ('DEPOSIT', 'WITHDRAW', 'TRANSFER_IN', 'TRANSFER_OUT', 'EXCHANGE_IN', 'EXCHANGE_OUT', 'CAPTURE',
+    'REVERSAL_IN', 'REVERSAL_OUT'));
+
+CREATE INDEX IF NOT EXISTS wallet_transactions_reversal_of_idx ON wallet_transactions (reversal_of)
+  WHERE reversal_of IS NOT NULL;
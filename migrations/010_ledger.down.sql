@@ -0,0 +1,9 @@
+ALTER TABLE wallet_transactions DROP COLUMN IF EXISTS entry_id;
+
+DROP TABLE IF EXISTS postings;
+
+DROP TABLE IF EXISTS journal_entries;
+
+DROP FUNCTION IF EXISTS postings_balanced();
+
+DROP FUNCTION IF EXISTS postings_immutable();
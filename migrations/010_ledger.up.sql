@@ -0,0 +1,68 @@
+CREATE TABLE IF NOT EXISTS journal_entries (
+  id UUID PRIMARY KEY,
+  operation_type TEXT NOT NULL,
+  created_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+-- A posting moves money on either a wallet balance or a system account.
+-- Postings of one journal entry sum to zero in every currency.
+CREATE TABLE IF NOT EXISTS postings (
+  id BIGSERIAL PRIMARY KEY,
+  entry_id UUID NOT NULL REFERENCES journal_entries (id),
+  wallet_id UUID,
+  account TEXT CHECK (account IN ('CASH', 'FEE', 'EXCHANGE')),
+  currency CHAR(3) NOT NULL,
+  amount BIGINT NOT NULL CHECK (amount <> 0),
+  FOREIGN KEY (wallet_id, currency) REFERENCES wallet_balances (wallet_id, currency),
+  CHECK ((wallet_id IS NULL) <> (account IS NULL))
+);
+
+CREATE INDEX IF NOT EXISTS postings_entry_id_idx ON postings (entry_id);
+
+CREATE INDEX IF NOT EXISTS postings_wallet_id_currency_idx ON postings (wallet_id, currency)
+  WHERE wallet_id IS NOT NULL;
+
+CREATE OR REPLACE FUNCTION postings_balanced() RETURNS trigger AS $$
+BEGIN
+  IF EXISTS (
+    SELECT 1 FROM postings WHERE entry_id = NEW.entry_id
+    GROUP BY currency HAVING SUM(amount) <> 0
+  ) THEN
+    RAISE EXCEPTION 'journal entry % does not balance', NEW.entry_id;
+  END IF;
+  RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE CONSTRAINT TRIGGER postings_balanced
+  AFTER INSERT ON postings
+  DEFERRABLE INITIALLY DEFERRED
+  FOR EACH ROW EXECUTE FUNCTION postings_balanced();
+
+CREATE OR REPLACE FUNCTION postings_immutable() RETURNS trigger AS $$
+BEGIN
+  RAISE EXCEPTION 'postings rows are immutable';
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER postings_immutable
+  BEFORE UPDATE OR DELETE ON postings
+  FOR EACH ROW EXECUTE FUNCTION postings_immutable();
+
+-- Single operations log their wallet_transactions row before the journal entry
+-- is posted, so the reference is checked at commit, like postings_balanced.
+ALTER TABLE wallet_transactions ADD COLUMN IF NOT EXISTS entry_id UUID
+  REFERENCES journal_entries (id) DEFERRABLE INITIALLY DEFERRED;
+
+-- Existing balances are opened against the cash account, so every
+-- wallet_balances.balance matches its postings from the start.
+WITH opening AS (
+  SELECT gen_random_uuid() AS entry_id, wallet_id, currency, balance
+  FROM wallet_balances WHERE balance <> 0
+), entries AS (
+  INSERT INTO journal_entries (id, operation_type) SELECT entry_id, 'OPENING' FROM opening
+)
+INSERT INTO postings (entry_id, wallet_id, account, currency, amount)
+SELECT entry_id, wallet_id, NULL, currency, balance FROM opening
+UNION ALL
+SELECT entry_id, NULL, 'CASH', currency, -balance FROM opening;
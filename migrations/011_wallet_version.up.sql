@@ -0,0 +1,3 @@
+-- Every change of a wallet's balances increments its version; clients send it
+-- back in If-Match to detect lost updates.
+ALTER TABLE wallets ADD COLUMN IF NOT EXISTS version BIGINT NOT NULL DEFAULT 1;
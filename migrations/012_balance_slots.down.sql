@@ -0,0 +1,12 @@
+-- Slots are folded back into the main balances before the table is dropped.
+UPDATE wallet_balances b SET balance = b.balance + s.balance
+FROM (SELECT wallet_id, currency, SUM(balance) AS balance FROM wallet_balance_slots GROUP BY wallet_id, currency) s
+WHERE b.wallet_id = s.wallet_id AND b.currency = s.currency;
+
+UPDATE wallets w SET version = w.version + s.changes
+FROM (SELECT wallet_id, SUM(changes) AS changes FROM wallet_balance_slots GROUP BY wallet_id) s
+WHERE w.id = s.wallet_id;
+
+DROP TABLE IF EXISTS wallet_balance_slots;
+
+ALTER TABLE wallets DROP COLUMN IF EXISTS slots;
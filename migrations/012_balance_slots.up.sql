@@ -0,0 +1,18 @@
+-- A hot wallet can spread its balances over several slots. Deposits land in a
+-- random slot and withdrawals take a slot with enough funds, so writers do not
+-- queue on one row. The balance of a currency is wallet_balances.balance plus
+-- its slots; the version of a wallet is wallets.version plus slot changes.
+ALTER TABLE wallets ADD COLUMN IF NOT EXISTS slots INT NOT NULL DEFAULT 1 CHECK (slots BETWEEN 1 AND 64);
+
+CREATE TABLE IF NOT EXISTS wallet_balance_slots (
+  wallet_id UUID NOT NULL,
+  currency CHAR(3) NOT NULL,
+  slot INT NOT NULL,
+  balance BIGINT NOT NULL DEFAULT 0 CHECK (balance >= 0),
+  changes BIGINT NOT NULL DEFAULT 0,
+  PRIMARY KEY (wallet_id, currency, slot),
+  FOREIGN KEY (wallet_id, currency) REFERENCES wallet_balances (wallet_id, currency) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS wallet_balance_slots_pending_idx ON wallet_balance_slots (wallet_id)
+  WHERE balance <> 0 OR changes <> 0;
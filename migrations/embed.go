@@ -0,0 +1,8 @@
+// Package migrations встраивает SQL-миграции схемы в бинарник, их применяет
+// internal/migrate.
+package migrations
+
+import "embed"
+
+//go:embed *.sql
+var FS embed.FS
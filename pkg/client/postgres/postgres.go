@@ -2,7 +2,10 @@ package postgres
 
 import (
 	"context"
-	"os"
+	"fmt"
+	"strconv"
+	"time"
+
 	"walet_rest_api/pkg/logging"
 
 	"github.com/jackc/pgx/v5"
@@ -10,28 +13,147 @@ import (
 	"github.com/jackc/pgx/v5/pgxpool"
 )
 
+// Client - запросы к базе. Ему удовлетворяют и пул, и pgx.Tx, поэтому код
+// хранилища одинаково работает внутри транзакции и вне ее.
 type Client interface {
 	Exec(ctx context.Context, sql string, arguments ...any) (pgconn.CommandTag, error)
 	QueryRow(ctx context.Context, sql string, args ...any) pgx.Row
+	Query(ctx context.Context, sql string, args ...any) (pgx.Rows, error)
+	Begin(ctx context.Context) (pgx.Tx, error)
+	SendBatch(ctx context.Context, b *pgx.Batch) pgx.BatchResults
+}
+
+// Pool - Client, который начинает транзакции с заданным уровнем изоляции и
+// режимом доступа. Транзакции хранилища идут через WithTx.
+type Pool interface {
+	Client
+	BeginTx(ctx context.Context, txOptions pgx.TxOptions) (pgx.Tx, error)
+}
+
+// Config - настройки пула, их собирает internal/config. Нулевые значения
+// оставляют умолчания pgx.
+type Config struct {
+	DSN string
+
+	MaxConns        int32
+	MinConns        int32
+	MaxConnLifetime time.Duration
+	MaxConnIdleTime time.Duration
+
+	// StatementTimeout ограничивает время любого запроса на стороне сервера
+	StatementTimeout time.Duration
+	// ApplicationName виден в pg_stat_activity
+	ApplicationName string
+
+	// ConnectTimeout - сколько NewPool ждет базу при старте, пока не сдастся
+	ConnectTimeout time.Duration
+
+	// ReplicaDSN - реплика для чтений, пусто - все идет в основную базу
+	ReplicaDSN string
+	// MaxReplicaLag - отставание, после которого чтения уходят на основную базу
+	MaxReplicaLag time.Duration
 }
 
-func NewPool(ctx context.Context) *pgxpool.Pool {
-	dsn := os.Getenv("POSTGRES_DATABASE_URL")
-	if dsn == "" {
-		logging.Logger.Fatal("POSTGRES_DATABASE_URL is not set")
+// Пауза между попытками подключиться при старте.
+const (
+	connectRetryBaseDelay = 250 * time.Millisecond
+	connectRetryMaxDelay  = 5 * time.Second
+)
+
+// NewPool создает пул и ждет, пока база ответит на ping. Пока база поднимается,
+// попытки повторяются с растущей паузой, но не дольше cfg.ConnectTimeout и не
+// дольше жизни ctx.
+func NewPool(ctx context.Context, cfg Config) (*pgxpool.Pool, error) {
+	poolConfig, err := parsePoolConfig(cfg.DSN, cfg)
+	if err != nil {
+		return nil, fmt.Errorf("invalid POSTGRES_DATABASE_URL: %w", err)
 	}
 
-	db, err := pgxpool.New(ctx, dsn)
+	db, err := pgxpool.NewWithConfig(ctx, poolConfig)
 	if err != nil {
-		logging.Logger.WithError(err).Fatal("Unable to create connection pool")
+		return nil, fmt.Errorf("unable to create connection pool: %w", err)
 	}
 
-	if err := db.Ping(ctx); err != nil {
+	if err := connect(ctx, db, cfg.ConnectTimeout); err != nil {
 		db.Close()
-		logging.Logger.WithError(err).Fatal("Unable to ping database")
+		return nil, err
 	}
 
 	logging.Logger.Info("Successfully connected to PostgreSQL database")
 
-	return db
+	return db, nil
+}
+
+// NewReplicaPool создает пул реплики cfg.ReplicaDSN с теми же настройками, что у
+// основной базы. В отличие от NewPool он не ждет реплику: пока она недоступна,
+// Router читает с основной базы.
+func NewReplicaPool(ctx context.Context, cfg Config) (*pgxpool.Pool, error) {
+	poolConfig, err := parsePoolConfig(cfg.ReplicaDSN, cfg)
+	if err != nil {
+		return nil, fmt.Errorf("invalid POSTGRES_REPLICA_URL: %w", err)
+	}
+
+	db, err := pgxpool.NewWithConfig(ctx, poolConfig)
+	if err != nil {
+		return nil, fmt.Errorf("unable to create replica connection pool: %w", err)
+	}
+
+	return db, nil
+}
+
+func parsePoolConfig(dsn string, cfg Config) (*pgxpool.Config, error) {
+	poolConfig, err := pgxpool.ParseConfig(dsn)
+	if err != nil {
+		return nil, err
+	}
+
+	if cfg.MaxConns > 0 {
+		poolConfig.MaxConns = cfg.MaxConns
+	}
+	if cfg.MinConns > 0 {
+		poolConfig.MinConns = cfg.MinConns
+	}
+	if cfg.MaxConnLifetime > 0 {
+		poolConfig.MaxConnLifetime = cfg.MaxConnLifetime
+	}
+	if cfg.MaxConnIdleTime > 0 {
+		poolConfig.MaxConnIdleTime = cfg.MaxConnIdleTime
+	}
+	if cfg.StatementTimeout > 0 {
+		poolConfig.ConnConfig.RuntimeParams["statement_timeout"] = strconv.FormatInt(cfg.StatementTimeout.Milliseconds(), 10)
+	}
+	if cfg.ApplicationName != "" {
+		poolConfig.ConnConfig.RuntimeParams["application_name"] = cfg.ApplicationName
+	}
+
+	return poolConfig, nil
+}
+
+// connect пингует базу, пока она не ответит. Без timeout ждет, пока жив ctx.
+func connect(ctx context.Context, db *pgxpool.Pool, timeout time.Duration) error {
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+
+	delay := connectRetryBaseDelay
+	for attempt := 1; ; attempt++ {
+		err := db.Ping(ctx)
+		if err == nil {
+			return nil
+		}
+
+		logging.Logger.WithError(err).Warnf("Database is not ready, attempt %d, retrying in %v", attempt, delay)
+
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return fmt.Errorf("unable to connect to database after %d attempts: %w", attempt, err)
+		case <-timer.C:
+		}
+
+		delay = min(delay*2, connectRetryMaxDelay)
+	}
 }
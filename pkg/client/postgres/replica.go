@@ -0,0 +1,131 @@
+package postgres
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"sync/atomic"
+	"time"
+
+	"walet_rest_api/pkg/logging"
+)
+
+// replicaLagCheckPeriod - как часто Router проверяет отставание реплики.
+const replicaLagCheckPeriod = time.Second
+
+// replicaLagCheckTimeout - сколько ждать ответа реплики на проверку.
+const replicaLagCheckTimeout = 2 * time.Second
+
+// replicaLagQuery возвращает, принимает ли реплика WAL от основной базы, и ее
+// отставание в секундах. Пока реплика проигрывает полученное, отставание -
+// возраст последней проигранной транзакции. Если проиграно все полученное,
+// отставание - сколько прошло с последнего сообщения основной базы: она шлет их
+// и без записи, поэтому простой основной базы не выглядит как отставание, а
+// оборванная репликация - выглядит. Без прав pg_read_all_stats статус получателя
+// не виден, и реплика считается отключенной.
+const replicaLagQuery = `SELECT
+	COALESCE((SELECT status = 'streaming' FROM pg_stat_wal_receiver), false),
+	CASE
+		WHEN pg_last_wal_receive_lsn() = pg_last_wal_replay_lsn()
+			THEN (SELECT EXTRACT(EPOCH FROM now() - last_msg_receipt_time) FROM pg_stat_wal_receiver)
+		ELSE EXTRACT(EPOCH FROM now() - pg_last_xact_replay_timestamp())
+	END::float8`
+
+// Router - Pool основной базы, который умеет выполнять чтения на реплике. Все
+// методы Pool, а значит запись и транзакции, идут в основную базу.
+type Router struct {
+	Pool
+	replica Client
+	maxLag  time.Duration
+
+	//Результат последней проверки реплики. Чтения его только читают, проверка
+	//идет в фоне и не задерживает их
+	healthy   atomic.Bool
+	checkedAt atomic.Int64
+	checking  atomic.Bool
+}
+
+func NewRouter(primary Pool, replica Client, maxLag time.Duration) *Router {
+	return &Router{Pool: primary, replica: replica, maxLag: maxLag}
+}
+
+// Read выполняет чтение fn на реплике. Если реплика отстает больше maxLag или fn
+// на ней вернула ошибку, fn выполняется заново на основной базе. Ошибка может
+// быть и не сбоем реплики: например, кошелек, созданный только что, на реплику
+// еще не доехал. Повтор на основной базе дает верный ответ и в этом случае.
+func (r *Router) Read(ctx context.Context, fn func(client Client) error) error {
+	if r.replicaHealthy() {
+		err := fn(r.replica)
+		if err == nil {
+			return nil
+		}
+		logging.Logger.WithError(err).Debug("Replica read failed, retrying on primary")
+	}
+
+	return fn(r.Pool)
+}
+
+// replicaHealthy возвращает результат последней проверки и, если он старше
+// replicaLagCheckPeriod, запускает новую в фоне. До первой проверки чтения идут
+// в основную базу.
+func (r *Router) replicaHealthy() bool {
+	stale := time.Since(time.Unix(0, r.checkedAt.Load())) >= replicaLagCheckPeriod
+	if stale && r.checking.CompareAndSwap(false, true) {
+		go func() {
+			defer r.checking.Store(false)
+
+			ctx, cancel := context.WithTimeout(context.Background(), replicaLagCheckTimeout)
+			defer cancel()
+			r.checkReplica(ctx)
+		}()
+	}
+
+	return r.healthy.Load()
+}
+
+// checkReplica проверяет реплику и публикует результат. В лог попадают только
+// смены состояния, а не каждая проверка.
+func (r *Router) checkReplica(ctx context.Context) {
+	streaming, lag, err := r.replicaLag(ctx)
+	healthy := err == nil && streaming && lag <= r.maxLag
+
+	first := r.checkedAt.Load() == 0
+	wasHealthy := r.healthy.Swap(healthy)
+	r.checkedAt.Store(time.Now().UnixNano())
+
+	if healthy {
+		if !wasHealthy {
+			logging.Logger.Info("Replica caught up, reading from replica")
+		}
+		return
+	}
+	if !wasHealthy && !first {
+		return
+	}
+
+	switch {
+	case err != nil:
+		logging.Logger.WithError(err).Warn("Failed to check replica lag, reading from primary")
+	case !streaming:
+		logging.Logger.Warn("Replica is not receiving WAL from primary, reading from primary")
+	case lag == time.Duration(math.MaxInt64):
+		logging.Logger.Warn("Replica lag is unknown, reading from primary")
+	default:
+		logging.Logger.Warnf("Replica lags %v behind primary, reading from primary", lag)
+	}
+}
+
+// replicaLag возвращает, принимает ли реплика WAL, и ее отставание. Неизвестное
+// отставание считается бесконечным.
+func (r *Router) replicaLag(ctx context.Context) (bool, time.Duration, error) {
+	var streaming bool
+	var seconds *float64
+	if err := r.replica.QueryRow(ctx, replicaLagQuery).Scan(&streaming, &seconds); err != nil {
+		return false, 0, fmt.Errorf("failed to query replica lag: %w", err)
+	}
+
+	if seconds == nil || *seconds >= math.MaxInt64/float64(time.Second) {
+		return streaming, time.Duration(math.MaxInt64), nil
+	}
+	return streaming, time.Duration(*seconds * float64(time.Second)), nil
+}
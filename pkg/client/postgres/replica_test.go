@@ -0,0 +1,177 @@
+package postgres
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+type lagRow struct {
+	streaming bool
+	seconds   *float64
+	err       error
+}
+
+func (r lagRow) Scan(dest ...any) error {
+	if r.err != nil {
+		return r.err
+	}
+	*dest[0].(*bool) = r.streaming
+	*dest[1].(**float64) = r.seconds
+	return nil
+}
+
+func streamingLag(seconds float64) lagRow {
+	return lagRow{streaming: true, seconds: &seconds}
+}
+
+// fakeReplica отвечает на запрос отставания, остальные методы Client не нужны.
+// С block проверка ждет, пока канал не закроют
+type fakeReplica struct {
+	Client
+	lag    lagRow
+	block  chan struct{}
+	checks atomic.Int32
+}
+
+func (f *fakeReplica) QueryRow(ctx context.Context, sql string, args ...any) pgx.Row {
+	f.checks.Add(1)
+	if f.block != nil {
+		<-f.block
+	}
+	return f.lag
+}
+
+func readFrom(t *testing.T, router *Router, fn func(client Client) error) Client {
+	t.Helper()
+
+	var used Client
+	err := router.Read(context.Background(), func(client Client) error {
+		used = client
+		return fn(client)
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	return used
+}
+
+func succeed(client Client) error { return nil }
+
+func TestRouter_ReadsFromReplica(t *testing.T) {
+	primary := &fakePool{}
+	replica := &fakeReplica{lag: streamingLag(0.5)}
+	router := NewRouter(primary, replica, time.Second)
+	router.checkReplica(context.Background())
+
+	if used := readFrom(t, router, succeed); used != replica {
+		t.Errorf("expected read from replica")
+	}
+
+	//Отставание проверяется не на каждом чтении
+	readFrom(t, router, succeed)
+	if checks := replica.checks.Load(); checks != 1 {
+		t.Errorf("expected one lag check, got %d", checks)
+	}
+}
+
+func TestRouter_FallsBackOnLag(t *testing.T) {
+	primary := &fakePool{}
+	replica := &fakeReplica{lag: streamingLag(10)}
+	router := NewRouter(primary, replica, time.Second)
+	router.checkReplica(context.Background())
+
+	if used := readFrom(t, router, succeed); used != primary {
+		t.Errorf("expected read from primary when replica lags")
+	}
+}
+
+func TestRouter_FallsBackWhenReceiverDisconnected(t *testing.T) {
+	primary := &fakePool{}
+	//Реплика проиграла все полученное, но больше ничего не получает
+	replica := &fakeReplica{lag: lagRow{streaming: false}}
+	router := NewRouter(primary, replica, time.Second)
+	router.checkReplica(context.Background())
+
+	if used := readFrom(t, router, succeed); used != primary {
+		t.Errorf("expected read from primary when replica does not receive WAL")
+	}
+}
+
+func TestRouter_FallsBackWhenLagUnknown(t *testing.T) {
+	primary := &fakePool{}
+	replica := &fakeReplica{lag: lagRow{err: errors.New("connection refused")}}
+	router := NewRouter(primary, replica, time.Second)
+	router.checkReplica(context.Background())
+
+	if used := readFrom(t, router, succeed); used != primary {
+		t.Errorf("expected read from primary when replica is unreachable")
+	}
+
+	replica.lag = lagRow{streaming: true}
+	router.checkReplica(context.Background())
+	if used := readFrom(t, router, succeed); used != primary {
+		t.Errorf("expected read from primary when replica lag is unknown")
+	}
+}
+
+func TestRouter_DoesNotWaitForLagCheck(t *testing.T) {
+	primary := &fakePool{}
+	replica := &fakeReplica{lag: streamingLag(0), block: make(chan struct{})}
+	router := NewRouter(primary, replica, time.Second)
+
+	//Проверка висит, чтения тем временем идут в основную базу и не ждут ее
+	done := make(chan Client)
+	go func() {
+		for i := 0; i < 3; i++ {
+			readFrom(t, router, succeed)
+		}
+		done <- readFrom(t, router, succeed)
+	}()
+
+	select {
+	case used := <-done:
+		if used != primary {
+			t.Errorf("expected read from primary before the first check")
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("read waited for the replica lag check")
+	}
+	close(replica.block)
+
+	//Пока идет одна проверка, новые не запускаются
+	for replica.checks.Load() == 0 || router.checking.Load() {
+		time.Sleep(time.Millisecond)
+	}
+	if checks := replica.checks.Load(); checks != 1 {
+		t.Errorf("expected one lag check, got %d", checks)
+	}
+	if used := readFrom(t, router, succeed); used != replica {
+		t.Errorf("expected read from replica after the check")
+	}
+}
+
+func TestRouter_RetriesFailedReadOnPrimary(t *testing.T) {
+	primary := &fakePool{}
+	replica := &fakeReplica{lag: streamingLag(0)}
+	router := NewRouter(primary, replica, time.Second)
+	router.checkReplica(context.Background())
+
+	var attempts []Client
+	used := readFrom(t, router, func(client Client) error {
+		attempts = append(attempts, client)
+		if client == replica {
+			return errors.New("wallet not found")
+		}
+		return nil
+	})
+
+	if len(attempts) != 2 || attempts[0] != replica || used != primary {
+		t.Errorf("expected replica read retried on primary, got %d attempts", len(attempts))
+	}
+}
@@ -0,0 +1,77 @@
+package postgres
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+const (
+	serializationFailureCode = "40001"
+	deadlockDetectedCode     = "40P01"
+)
+
+// Повтор транзакций в WithTx: число попыток и границы паузы между ними.
+const (
+	maxTxAttempts    = 5
+	txRetryBaseDelay = 10 * time.Millisecond
+	txRetryMaxDelay  = 500 * time.Millisecond
+)
+
+// WithTx выполняет fn в транзакции и фиксирует ее, если fn вернула nil. Любая
+// ошибка откатывает транзакцию. Если база отменила транзакцию из-за конфликта
+// сериализации (40001) или взаимоблокировки (40P01), fn выполняется заново в
+// новой транзакции, всего не больше maxTxAttempts раз. Поэтому fn не должна
+// ничего оставлять снаружи до успешного завершения: все, что она прочитала в
+// прошлой попытке, уже устарело.
+func WithTx(ctx context.Context, db Pool, opts pgx.TxOptions, fn func(tx pgx.Tx) error) error {
+	for attempt := 1; ; attempt++ {
+		err := runTx(ctx, db, opts, fn)
+		if err == nil || !isRetryable(err) || attempt == maxTxAttempts {
+			return err
+		}
+
+		timer := time.NewTimer(retryDelay(attempt))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return err
+		case <-timer.C:
+		}
+	}
+}
+
+func runTx(ctx context.Context, db Pool, opts pgx.TxOptions, fn func(tx pgx.Tx) error) error {
+	tx, err := db.BeginTx(ctx, opts)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	if err := fn(tx); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	return nil
+}
+
+func isRetryable(err error) bool {
+	var pgErr *pgconn.PgError
+	return errors.As(err, &pgErr) && (pgErr.Code == serializationFailureCode || pgErr.Code == deadlockDetectedCode)
+}
+
+// retryDelay растет вдвое с каждой попыткой до txRetryMaxDelay. Случайный разброс
+// от половины до полной паузы разводит транзакции, которые столкнулись друг с другом.
+func retryDelay(attempt int) time.Duration {
+	delay := min(txRetryBaseDelay<<(attempt-1), txRetryMaxDelay)
+	return delay/2 + rand.N(delay/2+1)
+}
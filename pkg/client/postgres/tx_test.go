@@ -0,0 +1,109 @@
+package postgres
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+type fakeTx struct {
+	pgx.Tx
+	committed  bool
+	rolledBack bool
+}
+
+func (f *fakeTx) Commit(ctx context.Context) error {
+	f.committed = true
+	return nil
+}
+
+func (f *fakeTx) Rollback(ctx context.Context) error {
+	if !f.committed {
+		f.rolledBack = true
+	}
+	return nil
+}
+
+type fakePool struct {
+	Client
+	txs []*fakeTx
+}
+
+func (f *fakePool) BeginTx(ctx context.Context, txOptions pgx.TxOptions) (pgx.Tx, error) {
+	tx := &fakeTx{}
+	f.txs = append(f.txs, tx)
+	return tx, nil
+}
+
+func TestWithTx_RetriesDeadlock(t *testing.T) {
+	pool := &fakePool{}
+
+	calls := 0
+	err := WithTx(context.Background(), pool, pgx.TxOptions{}, func(tx pgx.Tx) error {
+		calls++
+		if calls == 1 {
+			return &pgconn.PgError{Code: deadlockDetectedCode}
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if calls != 2 || len(pool.txs) != 2 {
+		t.Fatalf("expected two attempts, got %d calls and %d transactions", calls, len(pool.txs))
+	}
+	if !pool.txs[0].rolledBack || !pool.txs[1].committed {
+		t.Errorf("expected first transaction rolled back and second committed")
+	}
+}
+
+func TestWithTx_GivesUpAfterMaxAttempts(t *testing.T) {
+	pool := &fakePool{}
+
+	err := WithTx(context.Background(), pool, pgx.TxOptions{}, func(tx pgx.Tx) error {
+		return &pgconn.PgError{Code: serializationFailureCode}
+	})
+
+	var pgErr *pgconn.PgError
+	if !errors.As(err, &pgErr) || pgErr.Code != serializationFailureCode {
+		t.Fatalf("expected serialization failure, got %v", err)
+	}
+	if len(pool.txs) != maxTxAttempts {
+		t.Errorf("expected %d attempts, got %d", maxTxAttempts, len(pool.txs))
+	}
+}
+
+func TestWithTx_DoesNotRetryOtherErrors(t *testing.T) {
+	pool := &fakePool{}
+	failure := errors.New("insufficient funds")
+
+	err := WithTx(context.Background(), pool, pgx.TxOptions{}, func(tx pgx.Tx) error {
+		return failure
+	})
+	if !errors.Is(err, failure) {
+		t.Fatalf("expected fn error, got %v", err)
+	}
+	if len(pool.txs) != 1 || !pool.txs[0].rolledBack {
+		t.Errorf("expected a single rolled back transaction, got %d", len(pool.txs))
+	}
+}
+
+func TestWithTx_StopsRetryingOnCancel(t *testing.T) {
+	pool := &fakePool{}
+	ctx, cancel := context.WithCancel(context.Background())
+
+	err := WithTx(ctx, pool, pgx.TxOptions{}, func(tx pgx.Tx) error {
+		cancel()
+		return &pgconn.PgError{Code: deadlockDetectedCode}
+	})
+	if err == nil {
+		t.Fatalf("expected error")
+	}
+	if len(pool.txs) != 1 {
+		t.Errorf("expected no retries after cancel, got %d attempts", len(pool.txs))
+	}
+}
@@ -16,30 +16,48 @@ func init() {
 
 	Logger.SetOutput(os.Stdout)
 
-	logLevel := os.Getenv("LOG_LEVEL")
-	if logLevel == "" {
-		logLevel = "info"
+	//До загрузки конфигурации пишем с уровнем info, см. Configure
+	Logger.SetLevel(logrus.InfoLevel)
+
+	Logger.SetReportCaller(true)
+
+	Logger.SetFormatter(textFormatter())
+}
+
+func textFormatter() logrus.Formatter {
+	return &logrus.TextFormatter{
+		CallerPrettyfier: callerPrettyfier,
+		DisableColors:    false,
+		FullTimestamp:    true,
+		TimestampFormat:  "2006-01-02 15:04:05",
 	}
+}
 
-	level, err := logrus.ParseLevel(logLevel)
+func callerPrettyfier(frame *runtime.Frame) (function string, file string) {
+	filename := path.Base(frame.File)
+	return fmt.Sprintf("%s()", frame.Function), fmt.Sprintf("%s:%d", filename, frame.Line)
+}
+
+// Configure задает уровень (info, debug, ...) и формат (text или json) логов.
+func Configure(level, format string) error {
+	parsed, err := logrus.ParseLevel(level)
 	if err != nil {
-		level = logrus.InfoLevel
+		return err
 	}
-	Logger.SetLevel(level)
 
-	Logger.SetReportCaller(true)
+	switch format {
+	case "text":
+		Logger.SetFormatter(textFormatter())
+	case "json":
+		Logger.SetFormatter(&logrus.JSONFormatter{CallerPrettyfier: callerPrettyfier})
+	default:
+		return fmt.Errorf("unknown log format %q, expected text or json", format)
+	}
 
-	Logger.SetFormatter(&logrus.TextFormatter{
-		CallerPrettyfier: func(frame *runtime.Frame) (function string, file string) {
-			filename := path.Base(frame.File)
-			return fmt.Sprintf("%s()", frame.Function), fmt.Sprintf("%s:%d", filename, frame.Line)
-		},
-		DisableColors:   false,
-		FullTimestamp:   true,
-		TimestampFormat: "2006-01-02 15:04:05",
-	})
+	Logger.SetLevel(parsed)
+	return nil
 }
 
 func GetLogger() *logrus.Logger {
 	return Logger
-}
\ No newline at end of file
+}